@@ -0,0 +1,27 @@
+--
+-- Migration: record job events
+--
+-- Changes made to jobs, including jobs marked as overdue by the
+-- scheduler, are recorded in job_events. Jobs created before this
+-- migration have no recorded events.
+--
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS public.job_events (
+    event_id uuid NOT NULL,
+    job_id uuid NOT NULL,
+    actor text NOT NULL,
+    event_type text NOT NULL,
+    old_value json DEFAULT '{}'::json NOT NULL,
+    new_value json DEFAULT '{}'::json NOT NULL,
+    created timestamp without time zone DEFAULT now() NOT NULL,
+    CONSTRAINT job_events_pkey PRIMARY KEY (event_id)
+);
+
+ALTER TABLE public.job_events OWNER TO postgres;
+
+CREATE INDEX IF NOT EXISTS job_events_job_id_idx
+    ON public.job_events USING btree (job_id, created);
+
+COMMIT;
@@ -0,0 +1,47 @@
+--
+-- Migration: store metadata patches in job history
+--
+-- Metadata updates record the JSON patch that was applied along with
+-- the previous and new metadata. Events recorded before this migration
+-- have no patch.
+--
+-- Job history is paginated in insertion order, so events are numbered
+-- by a sequence. Existing events are numbered by (created, event_id).
+--
+
+BEGIN;
+
+ALTER TABLE public.job_events ADD COLUMN IF NOT EXISTS patch json;
+
+CREATE SEQUENCE IF NOT EXISTS public.job_events_seq_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER TABLE public.job_events_seq_seq OWNER TO postgres;
+
+ALTER TABLE public.job_events ADD COLUMN IF NOT EXISTS seq bigint;
+
+UPDATE public.job_events e SET seq = n.seq
+FROM (
+    SELECT event_id,
+           (SELECT COALESCE(MAX(seq), 0) FROM public.job_events)
+               + row_number() OVER (ORDER BY created, event_id) AS seq
+    FROM public.job_events
+    WHERE seq IS NULL
+) n
+WHERE e.event_id = n.event_id;
+
+SELECT setval('public.job_events_seq_seq', COALESCE(MAX(seq), 0) + 1, false)
+FROM public.job_events;
+
+ALTER TABLE ONLY public.job_events ALTER COLUMN seq SET DEFAULT nextval('public.job_events_seq_seq'::regclass);
+ALTER TABLE public.job_events ALTER COLUMN seq SET NOT NULL;
+ALTER SEQUENCE public.job_events_seq_seq OWNED BY public.job_events.seq;
+
+CREATE INDEX IF NOT EXISTS job_events_job_id_seq_idx ON public.job_events USING btree (job_id, seq);
+DROP INDEX IF EXISTS public.job_events_job_id_idx;
+
+COMMIT;
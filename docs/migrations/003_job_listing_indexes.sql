@@ -0,0 +1,16 @@
+--
+-- Migration: index job listings
+--
+-- Job listings are filtered by state and paginated with keyset cursors
+-- on (created, id) and (due, id).
+--
+
+BEGIN;
+
+CREATE INDEX IF NOT EXISTS jobs_created_id_idx ON public.jobs USING btree (created, id);
+
+CREATE INDEX IF NOT EXISTS jobs_due_id_idx ON public.jobs USING btree (due, id);
+
+CREATE INDEX IF NOT EXISTS jobs_state_idx ON public.jobs USING btree (state);
+
+COMMIT;
@@ -0,0 +1,38 @@
+--
+-- Migration: add comments on jobs
+--
+-- Comments are stored with the uids of all mentioned users. Previous
+-- bodies of edited comments are kept in job_comment_revisions.
+--
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS public.job_comments (
+    comment_id uuid NOT NULL,
+    job_id uuid NOT NULL,
+    author text NOT NULL,
+    body text NOT NULL,
+    mentions text[] DEFAULT '{}'::text[] NOT NULL,
+    created timestamp without time zone DEFAULT now() NOT NULL,
+    edited timestamp without time zone,
+    CONSTRAINT job_comments_pkey PRIMARY KEY (comment_id)
+);
+
+ALTER TABLE public.job_comments OWNER TO postgres;
+
+CREATE INDEX IF NOT EXISTS job_comments_job_id_idx
+    ON public.job_comments USING btree (job_id, created);
+
+CREATE TABLE IF NOT EXISTS public.job_comment_revisions (
+    comment_id uuid NOT NULL,
+    body text NOT NULL,
+    editor text NOT NULL,
+    created timestamp without time zone DEFAULT now() NOT NULL
+);
+
+ALTER TABLE public.job_comment_revisions OWNER TO postgres;
+
+CREATE INDEX IF NOT EXISTS job_comment_revisions_comment_id_idx
+    ON public.job_comment_revisions USING btree (comment_id);
+
+COMMIT;
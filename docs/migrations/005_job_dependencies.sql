@@ -0,0 +1,25 @@
+--
+-- Migration: add subtasks and job dependencies
+--
+-- Subtasks reference their parent job. Existing jobs have no parent
+-- and no dependencies.
+--
+
+BEGIN;
+
+ALTER TABLE public.jobs ADD COLUMN IF NOT EXISTS parent_id uuid;
+
+CREATE INDEX IF NOT EXISTS jobs_parent_id_idx ON public.jobs USING btree (parent_id);
+
+CREATE TABLE IF NOT EXISTS public.job_dependencies (
+    job_id uuid NOT NULL,
+    depends_on uuid NOT NULL,
+    CONSTRAINT job_dependencies_pkey PRIMARY KEY (job_id, depends_on)
+);
+
+ALTER TABLE public.job_dependencies OWNER TO postgres;
+
+CREATE INDEX IF NOT EXISTS job_dependencies_depends_on_idx
+    ON public.job_dependencies USING btree (depends_on);
+
+COMMIT;
@@ -0,0 +1,39 @@
+--
+-- Migration: add recurring job templates
+--
+-- Jobs generated from a template reference the template and the
+-- occurrence they were generated for. The unique index ensures that
+-- each occurrence is only generated once. Existing jobs were not
+-- generated from templates and keep NULL in both columns.
+--
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS public.job_templates (
+    template_id uuid NOT NULL,
+    name text NOT NULL,
+    meta json DEFAULT '{}'::json NOT NULL,
+    due_offset bigint DEFAULT 0 NOT NULL,
+    default_assignee text DEFAULT ''::text NOT NULL,
+    schedule text NOT NULL,
+    start timestamp without time zone NOT NULL,
+    creator text NOT NULL,
+    created timestamp without time zone NOT NULL,
+    last_occurrence timestamp without time zone,
+    next_occurrence timestamp without time zone,
+    CONSTRAINT job_templates_pkey PRIMARY KEY (template_id)
+);
+
+ALTER TABLE public.job_templates OWNER TO postgres;
+
+CREATE INDEX IF NOT EXISTS job_templates_next_occurrence_idx
+    ON public.job_templates USING btree (next_occurrence);
+
+ALTER TABLE public.jobs ADD COLUMN IF NOT EXISTS template_id uuid;
+
+ALTER TABLE public.jobs ADD COLUMN IF NOT EXISTS occurrence timestamp without time zone;
+
+CREATE UNIQUE INDEX IF NOT EXISTS jobs_template_id_occurrence_idx
+    ON public.jobs USING btree (template_id, occurrence);
+
+COMMIT;
@@ -0,0 +1,13 @@
+--
+-- Migration: add job versions
+--
+-- Every mutation of a job increments its version, which is returned
+-- as the ETag of the job. The column default backfills all existing
+-- jobs with version 1.
+--
+
+BEGIN;
+
+ALTER TABLE public.jobs ADD COLUMN IF NOT EXISTS version integer DEFAULT 1 NOT NULL;
+
+COMMIT;
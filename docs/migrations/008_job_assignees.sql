@@ -0,0 +1,27 @@
+--
+-- Migration: support multiple assignees per job
+--
+-- Jobs can be assigned to several users, each with an assignment role
+-- of owner, reviewer or helper. A job could previously be assigned to
+-- a single user, so every existing assignment becomes the owner
+-- assignment of its job through the column default. Existing
+-- assignments are recorded as assigned at the time of the migration.
+--
+
+BEGIN;
+
+ALTER TABLE public.assigned_jobs
+    ADD COLUMN IF NOT EXISTS role text DEFAULT 'owner'::text NOT NULL,
+    ADD COLUMN IF NOT EXISTS assigned timestamp without time zone DEFAULT now() NOT NULL;
+
+ALTER TABLE public.assigned_jobs
+    DROP CONSTRAINT IF EXISTS assigned_jobs_pkey,
+    ADD CONSTRAINT assigned_jobs_pkey PRIMARY KEY (id, uid);
+
+-- each job has at most a single owner
+CREATE UNIQUE INDEX IF NOT EXISTS assigned_jobs_owner_idx
+    ON public.assigned_jobs USING btree (id) WHERE (role = 'owner'::text);
+
+CREATE INDEX IF NOT EXISTS assigned_jobs_uid_idx ON public.assigned_jobs USING btree (uid);
+
+COMMIT;
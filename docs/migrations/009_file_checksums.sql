@@ -0,0 +1,14 @@
+--
+-- Migration: store file sizes beyond 2GB and file checksums
+--
+-- Streamed uploads store the SHA-256 checksum of the file contents.
+-- Files uploaded before this migration have no checksum.
+--
+
+BEGIN;
+
+ALTER TABLE public.file_metadata ALTER COLUMN size TYPE bigint;
+
+ALTER TABLE public.file_metadata ADD COLUMN IF NOT EXISTS checksum text;
+
+COMMIT;
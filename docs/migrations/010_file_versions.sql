@@ -0,0 +1,26 @@
+--
+-- Migration: add file versions
+--
+-- Uploading new contents for a file creates a new version. Existing
+-- files are at version 1 through the column default and have no rows
+-- in file_versions. Their contents remain stored under the file ID and
+-- are served as version 1.
+--
+
+BEGIN;
+
+ALTER TABLE public.file_metadata ADD COLUMN IF NOT EXISTS version integer DEFAULT 1 NOT NULL;
+
+CREATE TABLE IF NOT EXISTS public.file_versions (
+    file_id uuid NOT NULL,
+    version integer NOT NULL,
+    size bigint NOT NULL,
+    checksum text NOT NULL,
+    creator text NOT NULL,
+    created timestamp without time zone DEFAULT now() NOT NULL,
+    CONSTRAINT file_versions_pkey PRIMARY KEY (file_id, version)
+);
+
+ALTER TABLE public.file_versions OWNER TO postgres;
+
+COMMIT;
@@ -0,0 +1,22 @@
+--
+-- Migration: store file contents in blob stores
+--
+-- File versions reference the blob containing their contents. Blobs of
+-- existing versions keep the key they were stored under on disk, which
+-- is the file ID for the first version and <file ID>.<version> for
+-- later versions. The local blob store still finds these blobs in the
+-- flat directory layout.
+--
+
+BEGIN;
+
+ALTER TABLE public.file_versions ADD COLUMN IF NOT EXISTS blob_key text;
+
+UPDATE public.file_versions
+SET blob_key = CASE WHEN version <= 1 THEN file_id::text
+    ELSE file_id::text || '.' || version END
+WHERE blob_key IS NULL;
+
+ALTER TABLE public.file_versions ALTER COLUMN blob_key SET NOT NULL;
+
+COMMIT;
@@ -0,0 +1,24 @@
+--
+-- Migration: deduplicate file contents
+--
+-- Blobs are registered by checksum and reference counted, so that
+-- versions with identical contents share a single blob. Versions
+-- stored before this migration are not registered. They are counted
+-- when a blob with the same checksum and key is first registered, and
+-- are otherwise owned by their file.
+--
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS public.blobs (
+    checksum text NOT NULL,
+    blob_key text NOT NULL,
+    size bigint NOT NULL,
+    ref_count integer DEFAULT 1 NOT NULL,
+    created timestamp without time zone DEFAULT now() NOT NULL,
+    CONSTRAINT blobs_pkey PRIMARY KEY (checksum)
+);
+
+ALTER TABLE public.blobs OWNER TO postgres;
+
+COMMIT;
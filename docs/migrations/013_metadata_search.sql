@@ -0,0 +1,23 @@
+--
+-- Migration: support timestamp comparisons in metadata search
+--
+-- Metadata values are compared as timestamps by the search operators.
+-- Values that cannot be parsed as timestamps are converted to NULL
+-- instead of failing the search.
+--
+
+BEGIN;
+
+CREATE OR REPLACE FUNCTION public.try_timestamptz(value text) RETURNS timestamp with time zone
+    LANGUAGE plpgsql STABLE
+    AS $$
+BEGIN
+    RETURN value::timestamp with time zone;
+EXCEPTION WHEN others THEN
+    RETURN NULL;
+END;
+$$;
+
+ALTER FUNCTION public.try_timestamptz(value text) OWNER TO postgres;
+
+COMMIT;
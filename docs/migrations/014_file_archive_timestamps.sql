@@ -0,0 +1,13 @@
+--
+-- Migration: record when files are archived
+--
+-- Retention policies expire archived files based on the time they were
+-- archived. Files archived before this migration have no archive time,
+-- and their creation time is used instead.
+--
+
+BEGIN;
+
+ALTER TABLE public.file_metadata ADD COLUMN IF NOT EXISTS archived_at timestamp without time zone;
+
+COMMIT;
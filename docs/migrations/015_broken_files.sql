@@ -0,0 +1,12 @@
+--
+-- Migration: mark broken files
+--
+-- The storage consistency checker marks files whose blobs are missing
+-- as broken. Existing files are not broken until the checker has run.
+--
+
+BEGIN;
+
+ALTER TABLE public.file_metadata ADD COLUMN IF NOT EXISTS broken boolean DEFAULT false NOT NULL;
+
+COMMIT;
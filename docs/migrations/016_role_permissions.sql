@@ -0,0 +1,48 @@
+--
+-- Migration: replace the linear role ladder with permission sets
+--
+-- Roles keep their existing IDs (1 = Standard, 2 = Clerk, 3 = Planner,
+-- 4 = Admin), so user_roles is left unchanged. Each role is granted the
+-- permissions it held implicitly under the ladder, so the effective
+-- access of every user is unchanged by the migration.
+--
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS public.role_permissions (
+    role integer NOT NULL,
+    permission text NOT NULL,
+    CONSTRAINT role_permissions_pkey PRIMARY KEY (role, permission)
+);
+
+ALTER TABLE public.role_permissions OWNER TO postgres;
+
+INSERT INTO public.role_permissions (role, permission)
+SELECT r.role, p.permission
+FROM (VALUES
+    -- Standard: work on assigned jobs and manage files
+    (1, 'jobs:update'),
+    (1, 'files:write'),
+    (1, 'files:archive'),
+    (1, 'files:delete'),
+    -- Clerk: additionally create and triage jobs
+    (2, 'jobs:create'),
+    (2, 'jobs:triage'),
+    -- Planner: additionally plan and schedule jobs
+    (3, 'jobs:read_all'),
+    (3, 'jobs:assign'),
+    (3, 'jobs:cancel'),
+    (3, 'jobs:reopen'),
+    (3, 'jobs:templates'),
+    -- Admin: additionally administer jobs, files and roles
+    (4, 'jobs:delete'),
+    (4, 'comments:moderate'),
+    (4, 'files:admin'),
+    (4, 'roles:manage')
+) AS p(min_role, permission)
+-- roles inherit the permissions of all lower roles on the ladder
+CROSS JOIN (VALUES (1), (2), (3), (4)) AS r(role)
+WHERE r.role >= p.min_role
+ON CONFLICT DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,44 @@
+--
+-- Migration: add teams and team job queues
+--
+-- Teams and their members are stored by the roles service. Jobs can be
+-- assigned to the queue of a team, from which unowned jobs are claimed
+-- by members of the team. Management of teams is granted to Admin
+-- (role 4), while team leads can manage the members of their own team.
+--
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS public.teams (
+    team_id uuid NOT NULL,
+    name text NOT NULL,
+    creator text NOT NULL,
+    created timestamp without time zone NOT NULL,
+    CONSTRAINT teams_pkey PRIMARY KEY (team_id),
+    CONSTRAINT teams_name_key UNIQUE (name)
+);
+
+ALTER TABLE public.teams OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS public.team_members (
+    team_id uuid NOT NULL,
+    uid text NOT NULL,
+    lead boolean DEFAULT false NOT NULL,
+    added timestamp without time zone NOT NULL,
+    CONSTRAINT team_members_pkey PRIMARY KEY (team_id, uid)
+);
+
+ALTER TABLE public.team_members OWNER TO postgres;
+
+CREATE INDEX IF NOT EXISTS team_members_uid_idx ON public.team_members USING btree (uid);
+
+ALTER TABLE public.jobs ADD COLUMN IF NOT EXISTS team_id uuid;
+
+CREATE INDEX IF NOT EXISTS jobs_team_id_idx ON public.jobs USING btree (team_id)
+    WHERE (NOT assigned);
+
+INSERT INTO public.role_permissions (role, permission)
+VALUES (4, 'teams:manage')
+ON CONFLICT DO NOTHING;
+
+COMMIT;
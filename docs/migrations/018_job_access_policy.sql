@@ -0,0 +1,16 @@
+--
+-- Migration: restrict access to jobs
+--
+-- Jobs are now only modified by their creator, their assignees and users
+-- with the jobs:update_all permission. The permission is granted to
+-- Planner (role 3) and Admin (role 4), who could previously modify any
+-- job, so that planning and administration are unaffected.
+--
+
+BEGIN;
+
+INSERT INTO public.role_permissions (role, permission)
+VALUES (3, 'jobs:update_all'), (4, 'jobs:update_all')
+ON CONFLICT DO NOTHING;
+
+COMMIT;
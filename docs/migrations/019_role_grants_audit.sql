@@ -0,0 +1,28 @@
+--
+-- Migration: audit role grants
+--
+-- Every change to the role of a user is recorded along with the user
+-- that made the change and the previous role of the user. A NULL role
+-- records a revoked grant, and a NULL previous role records a user that
+-- had not been granted a role. Grants made before this migration have
+-- no audit entries.
+--
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS public.role_grants_audit (
+    audit_id uuid NOT NULL,
+    uid text NOT NULL,
+    role integer,
+    previous_role integer,
+    granted_by text NOT NULL,
+    granted timestamp without time zone NOT NULL,
+    CONSTRAINT role_grants_audit_pkey PRIMARY KEY (audit_id)
+);
+
+ALTER TABLE public.role_grants_audit OWNER TO postgres;
+
+CREATE INDEX IF NOT EXISTS role_grants_audit_uid_granted_idx
+    ON public.role_grants_audit USING btree (uid, granted);
+
+COMMIT;
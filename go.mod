@@ -4,8 +4,9 @@ go 1.15
 
 require (
 	github.com/evanphx/json-patch v0.5.2
-	github.com/gin-gonic/gin v1.7.1
+	github.com/gin-gonic/gin v1.7.7
 	github.com/google/uuid v1.2.0
+	github.com/jackc/pgconn v1.8.1
 	github.com/jackc/pgx/v4 v4.11.0
 	github.com/sirupsen/logrus v1.8.1
 )
@@ -1,9 +1,15 @@
 package filestore
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime/multipart"
+	"net/http"
 
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
@@ -11,64 +17,325 @@ import (
 	"github.com/PSauerborn/gamma-project/internal/pkg/utils"
 )
 
+var (
+	// define custom errors returned by the filestore API accessor
+	ErrInvalidRequest     = errors.New("filestore API rejected invalid request")
+	ErrUnexpectedResponse = errors.New("received unexpected response from filestore API")
+)
+
+// define client used to access the filestore API. requests are sent
+// on behalf of the given user, which is recorded as the creator of
+// any files and versions created through the accessor
 type FileStoreAPIAccessor struct {
 	*utils.BaseAPIAccessor
+	UserId string
 }
 
-func (accessor *FileStoreAPIAccessor) GetFileMetadata(fileId uuid.UUID) (FileMetadata, error) {
-	log.Debug(fmt.Sprintf("retrieving file metadata for %s", fileId))
-	var payload struct {
-		HTTPCode int          `json:"http_code"`
-		Metadata FileMetadata `json:"metadata"`
+// function used to execute a request against the filestore API. the
+// response body is decoded into the given payload if the response has
+// the expected status code, and non-success responses are mapped to
+// the errors returned by the filestore persistence layer
+func (accessor *FileStoreAPIAccessor) request(ctx context.Context, method, path string,
+	body io.Reader, headers map[string]string, expected int, payload interface{}) error {
+	response, err := accessor.execute(ctx, method, path, body, headers)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != expected {
+		return accessor.responseError(response)
 	}
-	// generate URL using file ID, and create new request
-	url := accessor.FormatURL(fmt.Sprintf("/filestore/file/meta/%s", fileId))
-	request, err := accessor.NewJSONRequest("GET", url, nil, nil)
+	if payload == nil {
+		return nil
+	}
+	if err := json.NewDecoder(response.Body).Decode(payload); err != nil {
+		log.Error(fmt.Errorf("unable to parse JSON response from API: %+v", err))
+		return ErrUnexpectedResponse
+	}
+	return nil
+}
+
+// function used to generate and execute a new request. the caller
+// is responsible for closing the body of the returned response
+func (accessor *FileStoreAPIAccessor) execute(ctx context.Context, method, path string,
+	body io.Reader, headers map[string]string) (*http.Response, error) {
+	url := accessor.FormatURL(path)
+	request, err := accessor.NewJSONRequestWithContext(ctx, method, url, body, headers)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to generate new request: %+v", err))
-		return payload.Metadata, err
+		return nil, err
+	}
+	if err := accessor.Authorize(request, accessor.UserId); err != nil {
+		return nil, err
 	}
 
 	response, err := accessor.ExecuteRequest(request)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to execute request: %+v", err))
-		return payload.Metadata, err
+		return nil, err
 	}
-	defer response.Body.Close()
+	return response, nil
+}
 
+// function used to map non-success responses to errors
+func (accessor *FileStoreAPIAccessor) responseError(response *http.Response) error {
+	body, _ := ioutil.ReadAll(response.Body)
+	log.Error(fmt.Sprintf("received non-success response from API with code %d: %s",
+		response.StatusCode, string(body)))
 	switch response.StatusCode {
-	case 200:
-		log.Debug("successfully retrieved metadata from API")
-		if err := json.NewDecoder(response.Body).Decode(&payload); err != nil {
-			log.Error(fmt.Errorf("unable to parse JSON response from API: %+v", err))
-			return payload.Metadata, err
-		}
-		return payload.Metadata, nil
+	case http.StatusBadRequest:
+		return ErrInvalidRequest
+	case http.StatusForbidden:
+		return ErrPermissionDenied
+	case http.StatusNotFound:
+		return ErrFileNotFound
+	case http.StatusRequestEntityTooLarge:
+		return ErrFileTooLarge
+	case http.StatusNotImplemented:
+		return ErrFeatureNotSupported
 	default:
-		body, _ := ioutil.ReadAll(response.Body)
-		log.Error(fmt.Sprintf("received non-success response from API: %+v", string(body)))
+		return ErrUnexpectedResponse
 	}
-	return payload.Metadata, nil
 }
 
-func (accessor *FileStoreAPIAccessor) GetFileContents(fileId uuid.UUID) ([]byte, error) {
-	var contents []byte
-	return contents, nil
+// function used to check the health of the filestore API
+func (accessor *FileStoreAPIAccessor) HealthCheck(ctx context.Context) error {
+	return accessor.request(ctx, "GET", "/filestore/health", nil, nil, http.StatusOK, nil)
+}
+
+// function used to retrieve metadata for all unarchived
+// or archived files
+func (accessor *FileStoreAPIAccessor) ListFiles(ctx context.Context,
+	archived bool) ([]FileMetadata, error) {
+	log.Debug(fmt.Sprintf("retrieving files with archived=%t", archived))
+	var payload struct {
+		HTTPCode int            `json:"http_code"`
+		Files    []FileMetadata `json:"files"`
+	}
+	path := fmt.Sprintf("/filestore/files?archived=%t", archived)
+	err := accessor.request(ctx, "GET", path, nil, nil, http.StatusOK, &payload)
+	return payload.Files, err
 }
 
-func (accessor *FileStoreAPIAccessor) ListFiles() ([]FileMetadata, error) {
-	files := []FileMetadata{}
-	return files, nil
+// function used to retrieve metadata for a single file
+func (accessor *FileStoreAPIAccessor) GetFileMetadata(ctx context.Context,
+	fileId uuid.UUID) (FileMetadata, error) {
+	log.Debug(fmt.Sprintf("retrieving file metadata for %s", fileId))
+	var payload struct {
+		HTTPCode int          `json:"http_code"`
+		Metadata FileMetadata `json:"metadata"`
+	}
+	path := fmt.Sprintf("/filestore/file/%s/meta", fileId)
+	err := accessor.request(ctx, "GET", path, nil, nil, http.StatusOK, &payload)
+	return payload.Metadata, err
 }
 
-func (accessor *FileStoreAPIAccessor) CreateFile(contents []byte) (uuid.UUID, error) {
-	return uuid.New(), nil
+// function used to open the contents of a file. the current version
+// is retrieved if version is 0. contents are streamed from the API,
+// and the caller is responsible for closing the returned reader
+func (accessor *FileStoreAPIAccessor) GetFileContents(ctx context.Context, fileId uuid.UUID,
+	version int) (io.ReadCloser, error) {
+	log.Debug(fmt.Sprintf("retrieving contents of file %s", fileId))
+	path := fmt.Sprintf("/filestore/file/%s/content", fileId)
+	if version > 0 {
+		path = fmt.Sprintf("%s?version=%d", path, version)
+	}
+	response, err := accessor.execute(ctx, "GET", path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		return nil, accessor.responseError(response)
+	}
+	return response.Body, nil
 }
 
-func (accessor *FileStoreAPIAccessor) ModifyFile(fileId uuid.UUID) error {
-	return nil
+// function used to create a new file from contents held in memory
+func (accessor *FileStoreAPIAccessor) CreateFile(ctx context.Context, contents []byte,
+	fileName string, meta map[string]interface{}) (uuid.UUID, error) {
+	log.Debug(fmt.Sprintf("creating new file %s", fileName))
+	var payload struct {
+		HTTPCode int       `json:"http_code"`
+		FileId   uuid.UUID `json:"file_id"`
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"meta":      meta,
+		"file_name": fileName,
+		"content":   utils.BytesToBase64(contents),
+	})
+	if err != nil {
+		log.Error(fmt.Errorf("unable to convert request body to JSON: %+v", err))
+		return payload.FileId, err
+	}
+	err = accessor.request(ctx, "POST", "/filestore/file", bytes.NewReader(body), nil,
+		http.StatusCreated, &payload)
+	return payload.FileId, err
 }
 
-func (accessor *FileStoreAPIAccessor) DeleteFile(fileId uuid.UUID) error {
-	return nil
+// function used to upload a new file. the file is streamed to the
+// API as a multipart request so that it is never buffered in memory
+func (accessor *FileStoreAPIAccessor) UploadFile(ctx context.Context, fileName string,
+	meta map[string]interface{}, content io.Reader) (FileUploadResult, error) {
+	log.Debug(fmt.Sprintf("uploading new file %s", fileName))
+	var payload struct {
+		HTTPCode int `json:"http_code"`
+		FileUploadResult
+	}
+	jsonMeta, err := json.Marshal(meta)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to convert file metadata to JSON: %+v", err))
+		return payload.FileUploadResult, err
+	}
+
+	// write multipart body in separate goroutine while request is sent
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(func() error {
+			if err := form.WriteField("meta", string(jsonMeta)); err != nil {
+				return err
+			}
+			if err := form.WriteField("file_name", fileName); err != nil {
+				return err
+			}
+			part, err := form.CreateFormFile("file", fileName)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(part, content); err != nil {
+				return err
+			}
+			return form.Close()
+		}())
+	}()
+	// ensure that the writer goroutine terminates if the
+	// request ended before the file was fully sent
+	defer body.Close()
+
+	headers := map[string]string{"Content-Type": form.FormDataContentType()}
+	err = accessor.request(ctx, "POST", "/filestore/file/upload", body, headers,
+		http.StatusCreated, &payload)
+	return payload.FileUploadResult, err
+}
+
+// function used to modify an existing file. the contents are
+// streamed to the API and stored as a new version of the file
+func (accessor *FileStoreAPIAccessor) ModifyFile(ctx context.Context, fileId uuid.UUID,
+	content io.Reader) (FileVersion, error) {
+	log.Debug(fmt.Sprintf("modifying file %s", fileId))
+	var payload struct {
+		HTTPCode int         `json:"http_code"`
+		Version  FileVersion `json:"version"`
+	}
+	path := fmt.Sprintf("/filestore/file/%s", fileId)
+	headers := map[string]string{"Content-Type": "application/octet-stream"}
+	err := accessor.request(ctx, "PUT", path, content, headers, http.StatusOK, &payload)
+	return payload.Version, err
+}
+
+// function used to delete a file and all of its versions
+func (accessor *FileStoreAPIAccessor) DeleteFile(ctx context.Context, fileId uuid.UUID) error {
+	log.Debug(fmt.Sprintf("deleting file %s", fileId))
+	path := fmt.Sprintf("/filestore/file/%s", fileId)
+	return accessor.request(ctx, "DELETE", path, nil, nil, http.StatusOK, nil)
+}
+
+// function used to archive a file
+func (accessor *FileStoreAPIAccessor) ArchiveFile(ctx context.Context, fileId uuid.UUID) error {
+	log.Debug(fmt.Sprintf("archiving file %s", fileId))
+	path := fmt.Sprintf("/filestore/file/%s/archive", fileId)
+	return accessor.request(ctx, "PUT", path, nil, nil, http.StatusOK, nil)
+}
+
+// function used to restore an archived file
+func (accessor *FileStoreAPIAccessor) UnarchiveFile(ctx context.Context, fileId uuid.UUID) error {
+	log.Debug(fmt.Sprintf("unarchiving file %s", fileId))
+	path := fmt.Sprintf("/filestore/file/%s/unarchive", fileId)
+	return accessor.request(ctx, "PUT", path, nil, nil, http.StatusOK, nil)
+}
+
+// function used to list all versions of a file
+func (accessor *FileStoreAPIAccessor) ListFileVersions(ctx context.Context,
+	fileId uuid.UUID) ([]FileVersion, error) {
+	log.Debug(fmt.Sprintf("retrieving versions of file %s", fileId))
+	var payload struct {
+		HTTPCode int           `json:"http_code"`
+		Versions []FileVersion `json:"versions"`
+	}
+	path := fmt.Sprintf("/filestore/file/%s/versions", fileId)
+	err := accessor.request(ctx, "GET", path, nil, nil, http.StatusOK, &payload)
+	return payload.Versions, err
+}
+
+// function used to restore a previous version of a file. the
+// restored contents are stored as a new version of the file
+func (accessor *FileStoreAPIAccessor) RestoreFileVersion(ctx context.Context, fileId uuid.UUID,
+	version int) (FileVersion, error) {
+	log.Debug(fmt.Sprintf("restoring version %d of file %s", version, fileId))
+	var payload struct {
+		HTTPCode int         `json:"http_code"`
+		Version  FileVersion `json:"version"`
+	}
+	path := fmt.Sprintf("/filestore/file/%s/versions/%d/restore", fileId, version)
+	err := accessor.request(ctx, "PUT", path, nil, nil, http.StatusOK, &payload)
+	return payload.Version, err
+}
+
+// function used to search files by metadata. the cursor of the
+// query is ignored, and the next page is requested by passing the
+// next cursor of the returned page
+func (accessor *FileStoreAPIAccessor) SearchFiles(ctx context.Context, query SearchQuery,
+	cursor string) (FilePage, error) {
+	log.Debug(fmt.Sprintf("searching files with query %+v", query))
+	var payload struct {
+		HTTPCode   int            `json:"http_code"`
+		Results    []FileMetadata `json:"results"`
+		Total      int            `json:"total"`
+		NextCursor string         `json:"next_cursor"`
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"conditions": query.Conditions,
+		"mode":       query.Mode.Name(),
+		"limit":      query.Limit,
+		"cursor":     cursor,
+	})
+	if err != nil {
+		log.Error(fmt.Errorf("unable to convert search query to JSON: %+v", err))
+		return FilePage{}, err
+	}
+	err = accessor.request(ctx, "POST", "/filestore/search", bytes.NewReader(body), nil,
+		http.StatusOK, &payload)
+	return FilePage{Files: payload.Results, Total: payload.Total,
+		NextCursor: payload.NextCursor}, err
+}
+
+// function used to retrieve a dry-run report of archived
+// files that will be purged by retention policies
+func (accessor *FileStoreAPIAccessor) GetRetentionReport(ctx context.Context) (
+	RetentionReport, error) {
+	var payload struct {
+		HTTPCode int             `json:"http_code"`
+		Report   RetentionReport `json:"report"`
+	}
+	err := accessor.request(ctx, "GET", "/filestore/retention/report", nil, nil,
+		http.StatusOK, &payload)
+	return payload.Report, err
+}
+
+// function used to check the consistency of file storage, optionally
+// repairing any inconsistencies found. requires the Admin role
+func (accessor *FileStoreAPIAccessor) CheckConsistency(ctx context.Context, repair bool) (
+	ConsistencyReport, error) {
+	var payload struct {
+		HTTPCode int               `json:"http_code"`
+		Report   ConsistencyReport `json:"report"`
+	}
+	method, path := "GET", "/filestore/admin/consistency"
+	if repair {
+		method, path = "POST", "/filestore/admin/consistency/repair"
+	}
+	err := accessor.request(ctx, method, path, nil, nil, http.StatusOK, &payload)
+	return payload.Report, err
 }
@@ -1,18 +1,47 @@
 package filestore
 
 import (
-	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/PSauerborn/gamma-project/internal/pkg/roles"
 	"github.com/PSauerborn/gamma-project/internal/pkg/utils"
 )
 
+// define the maximum size of non-file fields in multipart uploads
+const maxUploadFieldSize = 1 << 20
+
+// define global to store service settings
+var serviceConfig ServiceConfig
+
+type ServiceConfig struct {
+	// maximum size of uploaded files in bytes. a value
+	// of 0 disables the size limit
+	MaxUploadSize int64
+	// policies used to purge archived files
+	RetentionPolicies []RetentionPolicy
+	// minimum age of unreferenced blobs before they
+	// are treated as orphans by consistency checks
+	OrphanGracePeriod time.Duration
+	// cache of roles used to authorize admin routes
+	Roles *roles.RoleCache
+}
+
+// function used to set global service config settings
+func SetConfig(cfg ServiceConfig) {
+	serviceConfig = cfg
+}
+
 // API handler used to serve health check handler
 func HealthCheckHandler(ctx *gin.Context) {
 	log.Info("received request for health check handler")
@@ -20,7 +49,9 @@ func HealthCheckHandler(ctx *gin.Context) {
 		"message": "Service running"})
 }
 
-// API handler user to retrieve a given file
+// API handler user to retrieve the contents of a given file.
+// the contents are streamed from the blob store, and partial
+// and conditional requests are supported
 func GetFileHandler(ctx *gin.Context) {
 	log.Info("received request to retrieve file")
 	fileId, err := uuid.Parse(ctx.Param("fileId"))
@@ -45,8 +76,33 @@ func GetFileHandler(ctx *gin.Context) {
 		}
 		return
 	}
-	// open file with given file path
-	contents, err := persistence.GetFileContents(file)
+	// retrieve previous version of file if requested
+	version := file.Version
+	if v := ctx.Query("version"); len(v) > 0 {
+		version, err = strconv.Atoi(v)
+		if err != nil || version < 1 {
+			log.Error(fmt.Errorf("received invalid file version %s", v))
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"http_code": http.StatusBadRequest,
+				"message": "Invalid file version"})
+			return
+		}
+	}
+	fileVersion, err := persistence.GetFileVersion(fileId, version)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve file version: %+v", err))
+		switch err {
+		case ErrVersionNotFound:
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"http_code": http.StatusNotFound,
+				"message": "Cannot find file version"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
+		return
+	}
+	// open file contents from blob store
+	contents, err := persistence.GetFileContents(fileVersion)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to retrieve file contents: %+v", err))
 		status := http.StatusInternalServerError
@@ -54,17 +110,37 @@ func GetFileHandler(ctx *gin.Context) {
 			"message": "Internal server error"})
 		return
 	}
-	// generate reader from response body and attach to response
-	responseBody := bytes.NewReader(contents)
-	ctx.DataFromReader(http.StatusOK, int64(len(contents)), "", responseBody, nil)
+	defer contents.Close()
+
+	// serve contents with caching headers. range requests and
+	// conditional requests are handled by the standard library
+	ctx.Header("ETag", FileETag(fileVersion))
+	// file names that cannot be encoded are omitted from the header
+	if disposition := mime.FormatMediaType("attachment",
+		map[string]string{"filename": file.FileName}); len(disposition) > 0 {
+		ctx.Header("Content-Disposition", disposition)
+	}
+	http.ServeContent(ctx.Writer, ctx.Request, file.FileName, fileVersion.Created, contents)
 }
 
 // API handler user to retrieve all file metadata
-// from the persistence layer
+// from the persistence layer. archived files are
+// listed if the archived query parameter is set
 func ListFilesHandler(ctx *gin.Context) {
 	log.Info("received request to retrieve metadata for all files")
+	archived := false
+	if v := ctx.Query("archived"); len(v) > 0 {
+		var err error
+		archived, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Error(fmt.Errorf("received invalid archived flag %s", v))
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"http_code": http.StatusBadRequest,
+				"message": "Invalid archived flag"})
+			return
+		}
+	}
 	// retrieve metadata for all files from persistence layer
-	files, err := persistence.ListFiles()
+	files, err := persistence.ListFiles(archived)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to retrieve file(s): %+v", err))
 		status := http.StatusInternalServerError
@@ -130,7 +206,7 @@ func CreateFileHandler(ctx *gin.Context) {
 	}
 	// create new file instance via persistence interface
 	fileId, err := persistence.CreateFile(body, request.FileName,
-		request.Meta)
+		request.Meta, ctx.MustGet("uid").(string))
 	if err != nil {
 		log.Error(fmt.Errorf("unable to create new file instance: %+v", err))
 		status := http.StatusInternalServerError
@@ -142,7 +218,103 @@ func CreateFileHandler(ctx *gin.Context) {
 		"file_id": fileId})
 }
 
-// API handler used to modify an existing file
+// API handler used to upload a new file as a multipart stream. the
+// "meta" (JSON object) and "file_name" fields must precede the "file"
+// field, which is written to storage as it is received rather than
+// being buffered in memory
+func UploadFileHandler(ctx *gin.Context) {
+	log.Info("received request to upload file")
+	reader, err := ctx.Request.MultipartReader()
+	if err != nil {
+		log.Error(fmt.Errorf("unable to read multipart body: %+v", err))
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"http_code": http.StatusBadRequest,
+			"message": "Invalid multipart request"})
+		return
+	}
+
+	var (
+		fileName string
+		meta     = map[string]interface{}{}
+	)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("unable to read multipart body: %+v", err))
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"http_code": http.StatusBadRequest,
+				"message": "Invalid multipart request"})
+			return
+		}
+
+		switch part.FormName() {
+		case "meta":
+			body, err := ioutil.ReadAll(io.LimitReader(part, maxUploadFieldSize))
+			if err == nil {
+				err = json.Unmarshal(body, &meta)
+			}
+			if err != nil {
+				log.Error(fmt.Errorf("received invalid file metadata: %+v", err))
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"http_code": http.StatusBadRequest,
+					"message": "Invalid file metadata"})
+				return
+			}
+			if meta == nil {
+				meta = map[string]interface{}{}
+			}
+		case "file_name":
+			body, err := ioutil.ReadAll(io.LimitReader(part, maxUploadFieldSize))
+			if err != nil {
+				log.Error(fmt.Errorf("unable to read file name: %+v", err))
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"http_code": http.StatusBadRequest,
+					"message": "Invalid multipart request"})
+				return
+			}
+			fileName = string(body)
+		case "file":
+			// fall back to file name sent with the file part
+			if len(fileName) == 0 {
+				fileName = part.FileName()
+			}
+			if len(fileName) == 0 {
+				log.Error("received file upload without file name")
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"http_code": http.StatusBadRequest,
+					"message": "Missing file name"})
+				return
+			}
+
+			result, err := persistence.CreateFileFromStream(part, fileName, meta,
+				serviceConfig.MaxUploadSize, ctx.MustGet("uid").(string))
+			if err != nil {
+				log.Error(fmt.Errorf("unable to create new file instance: %+v", err))
+				switch err {
+				case ErrFileTooLarge:
+					status := http.StatusRequestEntityTooLarge
+					ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+						"message": fmt.Sprintf("File exceeds maximum size of %d bytes",
+							serviceConfig.MaxUploadSize)})
+				default:
+					status := http.StatusInternalServerError
+					ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+						"message": "Internal server error"})
+				}
+				return
+			}
+			ctx.JSON(http.StatusCreated, gin.H{"http_code": http.StatusCreated,
+				"file_id": result.FileId, "size": result.Size, "checksum": result.Checksum})
+			return
+		default:
+			log.Debug(fmt.Sprintf("skipping unknown multipart field %s", part.FormName()))
+		}
+	}
+	log.Error("received multipart upload without file")
+	ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"http_code": http.StatusBadRequest,
+		"message": "Missing file"})
+}
+
+// API handler used to modify an existing file. the request
+// body is stored as a new version of the file
 func PutFileHandler(ctx *gin.Context) {
 	log.Info("received request to modify file")
 	fileId, err := uuid.Parse(ctx.Param("fileId"))
@@ -167,21 +339,20 @@ func PutFileHandler(ctx *gin.Context) {
 		}
 		return
 	}
-	// extract request body and read
-	body, err := ioutil.ReadAll(ctx.Request.Body)
+	// stream request body into new file version
+	version, err := persistence.ModifyFile(meta, ctx.Request.Body, serviceConfig.MaxUploadSize,
+		ctx.MustGet("uid").(string))
 	if err != nil {
-		log.Error(fmt.Errorf("unable to extract request body: %+v", err))
-		ctx.JSON(http.StatusBadRequest,
-			gin.H{"http_code": http.StatusBadRequest, "message": "Invalid request body"})
-		return
-	}
-	// mofidy file via persistence layer
-	if err := persistence.ModifyFile(meta, body); err != nil {
 		log.Error(fmt.Errorf("unable to modify file: %+v", err))
 		switch err {
-		case ErrFeatureNotSupported:
-			ctx.AbortWithStatusJSON(http.StatusNotImplemented, gin.H{"http_code": http.StatusNotImplemented,
-				"message": "Internal server error"})
+		case ErrFileNotFound:
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"http_code": http.StatusNotFound,
+				"message": "Cannot find file"})
+		case ErrFileTooLarge:
+			status := http.StatusRequestEntityTooLarge
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": fmt.Sprintf("File exceeds maximum size of %d bytes",
+					serviceConfig.MaxUploadSize)})
 		default:
 			status := http.StatusInternalServerError
 			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
@@ -190,7 +361,7 @@ func PutFileHandler(ctx *gin.Context) {
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
-		"message": "Successfully modified file"})
+		"message": "Successfully modified file", "version": version})
 }
 
 // API handler used to delete a given file
@@ -272,10 +443,45 @@ func ArchiveFileHandler(ctx *gin.Context) {
 		"message": "Successfully archived file"})
 }
 
+// API handler used to restore an archived file
+func UnarchiveFileHandler(ctx *gin.Context) {
+	log.Info("received request to unarchive file")
+	fileId, err := uuid.Parse(ctx.Param("fileId"))
+	if err != nil {
+		log.Error(fmt.Errorf("received invalid file ID %s", ctx.Param("fileId")))
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"http_code": http.StatusBadRequest,
+			"message": "Invalid file ID"})
+		return
+	}
+
+	if err := persistence.UnarchiveFile(fileId); err != nil {
+		log.Error(fmt.Errorf("unable to unarchive file: %+v", err))
+		switch err {
+		case ErrFileNotFound:
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"http_code": http.StatusNotFound,
+				"message": "Cannot find archived file"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"message": "Successfully unarchived file"})
+}
+
+// API handler used to search files by metadata. search conditions
+// are combined according to the requested mode, and equality search
+// terms are supported for compatibility with earlier clients
 func SearchFilesHandler(ctx *gin.Context) {
 	log.Info("received request for search")
 	var request struct {
 		SearchTerms map[string]interface{} `json:"search_terms"`
+		Conditions  []SearchCondition      `json:"conditions"`
+		Mode        string                 `json:"mode"`
+		Limit       int                    `json:"limit"`
+		Cursor      string                 `json:"cursor"`
 	}
 	if err := ctx.ShouldBind(&request); err != nil {
 		log.Error(fmt.Errorf("received invalid request body: %+v", err))
@@ -283,11 +489,49 @@ func SearchFilesHandler(ctx *gin.Context) {
 			"message": "Invalid search request"})
 		return
 	}
+
+	query := SearchQuery{Conditions: request.Conditions, Limit: request.Limit}
+	for key, value := range request.SearchTerms {
+		query.Conditions = append(query.Conditions, SearchCondition{Path: key, Op: OpEq,
+			Value: value})
+	}
+	mode, err := ParseSearchType(request.Mode)
+	if err != nil {
+		log.Error(fmt.Errorf("received invalid search mode %s", request.Mode))
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"http_code": http.StatusBadRequest,
+			"message": "Invalid search mode"})
+		return
+	}
+	query.Mode = mode
+
+	if query.Limit == 0 {
+		query.Limit = DefaultPageSize
+	}
+	if query.Limit < 1 || query.Limit > MaxPageSize {
+		log.Error(fmt.Errorf("received invalid page size %d", query.Limit))
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"http_code": http.StatusBadRequest,
+			"message": "Invalid page size"})
+		return
+	}
+	if len(request.Cursor) > 0 {
+		cursor, err := DecodeFileCursor(request.Cursor)
+		if err != nil {
+			log.Error(fmt.Errorf("received invalid cursor: %+v", err))
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"http_code": http.StatusBadRequest,
+				"message": "Invalid cursor"})
+			return
+		}
+		query.Cursor = &cursor
+	}
+
 	// search files by metadata
-	results, err := persistence.SearchFilesByMetadata(request.SearchTerms)
+	page, err := persistence.SearchFilesByMetadata(query)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to search files: %+v", err))
 		switch err {
+		case ErrInvalidSearch:
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"http_code": http.StatusBadRequest,
+				"message": "Invalid search conditions"})
 		case ErrFeatureNotSupported:
 			ctx.AbortWithStatusJSON(http.StatusNotImplemented, gin.H{"http_code": http.StatusNotImplemented,
 				"message": "Searching not supported"})
@@ -299,5 +543,5 @@ func SearchFilesHandler(ctx *gin.Context) {
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
-		"results": results})
+		"results": page.Files, "total": page.Total, "next_cursor": page.NextCursor})
 }
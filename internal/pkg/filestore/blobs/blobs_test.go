@@ -0,0 +1,307 @@
+package filestore
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/filestore"
+)
+
+// define in-memory stand-in for an S3 compatible object store. only
+// the path style requests sent by S3BlobStore are supported
+type s3Stub struct {
+	bucket    string
+	accessKey string
+	// maximum number of objects returned per list request
+	pageSize int
+
+	lock     sync.Mutex
+	objects  map[string][]byte
+	requests []string
+}
+
+func newS3Stub(bucket, accessKey string) *s3Stub {
+	return &s3Stub{bucket: bucket, accessKey: accessKey, pageSize: 2,
+		objects: map[string][]byte{}}
+}
+
+func (s *s3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	credential := fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/", s.accessKey)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), credential) ||
+		len(r.Header.Get("X-Amz-Date")) == 0 {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+	prefix := "/" + s.bucket
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	// keys starting with "error" simulate internal failures of the store
+	if strings.HasPrefix(key, "error") {
+		http.Error(w, "<Error><Code>InternalError</Code></Error>", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case len(key) == 0 && r.Method == "GET":
+		s.list(w, r)
+	case r.Method == "PUT":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil || int64(len(body)) != r.ContentLength {
+			http.Error(w, "<Error><Code>IncompleteBody</Code></Error>", http.StatusBadRequest)
+			return
+		}
+		s.objects[key] = body
+	case r.Method == "HEAD":
+		body, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	case r.Method == "GET":
+		body, ok := s.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		start := 0
+		if value := r.Header.Get("Range"); len(value) > 0 {
+			start, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(value, "bytes="), "-"))
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start,
+				len(body)-1, len(body)))
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		w.Write(body[start:])
+	case r.Method == "DELETE":
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// function used to list objects in pages using continuation tokens
+func (s *s3Stub) list(w http.ResponseWriter, r *http.Request) {
+	keys := []string{}
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	start, _ := strconv.Atoi(r.URL.Query().Get("continuation-token"))
+
+	type object struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         int64     `xml:"Size"`
+	}
+	var result struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		IsTruncated           bool     `xml:"IsTruncated"`
+		NextContinuationToken string   `xml:"NextContinuationToken,omitempty"`
+		Contents              []object `xml:"Contents"`
+	}
+	end := start + s.pageSize
+	if end < len(keys) {
+		result.IsTruncated, result.NextContinuationToken = true, strconv.Itoa(end)
+	} else {
+		end = len(keys)
+	}
+	for _, key := range keys[start:end] {
+		result.Contents = append(result.Contents, object{Key: key,
+			LastModified: time.Now().UTC(), Size: int64(len(s.objects[key]))})
+	}
+	xml.NewEncoder(w).Encode(result)
+}
+
+func newTestS3Store(t *testing.T) (*S3BlobStore, *s3Stub) {
+	stub := newS3Stub("blobs", "access")
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return &S3BlobStore{Endpoint: server.URL, Bucket: "blobs", Region: "us-east-1",
+		AccessKey: "access", SecretKey: "secret", Client: server.Client()}, stub
+}
+
+func newTestLocalStore(t *testing.T) *LocalBlobStore {
+	base := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(base, "tmp"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	return &LocalBlobStore{BasePath: base}
+}
+
+func readBlob(t *testing.T, store filestore.BlobStore, key string) []byte {
+	t.Helper()
+	blob, err := store.Get(key)
+	if err != nil {
+		t.Fatalf("unable to get blob %s: %+v", key, err)
+	}
+	defer blob.Close()
+	body, err := ioutil.ReadAll(blob)
+	if err != nil {
+		t.Fatalf("unable to read blob %s: %+v", key, err)
+	}
+	return body
+}
+
+func listKeys(t *testing.T, store filestore.BlobStore) map[string]int64 {
+	t.Helper()
+	blobs, err := store.List()
+	if err != nil {
+		t.Fatalf("unable to list blobs: %+v", err)
+	}
+	keys := map[string]int64{}
+	for _, b := range blobs {
+		keys[b.Key] = b.Size
+	}
+	return keys
+}
+
+// test suite run against every blob store implementation to ensure
+// that all implementations behave the same
+func TestBlobStoreConformance(t *testing.T) {
+	stores := map[string]func(t *testing.T) filestore.BlobStore{
+		"local":  func(t *testing.T) filestore.BlobStore { return newTestLocalStore(t) },
+		"memory": func(t *testing.T) filestore.BlobStore { return NewMemoryBlobStore() },
+		"s3": func(t *testing.T) filestore.BlobStore {
+			store, _ := newTestS3Store(t)
+			return store
+		},
+	}
+	content := []byte("0123456789abcdefghij")
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			if _, err := store.Get("a1b2c3d4"); err != filestore.ErrBlobNotFound {
+				t.Fatalf("expected missing blob to return ErrBlobNotFound, got %v", err)
+			}
+
+			for _, key := range []string{"a1b2c3d4", "e5f6a7b8", "c9d0e1f2"} {
+				if err := store.Put(key, bytes.NewReader(content)); err != nil {
+					t.Fatalf("unable to put blob: %+v", err)
+				}
+			}
+			if body := readBlob(t, store, "a1b2c3d4"); !bytes.Equal(body, content) {
+				t.Errorf("expected blob contents %q, got %q", content, body)
+			}
+			keys := listKeys(t, store)
+			if len(keys) != 3 || keys["a1b2c3d4"] != int64(len(content)) {
+				t.Errorf("expected three listed blobs, got %v", keys)
+			}
+
+			// blobs can be seeked without reading preceding contents
+			blob, err := store.Get("a1b2c3d4")
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 4)
+			if _, err := blob.Seek(10, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.ReadFull(blob, buf); err != nil || string(buf) != "abcd" {
+				t.Errorf("expected to read abcd at offset 10, got %q (%v)", buf, err)
+			}
+			if _, err := blob.Seek(-2, io.SeekEnd); err != nil {
+				t.Fatal(err)
+			}
+			if rest, err := ioutil.ReadAll(blob); err != nil || string(rest) != "ij" {
+				t.Errorf("expected to read ij at end of blob, got %q (%v)", rest, err)
+			}
+			blob.Close()
+
+			// quarantined blobs are no longer returned or listed
+			if err := store.Quarantine("e5f6a7b8"); err != nil {
+				t.Fatalf("unable to quarantine blob: %+v", err)
+			}
+			if _, err := store.Get("e5f6a7b8"); err != filestore.ErrBlobNotFound {
+				t.Errorf("expected quarantined blob to be missing, got %v", err)
+			}
+			if _, ok := listKeys(t, store)["e5f6a7b8"]; ok {
+				t.Errorf("expected quarantined blob to be excluded from listing")
+			}
+			if err := store.Quarantine("e5f6a7b8"); err != filestore.ErrBlobNotFound {
+				t.Errorf("expected quarantining missing blob to fail, got %v", err)
+			}
+
+			// deleting blobs is idempotent
+			for i := 0; i < 2; i++ {
+				if err := store.Delete("a1b2c3d4"); err != nil {
+					t.Fatalf("unable to delete blob: %+v", err)
+				}
+			}
+			if _, err := store.Get("a1b2c3d4"); err != filestore.ErrBlobNotFound {
+				t.Errorf("expected deleted blob to be missing, got %v", err)
+			}
+			if keys := listKeys(t, store); len(keys) != 1 || keys["c9d0e1f2"] == 0 {
+				t.Errorf("expected single remaining blob, got %v", keys)
+			}
+		})
+	}
+}
+
+func TestS3BlobStoreRequests(t *testing.T) {
+	store, stub := newTestS3Store(t)
+	if err := store.Put("key", strings.NewReader("content")); err != nil {
+		t.Fatalf("unable to put blob: %+v", err)
+	}
+	if err := store.Quarantine("key"); err != nil {
+		t.Fatalf("unable to quarantine blob: %+v", err)
+	}
+	// quarantined objects are copied under the quarantine prefix
+	if body, ok := stub.objects[s3QuarantinePrefix+"key"]; !ok || string(body) != "content" {
+		t.Errorf("expected quarantined object, got %q", body)
+	}
+	expected := []string{"PUT /blobs/key", "HEAD /blobs/key", "GET /blobs/key",
+		"PUT /blobs/quarantine/key", "DELETE /blobs/key"}
+	if strings.Join(stub.requests, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected requests %v, got %v", expected, stub.requests)
+	}
+}
+
+func TestS3BlobStoreErrors(t *testing.T) {
+	store, _ := newTestS3Store(t)
+	if err := store.Put("error-key", strings.NewReader("content")); err != ErrS3RequestFailed {
+		t.Errorf("expected failed put to return ErrS3RequestFailed, got %v", err)
+	}
+	if _, err := store.Get("error-key"); err != ErrS3RequestFailed {
+		t.Errorf("expected failed get to return ErrS3RequestFailed, got %v", err)
+	}
+	if err := store.Delete("error-key"); err != ErrS3RequestFailed {
+		t.Errorf("expected failed delete to return ErrS3RequestFailed, got %v", err)
+	}
+
+	// requests with invalid credentials are rejected by the store
+	store.AccessKey = "other"
+	if _, err := store.Get("key"); err != ErrS3RequestFailed {
+		t.Errorf("expected rejected get to return ErrS3RequestFailed, got %v", err)
+	}
+	if _, err := store.List(); err != ErrS3RequestFailed {
+		t.Errorf("expected rejected list to return ErrS3RequestFailed, got %v", err)
+	}
+
+	// unreachable stores return the underlying client error
+	store.Endpoint = "http://127.0.0.1:1"
+	if _, err := store.Get("key"); err == nil || err == ErrS3RequestFailed {
+		t.Errorf("expected connection error, got %v", err)
+	}
+}
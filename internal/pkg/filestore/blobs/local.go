@@ -0,0 +1,141 @@
+package filestore
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/filestore"
+)
+
+// define blob store used to store blobs on local disk. blobs are
+// sharded into nested directories using the first characters of
+// their key, which keeps directory sizes manageable for large stores
+type LocalBlobStore struct {
+	BasePath string
+}
+
+// function used to generate the path of a blob on disk
+func (s *LocalBlobStore) path(key string) string {
+	if len(key) < 4 {
+		return filepath.Join(s.BasePath, key)
+	}
+	return filepath.Join(s.BasePath, key[0:2], key[2:4], key)
+}
+
+// function used to generate the paths of blobs stored in the
+// flat directory layout used before blobs were sharded
+func (s *LocalBlobStore) legacyPaths(key string) []string {
+	return []string{
+		filepath.Join(s.BasePath, key),
+		filepath.Join(s.BasePath, "archive", key),
+	}
+}
+
+// function used to write a blob to disk. blobs are written to
+// a temporary file and moved into place once complete so that
+// partially written blobs are never visible
+func (s *LocalBlobStore) Put(key string, content io.Reader) error {
+	log.Debug(fmt.Sprintf("writing blob %s to local storage...", key))
+	f, err := ioutil.TempFile(filepath.Join(s.BasePath, "tmp"), "blob-")
+	if err != nil {
+		log.Error(fmt.Errorf("unable to create temporary file: %+v", err))
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	target := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), target)
+}
+
+// function used to open a blob stored on disk
+func (s *LocalBlobStore) Get(key string) (filestore.Blob, error) {
+	for _, path := range append([]string{s.path(key)}, s.legacyPaths(key)...) {
+		f, err := os.Open(path)
+		if err == nil {
+			return f, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, filestore.ErrBlobNotFound
+}
+
+// function used to delete a blob from disk
+func (s *LocalBlobStore) Delete(key string) error {
+	log.Debug(fmt.Sprintf("deleting blob %s from local storage...", key))
+	for _, path := range append([]string{s.path(key)}, s.legacyPaths(key)...) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// function used to list all blobs stored on disk, including blobs
+// stored in the legacy flat and archive directories. temporary
+// files and quarantined blobs are excluded
+func (s *LocalBlobStore) List() ([]filestore.BlobInfo, error) {
+	blobs := []filestore.BlobInfo{}
+	excluded := map[string]bool{
+		filepath.Join(s.BasePath, "tmp"):        true,
+		filepath.Join(s.BasePath, "quarantine"): true,
+	}
+	err := filepath.Walk(s.BasePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if excluded[path] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		blobs = append(blobs, filestore.BlobInfo{Key: info.Name(), Size: info.Size(),
+			Modified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		log.Error(fmt.Errorf("unable to list blobs in local storage: %+v", err))
+	}
+	return blobs, err
+}
+
+// function used to move a blob into the quarantine directory
+func (s *LocalBlobStore) Quarantine(key string) error {
+	log.Info(fmt.Sprintf("quarantining blob %s in local storage...", key))
+	target := filepath.Join(s.BasePath, "quarantine", key)
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	for _, path := range append([]string{s.path(key)}, s.legacyPaths(key)...) {
+		err := os.Rename(path, target)
+		if err == nil {
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return filestore.ErrBlobNotFound
+}
@@ -0,0 +1,99 @@
+package filestore
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/filestore"
+)
+
+// define blob store used to store blobs in memory. the store is
+// intended for development and testing, and all blobs are lost
+// when the service is restarted
+type MemoryBlobStore struct {
+	blobs       map[string]memoryEntry
+	quarantined map[string]memoryEntry
+	lock        sync.RWMutex
+}
+
+// define struct used to store a single blob in memory
+type memoryEntry struct {
+	body     []byte
+	modified time.Time
+}
+
+// define blob used to read blobs stored in memory
+type memoryBlob struct {
+	*bytes.Reader
+}
+
+func (b memoryBlob) Close() error {
+	return nil
+}
+
+// function used to generate new in-memory blob store
+func NewMemoryBlobStore() *MemoryBlobStore {
+	return &MemoryBlobStore{
+		blobs:       map[string]memoryEntry{},
+		quarantined: map[string]memoryEntry{},
+	}
+}
+
+// function used to store a blob in memory
+func (s *MemoryBlobStore) Put(key string, content io.Reader) error {
+	body, err := ioutil.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.blobs[key] = memoryEntry{body: body, modified: time.Now()}
+	return nil
+}
+
+// function used to retrieve a blob from memory
+func (s *MemoryBlobStore) Get(key string) (filestore.Blob, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	entry, ok := s.blobs[key]
+	if !ok {
+		return nil, filestore.ErrBlobNotFound
+	}
+	return memoryBlob{bytes.NewReader(entry.body)}, nil
+}
+
+// function used to delete a blob from memory
+func (s *MemoryBlobStore) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
+
+// function used to list all blobs stored in memory
+func (s *MemoryBlobStore) List() ([]filestore.BlobInfo, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	blobs := []filestore.BlobInfo{}
+	for key, entry := range s.blobs {
+		blobs = append(blobs, filestore.BlobInfo{Key: key, Size: int64(len(entry.body)),
+			Modified: entry.modified})
+	}
+	return blobs, nil
+}
+
+// function used to move a blob into quarantine
+func (s *MemoryBlobStore) Quarantine(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	entry, ok := s.blobs[key]
+	if !ok {
+		return filestore.ErrBlobNotFound
+	}
+	s.quarantined[key] = entry
+	delete(s.blobs, key)
+	return nil
+}
@@ -0,0 +1,351 @@
+package filestore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/filestore"
+)
+
+var ErrS3RequestFailed = errors.New("received invalid response from S3 API")
+
+// define prefix of keys used to store quarantined blobs
+const s3QuarantinePrefix = "quarantine/"
+
+// define blob store used to store blobs in an S3 compatible object
+// store. requests are signed with AWS signature version 4 and use
+// path style addressing, which is supported by both AWS S3 and
+// self-hosted stores such as MinIO
+type S3BlobStore struct {
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+
+	Client *http.Client
+}
+
+// function used to store a blob in the object store. S3 requires the
+// content length of uploaded objects to be known in advance, so the
+// stream is first spooled to a temporary file
+func (s *S3BlobStore) Put(key string, content io.Reader) error {
+	log.Debug(fmt.Sprintf("writing blob %s to S3 storage...", key))
+	f, err := ioutil.TempFile("", "filestore-blob-")
+	if err != nil {
+		log.Error(fmt.Errorf("unable to create temporary file: %+v", err))
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	size, err := io.Copy(f, content)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	request, err := s.newRequest("PUT", key, f)
+	if err != nil {
+		return err
+	}
+	request.ContentLength = size
+	response, err := s.do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return s.responseError(response)
+	}
+	return nil
+}
+
+// function used to retrieve a blob from the object store. the size
+// of the object is retrieved when the blob is opened, and contents
+// are only downloaded once the blob is read
+func (s *S3BlobStore) Get(key string) (filestore.Blob, error) {
+	request, err := s.newRequest("HEAD", key, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		return &s3Object{store: s, key: key, size: response.ContentLength}, nil
+	case http.StatusNotFound:
+		return nil, filestore.ErrBlobNotFound
+	default:
+		return nil, s.responseError(response)
+	}
+}
+
+// define blob used to read objects from the object store. reads are
+// served by a ranged request starting at the current offset, which
+// allows the object to be seeked without downloading its contents
+type s3Object struct {
+	store  *S3BlobStore
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		request, err := o.store.newRequest("GET", o.key, nil)
+		if err != nil {
+			return 0, err
+		}
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", o.offset))
+		response, err := o.store.do(request)
+		if err != nil {
+			return 0, err
+		}
+		// stores that ignore the range header return the entire object,
+		// which can only be used if reading from the start of the object
+		if response.StatusCode != http.StatusPartialContent &&
+			!(response.StatusCode == http.StatusOK && o.offset == 0) {
+			defer response.Body.Close()
+			return 0, o.store.responseError(response)
+		}
+		o.body = response.Body
+	}
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	}
+	if offset < 0 {
+		return o.offset, errors.New("cannot seek to negative offset")
+	}
+	// discard current response if seeking to different offset
+	if offset != o.offset && o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+	o.offset = offset
+	return offset, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body != nil {
+		return o.body.Close()
+	}
+	return nil
+}
+
+// function used to delete a blob from the object store
+func (s *S3BlobStore) Delete(key string) error {
+	log.Debug(fmt.Sprintf("deleting blob %s from S3 storage...", key))
+	request, err := s.newRequest("DELETE", key, nil)
+	if err != nil {
+		return err
+	}
+	response, err := s.do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	default:
+		return s.responseError(response)
+	}
+}
+
+// define struct used to parse responses from the ListObjectsV2 API
+type s3ListResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+}
+
+// function used to list all blobs in the bucket. objects are listed
+// in pages, and quarantined blobs are excluded
+func (s *S3BlobStore) List() ([]filestore.BlobInfo, error) {
+	blobs := []filestore.BlobInfo{}
+	token := ""
+	for {
+		request, err := s.newRequest("GET", "", nil)
+		if err != nil {
+			return blobs, err
+		}
+		params := url.Values{"list-type": []string{"2"}}
+		if len(token) > 0 {
+			params.Set("continuation-token", token)
+		}
+		request.URL.RawQuery = params.Encode()
+
+		response, err := s.do(request)
+		if err != nil {
+			return blobs, err
+		}
+		if response.StatusCode != http.StatusOK {
+			defer response.Body.Close()
+			return blobs, s.responseError(response)
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+		if err != nil {
+			log.Error(fmt.Errorf("unable to parse S3 list response: %+v", err))
+			return blobs, ErrS3RequestFailed
+		}
+
+		for _, object := range result.Contents {
+			if strings.HasPrefix(object.Key, s3QuarantinePrefix) {
+				continue
+			}
+			blobs = append(blobs, filestore.BlobInfo{Key: object.Key, Size: object.Size,
+				Modified: object.LastModified})
+		}
+		if !result.IsTruncated {
+			return blobs, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// function used to move a blob into quarantine. S3 has no rename
+// operation, so the blob is copied under the quarantine prefix
+// before the original is deleted
+func (s *S3BlobStore) Quarantine(key string) error {
+	log.Info(fmt.Sprintf("quarantining blob %s in S3 storage...", key))
+	blob, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	if err := s.Put(s3QuarantinePrefix+key, blob); err != nil {
+		return err
+	}
+	return s.Delete(key)
+}
+
+// function used to log the body of a failed response
+func (s *S3BlobStore) responseError(response *http.Response) error {
+	body, _ := ioutil.ReadAll(response.Body)
+	log.Error(fmt.Sprintf("received invalid S3 response with code %d: %s",
+		response.StatusCode, string(body)))
+	return ErrS3RequestFailed
+}
+
+// function used to generate new request for an object. requests
+// with an empty key address the bucket itself
+func (s *S3BlobStore) newRequest(method, key string, body io.Reader) (*http.Request, error) {
+	path := fmt.Sprintf("/%s", s.Bucket)
+	if len(key) > 0 {
+		path = fmt.Sprintf("%s/%s", path, key)
+	}
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/"))
+	if err != nil {
+		log.Error(fmt.Errorf("received invalid S3 endpoint %s: %+v", s.Endpoint, err))
+		return nil, err
+	}
+	u.Path = u.Path + path
+
+	request, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to generate HTTP request: %+v", err))
+		return nil, err
+	}
+	return request, nil
+}
+
+// function used to sign and execute a request
+func (s *S3BlobStore) do(request *http.Request) (*http.Response, error) {
+	s.sign(request, time.Now().UTC())
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to execute S3 request: %+v", err))
+		return nil, err
+	}
+	return response, nil
+}
+
+// function used to sign a request using AWS signature version 4.
+// payloads are not included in the signature, which allows object
+// contents to be streamed without hashing them in advance
+func (s *S3BlobStore) sign(request *http.Request, now time.Time) {
+	const payloadHash = "UNSIGNED-PAYLOAD"
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n",
+		request.URL.Host, payloadHash, amzDate)
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.Query().Encode(),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.Region)
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(hashed[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
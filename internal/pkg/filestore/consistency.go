@@ -0,0 +1,188 @@
+package filestore
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// define struct used to report the result of a consistency check
+// between the metadata store and the blob store
+type ConsistencyReport struct {
+	Generated  time.Time `json:"generated"`
+	Repaired   bool      `json:"repaired"`
+	References int       `json:"references"`
+	Blobs      int       `json:"blobs"`
+	// blobs that are not referenced by any file version
+	OrphanBlobs []BlobInfo `json:"orphan_blobs"`
+	// file versions referencing blobs that do not exist
+	MissingBlobs []BlobReference `json:"missing_blobs"`
+	BrokenFiles  []uuid.UUID     `json:"broken_files"`
+	Quarantined  int             `json:"quarantined"`
+}
+
+// function used to check the consistency of the metadata store and
+// the blob store. blobs are written before the metadata referencing
+// them, so only blobs last modified before the given time are treated
+// as orphans to avoid reporting uploads that are still in progress.
+// if repair is set, orphan blobs are quarantined and files referencing
+// missing blobs are marked as broken
+func (s *Store) CheckConsistency(orphanedBefore time.Time,
+	repair bool) (ConsistencyReport, error) {
+	log.Debug(fmt.Sprintf("checking consistency of file storage with repair=%t", repair))
+	report := ConsistencyReport{Generated: time.Now().UTC(), Repaired: repair,
+		OrphanBlobs: []BlobInfo{}, MissingBlobs: []BlobReference{}, BrokenFiles: []uuid.UUID{}}
+
+	// references are listed before blobs so that files created during
+	// the check are never reported as referencing missing blobs
+	references, err := s.Metadata.ListBlobReferences()
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve blob references: %+v", err))
+		return report, err
+	}
+	blobs, err := s.Blobs.List()
+	if err != nil {
+		log.Error(fmt.Errorf("unable to list blobs: %+v", err))
+		return report, err
+	}
+	report.References, report.Blobs = len(references), len(blobs)
+
+	referenced := map[string]bool{}
+	for _, r := range references {
+		referenced[r.BlobKey] = true
+	}
+	stored := map[string]bool{}
+	for _, b := range blobs {
+		stored[b.Key] = true
+		if !referenced[b.Key] && b.Modified.Before(orphanedBefore) {
+			report.OrphanBlobs = append(report.OrphanBlobs, b)
+		}
+	}
+
+	broken := map[uuid.UUID]bool{}
+	for _, r := range references {
+		if stored[r.BlobKey] || !s.blobMissing(r.BlobKey) {
+			continue
+		}
+		report.MissingBlobs = append(report.MissingBlobs, r)
+		if !broken[r.FileId] {
+			broken[r.FileId] = true
+			report.BrokenFiles = append(report.BrokenFiles, r.FileId)
+		}
+	}
+
+	if !repair {
+		return report, nil
+	}
+	for _, b := range report.OrphanBlobs {
+		if err := s.Blobs.Quarantine(b.Key); err != nil {
+			log.Error(fmt.Errorf("unable to quarantine blob %s: %+v", b.Key, err))
+			continue
+		}
+		report.Quarantined++
+	}
+	if err := s.Metadata.MarkBrokenFiles(report.BrokenFiles); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// function used to confirm that a blob is missing from the blob store.
+// blobs deleted or written while the check is running may be absent
+// from the listing, so blobs are only reported as missing if they
+// cannot be opened
+func (s *Store) blobMissing(key string) bool {
+	blob, err := s.Blobs.Get(key)
+	if err != nil {
+		if err != ErrBlobNotFound {
+			log.Error(fmt.Errorf("unable to open blob %s: %+v", key, err))
+		}
+		return err == ErrBlobNotFound
+	}
+	blob.Close()
+	return false
+}
+
+type ConsistencyChecker struct {
+	Persistence FileStorePersistence
+	Interval    time.Duration
+	// minimum age of unreferenced blobs before they are treated as orphans
+	GracePeriod time.Duration
+	Repair      bool
+
+	stop chan struct{}
+}
+
+// function used to start the consistency checker. the checker
+// periodically compares the metadata store with the blob store
+// and optionally repairs any inconsistencies found
+func (c *ConsistencyChecker) Start() {
+	log.Info(fmt.Sprintf("starting consistency checker with interval %s and repair=%t",
+		c.Interval, c.Repair))
+	c.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(c.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.Run()
+			case <-c.stop:
+				log.Info("stopping consistency checker")
+				return
+			}
+		}
+	}()
+}
+
+// function used to stop a running consistency checker
+func (c *ConsistencyChecker) Stop() {
+	if c.stop != nil {
+		close(c.stop)
+	}
+}
+
+// function used to execute a single consistency check
+func (c *ConsistencyChecker) Run() {
+	report, err := c.Persistence.CheckConsistency(time.Now().Add(-c.GracePeriod), c.Repair)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to check file storage consistency: %+v", err))
+		return
+	}
+	if len(report.OrphanBlobs) > 0 || len(report.MissingBlobs) > 0 {
+		log.Warn(fmt.Sprintf("found %d orphan blob(s) and %d missing blob(s), quarantined %d",
+			len(report.OrphanBlobs), len(report.MissingBlobs), report.Quarantined))
+	}
+}
+
+// API handler used to check the consistency of file storage. the
+// check only reports inconsistencies and does not modify any files
+func ConsistencyReportHandler(ctx *gin.Context) {
+	log.Info("received request to check file storage consistency")
+	checkConsistency(ctx, false)
+}
+
+// API handler used to check the consistency of file storage and
+// repair any inconsistencies found
+func RepairConsistencyHandler(ctx *gin.Context) {
+	log.Info("received request to repair file storage consistency")
+	checkConsistency(ctx, true)
+}
+
+// function used to run a consistency check and return the report
+func checkConsistency(ctx *gin.Context, repair bool) {
+	orphanedBefore := time.Now().Add(-serviceConfig.OrphanGracePeriod)
+	report, err := persistence.CheckConsistency(orphanedBefore, repair)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to check file storage consistency: %+v", err))
+		status := http.StatusInternalServerError
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Internal server error"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK, "report": report})
+}
@@ -2,6 +2,7 @@ package filestore
 
 import (
 	"errors"
+	"io"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,6 +14,9 @@ var (
 	ErrPermissionDenied    = errors.New("permission denied when trying to access file")
 	ErrCannotDeleteFile    = errors.New("cannot delete specified file")
 	ErrFeatureNotSupported = errors.New("selectd feature currently not supported")
+	ErrFileTooLarge        = errors.New("file exceeds maximum upload size")
+	ErrVersionNotFound     = errors.New("cannot find specified file version")
+	ErrBlobNotFound        = errors.New("cannot find specified blob")
 )
 
 var persistence FileStorePersistence
@@ -23,19 +27,105 @@ func SetFilePersistence(p FileStorePersistence) {
 	persistence = p
 }
 
-// define interface for persistence file data. note
-// that the files themselves are stored on disk: it
-// is merely the file information that is stored in
-// a separate persistence layer
+// define interface for persistence file data. the interface
+// is implemented by the Store type, which stores file metadata
+// and file contents in separate persistence layers
 type FileStorePersistence interface {
-	ListFiles() ([]FileMetadata, error)
+	// lists either unarchived or archived files
+	ListFiles(archived bool) ([]FileMetadata, error)
 	GetFileMetadata(fileId uuid.UUID) (FileMetadata, error)
-	GetFileContents(meta FileMetadata) ([]byte, error)
-	CreateFile(contents []byte, fileName string, meta map[string]interface{}) (uuid.UUID, error)
-	ModifyFile(meta FileMetadata, contents []byte) error
+	// opens the contents of a file version. the caller is
+	// responsible for closing the returned blob
+	GetFileContents(version FileVersion) (Blob, error)
+	CreateFile(contents []byte, fileName string, meta map[string]interface{},
+		creator string) (uuid.UUID, error)
+	CreateFileFromStream(content io.Reader, fileName string, meta map[string]interface{},
+		maxSize int64, creator string) (FileUploadResult, error)
+	// modifying a file stores the new contents as a new version. previous
+	// versions are immutable and can be retrieved or restored
+	ModifyFile(meta FileMetadata, content io.Reader, maxSize int64,
+		creator string) (FileVersion, error)
+	ListFileVersions(fileId uuid.UUID) ([]FileVersion, error)
+	GetFileVersion(fileId uuid.UUID, version int) (FileVersion, error)
+	RestoreFileVersion(meta FileMetadata, version int, creator string) (FileVersion, error)
 	DeleteFile(meta FileMetadata) error
 	ArchiveFile(meta FileMetadata) error
-	SearchFilesByMetadata(terms map[string]interface{}) ([]FileMetadata, error)
+	// archived files are hidden from GetFileMetadata, so
+	// unarchived files are addressed by their file ID
+	UnarchiveFile(fileId uuid.UUID) error
+	SearchFilesByMetadata(query SearchQuery) (FilePage, error)
+	// compares file metadata with stored blobs, optionally repairing
+	// any inconsistencies found
+	CheckConsistency(orphanedBefore time.Time, repair bool) (ConsistencyReport, error)
+}
+
+// define interface for storage of file metadata. the metadata
+// store records the blob key of each file version but never
+// accesses the file contents themselves
+type MetadataStore interface {
+	ListFiles(archived bool) ([]FileMetadata, error)
+	GetFileMetadata(fileId uuid.UUID) (FileMetadata, error)
+	// creates the metadata and first version of a new file. blobs are
+	// reference counted by checksum, and the returned version references
+	// an existing blob if one with the same checksum has been stored
+	CreateFile(meta FileMetadata, version FileVersion) (FileVersion, error)
+	// appends a new version to a file. the version number is
+	// assigned by the store and returned with the version
+	CreateFileVersion(fileId uuid.UUID, version FileVersion) (FileVersion, error)
+	ListFileVersions(fileId uuid.UUID) ([]FileVersion, error)
+	GetFileVersion(fileId uuid.UUID, version int) (FileVersion, error)
+	// deletes a file and all of its versions, returning the keys of
+	// all blobs that are no longer referenced
+	DeleteFile(fileId uuid.UUID) ([]string, error)
+	ArchiveFile(fileId uuid.UUID) error
+	// returns ErrFileNotFound if the file does not exist or is not archived
+	UnarchiveFile(fileId uuid.UUID) error
+	// returns a page of unarchived files matching a search query
+	SearchFiles(query SearchQuery) (FilePage, error)
+	// lists the blobs referenced by all versions of all files
+	ListBlobReferences() ([]BlobReference, error)
+	// marks the given files as broken and clears the
+	// flag on all other files
+	MarkBrokenFiles(fileIds []uuid.UUID) error
+}
+
+// define interface for storage of file contents. blobs are
+// immutable and are addressed by a unique key
+type BlobStore interface {
+	Put(key string, content io.Reader) error
+	// returns ErrBlobNotFound if no blob exists with the given key
+	Get(key string) (Blob, error)
+	// deleting a blob that does not exist is not an error
+	Delete(key string) error
+	// lists all blobs in the store, excluding quarantined blobs
+	List() ([]BlobInfo, error)
+	// moves a blob out of the store into a separate quarantine area,
+	// from which it can be inspected and restored manually
+	Quarantine(key string) error
+}
+
+// define struct used to store a reference from a file version
+// to the blob containing its contents
+type BlobReference struct {
+	FileId  uuid.UUID `json:"file_id"`
+	Version int       `json:"version"`
+	BlobKey string    `json:"blob_key"`
+}
+
+// define struct used to store details of a stored blob
+type BlobInfo struct {
+	Key      string    `json:"key"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// define interface for blobs opened from a blob store. blobs
+// are seekable so that partial contents can be served without
+// reading the entire blob
+type Blob interface {
+	io.Reader
+	io.Seeker
+	io.Closer
 }
 
 type FileMetadata struct {
@@ -44,4 +134,32 @@ type FileMetadata struct {
 	Created  time.Time              `json:"created" validate:"required"`
 	Size     int                    `json:"size" validate:"required"`
 	Meta     map[string]interface{} `json:"meta" validate:"required"`
+	Version  int                    `json:"version"`
+	// SHA-256 checksum of the current version
+	Checksum string `json:"checksum"`
+	// time at which the file was archived. files archived before
+	// archive times were recorded have no archive time
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+	// set by the consistency checker if the contents of any
+	// version of the file are missing from the blob store
+	Broken bool `json:"broken"`
+}
+
+// define struct used to store details of a single file version
+type FileVersion struct {
+	FileId   uuid.UUID `json:"file_id"`
+	Version  int       `json:"version"`
+	Size     int64     `json:"size"`
+	Checksum string    `json:"checksum"`
+	Creator  string    `json:"creator"`
+	Created  time.Time `json:"created"`
+	// key of blob containing the version contents
+	BlobKey string `json:"-"`
+}
+
+// define struct used to return details of uploaded files
+type FileUploadResult struct {
+	FileId   uuid.UUID `json:"file_id"`
+	Size     int64     `json:"size"`
+	Checksum string    `json:"checksum"`
 }
@@ -0,0 +1,73 @@
+package filestore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/filestore"
+)
+
+// function used to acquire a reference to the blob containing the
+// contents of a file version. blobs are identified by their checksum,
+// so if a blob with the same checksum already exists its key is
+// returned and the newly written blob is no longer referenced.
+// versions without checksums were created before deduplication was
+// introduced and are not reference counted
+func acquireBlob(ctx context.Context, tx pgx.Tx, v filestore.FileVersion) (string, error) {
+	if len(v.Checksum) == 0 {
+		return v.BlobKey, nil
+	}
+	var key string
+	// versions written before deduplication that reference the blob are
+	// counted when the blob is first registered
+	query := `INSERT INTO blobs(checksum,blob_key,size,ref_count) VALUES($1,$2,$3,
+		1 + (SELECT COUNT(*) FROM file_versions WHERE checksum=$1 AND blob_key=$2))
+	ON CONFLICT (checksum) DO UPDATE SET ref_count = blobs.ref_count + 1
+	RETURNING blob_key`
+	if err := tx.QueryRow(ctx, query, v.Checksum, v.BlobKey, v.Size).Scan(&key); err != nil {
+		log.Error(fmt.Errorf("unable to acquire blob reference: %+v", err))
+		return key, err
+	}
+	return key, nil
+}
+
+// function used to release the references held by a list of file
+// versions. the keys of all blobs that are no longer referenced by
+// any version are returned so that they can be deleted
+func releaseBlobs(ctx context.Context, tx pgx.Tx, versions []filestore.FileVersion) (
+	[]string, error) {
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, v := range versions {
+		unreferenced := true
+		if len(v.Checksum) > 0 {
+			var refs int
+			query := `UPDATE blobs SET ref_count = ref_count - 1
+			WHERE checksum=$1 AND blob_key=$2 RETURNING ref_count`
+			err := tx.QueryRow(ctx, query, v.Checksum, v.BlobKey).Scan(&refs)
+			switch err {
+			case nil:
+				unreferenced = refs <= 0
+				if unreferenced {
+					query = `DELETE FROM blobs WHERE checksum=$1`
+					if _, err := tx.Exec(ctx, query, v.Checksum); err != nil {
+						return keys, err
+					}
+				}
+			case pgx.ErrNoRows:
+				// blobs written before deduplication are owned by a single file
+			default:
+				log.Error(fmt.Errorf("unable to release blob reference: %+v", err))
+				return keys, err
+			}
+		}
+		if unreferenced && !seen[v.BlobKey] {
+			seen[v.BlobKey] = true
+			keys = append(keys, v.BlobKey)
+		}
+	}
+	return keys, nil
+}
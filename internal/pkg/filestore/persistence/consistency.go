@@ -0,0 +1,58 @@
+package filestore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/filestore"
+)
+
+// db function used to list the blobs referenced by all file versions.
+// files created before versioning was introduced have no versions and
+// reference the blob stored under their file ID
+func (db *PostgresPersistence) ListBlobReferences() ([]filestore.BlobReference, error) {
+	log.Debug("fetching blob references from postgres storage...")
+	references := []filestore.BlobReference{}
+
+	query := `SELECT file_id,version,blob_key FROM file_versions
+	UNION ALL
+	SELECT m.file_id,m.version,m.file_id::text FROM file_metadata m
+	WHERE NOT EXISTS (SELECT 1 FROM file_versions v WHERE v.file_id=m.file_id)`
+	rows, err := db.Session.Query(context.Background(), query)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve data from database: %+v", err))
+		return references, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r filestore.BlobReference
+		if err := rows.Scan(&r.FileId, &r.Version, &r.BlobKey); err != nil {
+			log.Error(fmt.Errorf("unable to read data into local variables: %+v", err))
+			return references, err
+		}
+		references = append(references, r)
+	}
+	return references, rows.Err()
+}
+
+// db function used to mark files with missing contents as broken.
+// files that are no longer broken have their flag cleared, and only
+// rows whose flag changes are updated
+func (db *PostgresPersistence) MarkBrokenFiles(fileIds []uuid.UUID) error {
+	log.Debug(fmt.Sprintf("marking %d file(s) as broken...", len(fileIds)))
+	// nil slices are encoded as NULL rather than an empty array
+	if fileIds == nil {
+		fileIds = []uuid.UUID{}
+	}
+	query := `UPDATE file_metadata SET broken = (file_id = ANY($1))
+	WHERE broken <> (file_id = ANY($1))`
+	_, err := db.Session.Exec(context.Background(), query, fileIds)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to mark broken files: %+v", err))
+	}
+	return err
+}
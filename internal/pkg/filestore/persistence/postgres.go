@@ -5,8 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
@@ -16,21 +15,20 @@ import (
 	"github.com/PSauerborn/gamma-project/internal/pkg/utils"
 )
 
+// define metadata store backed by postgres
 type PostgresPersistence struct {
 	*utils.BasePostgresPersistence
-
-	// define settings for file storage
-	BaseFilePath string
 }
 
-// db function used to retrieve metadata for all files
-func (db *PostgresPersistence) ListFiles() ([]filestore.FileMetadata, error) {
-	log.Debug("fetching files from postgres storage...")
+// db function used to retrieve metadata for all unarchived
+// or archived files
+func (db *PostgresPersistence) ListFiles(archived bool) ([]filestore.FileMetadata, error) {
+	log.Debug(fmt.Sprintf("fetching files with archived=%t from postgres storage...", archived))
 	files := []filestore.FileMetadata{}
 
-	query := `SELECT file_id,file_name,created,size,metadata FROM file_metadata
-	WHERE archived=false`
-	rows, err := db.Session.Query(context.Background(), query)
+	query := `SELECT file_id,file_name,created,size,metadata,version,COALESCE(checksum,''),
+	archived_at,broken FROM file_metadata WHERE archived=$1`
+	rows, err := db.Session.Query(context.Background(), query, archived)
 	if err != nil {
 		switch err {
 		case pgx.ErrNoRows:
@@ -47,7 +45,8 @@ func (db *PostgresPersistence) ListFiles() ([]filestore.FileMetadata, error) {
 		)
 
 		if err := rows.Scan(&meta.FileId, &meta.FileName, &meta.Created,
-			&meta.Size, &jsonMeta); err != nil {
+			&meta.Size, &jsonMeta, &meta.Version, &meta.Checksum, &meta.ArchivedAt,
+			&meta.Broken); err != nil {
 			log.Error(fmt.Errorf("unable to read data into local variables: %+v", err))
 			continue
 		}
@@ -68,11 +67,11 @@ func (db *PostgresPersistence) GetFileMetadata(fileId uuid.UUID) (filestore.File
 		fileId))
 	var meta filestore.FileMetadata
 
-	query := `SELECT file_id,file_name,created,size,metadata FROM file_metadata
-	WHERE file_id = $1 AND archived=false`
+	query := `SELECT file_id,file_name,created,size,metadata,version,COALESCE(checksum,''),
+	broken FROM file_metadata WHERE file_id = $1 AND archived=false`
 	row := db.Session.QueryRow(context.Background(), query, fileId)
 	if err := row.Scan(&meta.FileId, &meta.FileName, &meta.Created,
-		&meta.Size, &meta.Meta); err != nil {
+		&meta.Size, &meta.Meta, &meta.Version, &meta.Checksum, &meta.Broken); err != nil {
 		switch err {
 		case pgx.ErrNoRows:
 			return meta, filestore.ErrFileNotFound
@@ -83,99 +82,107 @@ func (db *PostgresPersistence) GetFileMetadata(fileId uuid.UUID) (filestore.File
 	return meta, nil
 }
 
-// db function used to retrieve file contents from local disk storage
-func (db *PostgresPersistence) GetFileContents(meta filestore.FileMetadata) ([]byte, error) {
-	log.Debug(fmt.Sprintf("fetching file contents for %+v", meta))
-	// open file with given file path
-	contents, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", db.BaseFilePath, meta.FileId))
-	if err != nil {
-		log.Error(fmt.Errorf("unable to open file %s: %+v", meta.FileName, err))
-		return []byte{}, err
-	}
-	return contents, nil
-}
-
-// db function used to create a new file
-func (db *PostgresPersistence) CreateFile(content []byte, fileName string,
-	meta map[string]interface{}) (uuid.UUID, error) {
-	log.Debug("inserting new file into postgres storage...")
-	fileId := uuid.New()
-
-	jsonBody, err := json.Marshal(meta)
+// db function used to create the metadata and first version of a new
+// file. the returned version references the blob that stores its
+// contents, which differs from the given blob if identical contents
+// have already been stored
+func (db *PostgresPersistence) CreateFile(meta filestore.FileMetadata,
+	version filestore.FileVersion) (filestore.FileVersion, error) {
+	log.Debug(fmt.Sprintf("inserting file %s into postgres storage...", meta.FileId))
+	v := version
+	jsonBody, err := json.Marshal(meta.Meta)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to convert file metadata to JSON: %+v", err))
-		return fileId, errors.New("invalid file metadata")
+		return v, errors.New("invalid file metadata")
 	}
 
-	query := `INSERT INTO file_metadata(file_id,file_name,size,metadata)
-	VALUES($1,$2,$3,$4)`
-	_, err = db.Session.Exec(context.Background(), query, fileId, fileName,
-		len(content), jsonBody)
-	if err != nil {
-		return fileId, err
-	}
-	// construct file path and write to files
-	fpath := fmt.Sprintf("%s/%s", db.BaseFilePath, fileId)
-	return fileId, ioutil.WriteFile(fpath, content, 0644)
-}
-
-// db function used to modify an existing file metadata
-func (db *PostgresPersistence) ModifyFile(meta filestore.FileMetadata, contents []byte) error {
-	log.Debug(fmt.Sprintf("modifying file %s postgres storage...", meta.FileId))
-	return filestore.ErrFeatureNotSupported
+	err = db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		query := `INSERT INTO file_metadata(file_id,file_name,size,metadata,checksum,version)
+		VALUES($1,$2,$3,$4,$5,1)`
+		if _, err := tx.Exec(ctx, query, meta.FileId, meta.FileName, v.Size, jsonBody,
+			v.Checksum); err != nil {
+			return err
+		}
+		key, err := acquireBlob(ctx, tx, v)
+		if err != nil {
+			return err
+		}
+		v.BlobKey = key
+
+		query = `INSERT INTO file_versions(file_id,version,size,checksum,creator,blob_key)
+		VALUES($1,1,$2,$3,$4,$5) RETURNING created`
+		return tx.QueryRow(ctx, query, meta.FileId, v.Size, v.Checksum, v.Creator,
+			v.BlobKey).Scan(&v.Created)
+	})
+	return v, err
 }
 
-// db function used to delete a particular file with given file ID
-func (db *PostgresPersistence) DeleteFile(meta filestore.FileMetadata) error {
-	log.Debug(fmt.Sprintf("deleting file %s from postgres storage...", meta.FileId))
+// db function used to delete a particular file with given file ID.
+// all versions of the file are deleted, and the keys of all blobs
+// that are no longer referenced by any file are returned
+func (db *PostgresPersistence) DeleteFile(fileId uuid.UUID) ([]string, error) {
+	log.Debug(fmt.Sprintf("deleting file %s from postgres storage...", fileId))
+	keys := []string{}
+	err := db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		query := `DELETE FROM file_metadata WHERE file_id = $1`
+		tag, err := tx.Exec(ctx, query, fileId)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return filestore.ErrFileNotFound
+		}
 
-	fpath := fmt.Sprintf("%s/%s", db.BaseFilePath, meta.FileId)
-	if err := os.Remove(fpath); err != nil {
-		log.Error(fmt.Errorf("unable to delete file: %+v", err))
-		return filestore.ErrCannotDeleteFile
-	}
+		query = `DELETE FROM file_versions WHERE file_id = $1 RETURNING checksum,blob_key`
+		rows, err := tx.Query(ctx, query, fileId)
+		if err != nil {
+			return err
+		}
+		versions := []filestore.FileVersion{}
+		for rows.Next() {
+			var v filestore.FileVersion
+			if err := rows.Scan(&v.Checksum, &v.BlobKey); err != nil {
+				rows.Close()
+				return err
+			}
+			versions = append(versions, v)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
 
-	query := `DELETE FROM file_metadata WHERE file_id = $1`
-	_, err := db.Session.Exec(context.Background(), query, meta.FileId)
-	if err != nil {
+		keys, err = releaseBlobs(ctx, tx, versions)
 		return err
-	}
-	return nil
+	})
+	return keys, err
 }
 
 // db function used to archive file
-func (db *PostgresPersistence) ArchiveFile(meta filestore.FileMetadata) error {
-	log.Debug("archieving file %+v...", meta)
-	// construct current and target directories
-	current := fmt.Sprintf("%s/%s", db.BaseFilePath, meta.FileId)
-	target := fmt.Sprintf("%s/archive/%s", db.BaseFilePath, meta.FileId)
-	if err := os.Rename(current, target); err != nil {
-		log.Error(fmt.Errorf("cannot move files: %+v", err))
+func (db *PostgresPersistence) ArchiveFile(fileId uuid.UUID) error {
+	log.Debug(fmt.Sprintf("archiving file %s...", fileId))
+	query := `UPDATE file_metadata SET archived=true, archived_at=$2 WHERE file_id=$1`
+	tag, err := db.Session.Exec(context.Background(), query, fileId, time.Now().UTC())
+	if err != nil {
 		return err
 	}
-
-	query := `UPDATE file_metadata SET archived=true WHERE file_id=$1`
-	_, err := db.Session.Exec(context.Background(), query, meta.FileId)
-	return err
+	if tag.RowsAffected() == 0 {
+		return filestore.ErrFileNotFound
+	}
+	return nil
 }
 
-// db function to search meta
-func (db *PostgresPersistence) SearchFilesByMetadata(terms map[string]interface{}) (
-	[]filestore.FileMetadata, error) {
-	log.Debug(fmt.Sprintf("searching files with terms %+v", terms))
-	matches := []filestore.FileMetadata{}
-	// retrieve file list from database
-	files, err := db.ListFiles()
+// db function used to unarchive file
+func (db *PostgresPersistence) UnarchiveFile(fileId uuid.UUID) error {
+	log.Debug(fmt.Sprintf("unarchiving file %s...", fileId))
+	query := `UPDATE file_metadata SET archived=false, archived_at=NULL
+	WHERE file_id=$1 AND archived=true`
+	tag, err := db.Session.Exec(context.Background(), query, fileId)
 	if err != nil {
-		return matches, err
+		return err
 	}
-
-	// iterate over files and append to results
-	// if provided metadata fields all match
-	for _, f := range files {
-		if filestore.MapMatchesTerms(f.Meta, terms, filestore.CompleteMatch) {
-			matches = append(matches, f)
-		}
+	if tag.RowsAffected() == 0 {
+		return filestore.ErrFileNotFound
 	}
-	return matches, nil
+	return nil
 }
@@ -0,0 +1,168 @@
+package filestore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/filestore"
+)
+
+// define comparison operators used in SQL for search operators
+var comparisonOperators = map[filestore.SearchOperator]string{
+	filestore.OpGt:  ">",
+	filestore.OpGte: ">=",
+	filestore.OpLt:  "<",
+	filestore.OpLte: "<=",
+}
+
+// function used to translate a search query into a SQL condition on
+// the metadata of files. the arg function is used to add arguments
+// to the query and returns their placeholders
+func buildSearchFilter(query filestore.SearchQuery, arg func(interface{}) string) (string, error) {
+	conditions := []string{}
+	for _, c := range query.Conditions {
+		condition, err := buildSearchCondition(c, arg)
+		if err != nil {
+			return "", err
+		}
+		// conditions evaluating to NULL are treated as not matching
+		conditions = append(conditions, fmt.Sprintf("COALESCE(%s, false)", condition))
+	}
+
+	switch query.Mode {
+	case filestore.PartialMatch:
+		if len(conditions) == 0 {
+			return "FALSE", nil
+		}
+		return fmt.Sprintf("(%s)", strings.Join(conditions, " OR ")), nil
+	case filestore.NoMatch:
+		if len(conditions) == 0 {
+			return "TRUE", nil
+		}
+		return fmt.Sprintf("NOT (%s)", strings.Join(conditions, " OR ")), nil
+	default:
+		if len(conditions) == 0 {
+			return "TRUE", nil
+		}
+		return fmt.Sprintf("(%s)", strings.Join(conditions, " AND ")), nil
+	}
+}
+
+// function used to translate a single search condition into SQL
+func buildSearchCondition(c filestore.SearchCondition, arg func(interface{}) string) (
+	string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+	field := fmt.Sprintf("(metadata::jsonb #> %s)", arg(c.Segments()))
+	text := fmt.Sprintf("(metadata::jsonb #>> %s)", arg(c.Segments()))
+
+	switch c.Op {
+	case filestore.OpEq, filestore.OpNe, filestore.OpIn:
+		value, err := json.Marshal(c.Value)
+		if err != nil {
+			return "", filestore.ErrInvalidSearch
+		}
+		switch c.Op {
+		case filestore.OpEq:
+			return fmt.Sprintf("%s = %s::jsonb", field, arg(string(value))), nil
+		case filestore.OpNe:
+			return fmt.Sprintf("%s <> %s::jsonb", field, arg(string(value))), nil
+		default:
+			return fmt.Sprintf("%s IN (SELECT jsonb_array_elements(%s::jsonb))", field,
+				arg(string(value))), nil
+		}
+	case filestore.OpGt, filestore.OpGte, filestore.OpLt, filestore.OpLte:
+		operator := comparisonOperators[c.Op]
+		// CASE is used to ensure that values are only cast once their
+		// type has been checked. dates are cast with try_timestamptz,
+		// which returns NULL for strings that are not valid timestamps
+		if c.ComparesDates() {
+			value, err := time.Parse(time.RFC3339, c.Value.(string))
+			if err != nil {
+				return "", filestore.ErrInvalidSearch
+			}
+			return fmt.Sprintf(`CASE WHEN jsonb_typeof(%s) = 'string'
+			THEN try_timestamptz(%s) %s %s::timestamptz END`, field, text, operator,
+				arg(value)), nil
+		}
+		return fmt.Sprintf(`CASE WHEN jsonb_typeof(%s) = 'number'
+		THEN %s::numeric %s %s::numeric END`, field, text, operator, arg(c.Value)), nil
+	case filestore.OpExists:
+		if exists, ok := c.Value.(bool); ok && !exists {
+			return fmt.Sprintf("%s IS NULL", field), nil
+		}
+		return fmt.Sprintf("%s IS NOT NULL", field), nil
+	case filestore.OpPrefix:
+		return fmt.Sprintf(`CASE WHEN jsonb_typeof(%s) = 'string'
+		THEN starts_with(%s, %s) END`, field, text, arg(c.Value)), nil
+	}
+	return "", filestore.ErrInvalidSearch
+}
+
+// db function used to search unarchived files by metadata. results
+// are ordered by creation date and paginated using the creation date
+// and file ID of the last file returned
+func (db *PostgresPersistence) SearchFiles(query filestore.SearchQuery) (filestore.FilePage, error) {
+	log.Debug(fmt.Sprintf("searching files with query %+v", query))
+	page := filestore.FilePage{Files: []filestore.FileMetadata{}}
+
+	args := []interface{}{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	where, err := buildSearchFilter(query, arg)
+	if err != nil {
+		return page, err
+	}
+	where = fmt.Sprintf("archived=false AND %s", where)
+
+	// count total number of files matching query without cursor
+	sql := fmt.Sprintf(`SELECT COUNT(*) FROM file_metadata WHERE %s`, where)
+	if err := db.Session.QueryRow(context.Background(), sql, args...).Scan(&page.Total); err != nil {
+		log.Error(fmt.Errorf("unable to count files: %+v", err))
+		return page, err
+	}
+
+	if query.Cursor != nil {
+		where = fmt.Sprintf("%s AND (created, file_id) > (%s, %s)", where,
+			arg(query.Cursor.Created), arg(query.Cursor.FileId))
+	}
+	// an additional row is fetched to determine if another page exists
+	sql = fmt.Sprintf(`SELECT file_id,file_name,created,size,metadata,version,
+	COALESCE(checksum,''),broken FROM file_metadata WHERE %s ORDER BY created, file_id
+	LIMIT %s`, where, arg(query.Limit+1))
+	rows, err := db.Session.Query(context.Background(), sql, args...)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve data from database: %+v", err))
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var meta filestore.FileMetadata
+		if err := rows.Scan(&meta.FileId, &meta.FileName, &meta.Created, &meta.Size,
+			&meta.Meta, &meta.Version, &meta.Checksum, &meta.Broken); err != nil {
+			log.Error(fmt.Errorf("unable to read data into local variables: %+v", err))
+			return page, err
+		}
+		page.Files = append(page.Files, meta)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	if len(page.Files) > query.Limit {
+		page.Files = page.Files[:query.Limit]
+		last := page.Files[len(page.Files)-1]
+		page.NextCursor = filestore.FileCursor{Created: last.Created,
+			FileId: last.FileId}.Encode()
+	}
+	return page, nil
+}
@@ -0,0 +1,44 @@
+package filestore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/utils"
+	"github.com/PSauerborn/gamma-project/internal/pkg/utils/pgtest"
+)
+
+func TestDeleteFileIsAtomic(t *testing.T) {
+	fileId := uuid.New()
+	rows := func(sql string, args []interface{}) [][]interface{} {
+		switch {
+		case strings.Contains(sql, "DELETE FROM file_versions"):
+			// the second version was written before deduplication
+			return [][]interface{}{{"checksum", "blob-1"}, {"", "blob-2"}}
+		case strings.Contains(sql, "UPDATE blobs"):
+			return [][]interface{}{{0}}
+		}
+		return nil
+	}
+
+	// deleting a file removes its metadata and versions, and releases
+	// the blobs referenced by its versions
+	pgtest.CheckAtomic(t, rows, func(s *pgtest.Session) error {
+		db := &PostgresPersistence{&utils.BasePostgresPersistence{Session: s}}
+		_, err := db.DeleteFile(fileId)
+		return err
+	})
+
+	s := &pgtest.Session{Rows: rows}
+	db := &PostgresPersistence{&utils.BasePostgresPersistence{Session: s}}
+	keys, err := db.DeleteFile(fileId)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if expected := []string{"blob-1", "blob-2"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected released blobs %v, got %v", expected, keys)
+	}
+}
@@ -0,0 +1,103 @@
+package filestore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/filestore"
+)
+
+// db function used to append a new version to a file. the file
+// metadata is locked while the version is inserted so that concurrent
+// modifications receive distinct version numbers. as with new files,
+// the returned version references any existing blob with identical
+// contents
+func (db *PostgresPersistence) CreateFileVersion(fileId uuid.UUID,
+	version filestore.FileVersion) (filestore.FileVersion, error) {
+	log.Debug(fmt.Sprintf("inserting new version of file %s...", fileId))
+	v := version
+	v.FileId = fileId
+	err := db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		query := `SELECT version FROM file_metadata WHERE file_id=$1 AND archived=false
+		FOR UPDATE`
+		if err := tx.QueryRow(ctx, query, fileId).Scan(&v.Version); err != nil {
+			switch err {
+			case pgx.ErrNoRows:
+				return filestore.ErrFileNotFound
+			default:
+				return err
+			}
+		}
+		v.Version++
+		key, err := acquireBlob(ctx, tx, v)
+		if err != nil {
+			return err
+		}
+		v.BlobKey = key
+
+		query = `INSERT INTO file_versions(file_id,version,size,checksum,creator,blob_key)
+		VALUES($1,$2,$3,$4,$5,$6) RETURNING created`
+		if err := tx.QueryRow(ctx, query, fileId, v.Version, v.Size, v.Checksum,
+			v.Creator, v.BlobKey).Scan(&v.Created); err != nil {
+			return err
+		}
+		query = `UPDATE file_metadata SET version=$1, size=$2, checksum=$3 WHERE file_id=$4`
+		_, err = tx.Exec(ctx, query, v.Version, v.Size, v.Checksum, fileId)
+		return err
+	})
+	if err != nil {
+		log.Error(fmt.Errorf("unable to insert file version: %+v", err))
+	}
+	return v, err
+}
+
+// db function used to list all versions of a file
+func (db *PostgresPersistence) ListFileVersions(fileId uuid.UUID) ([]filestore.FileVersion, error) {
+	log.Debug(fmt.Sprintf("fetching versions of file %s...", fileId))
+	versions := []filestore.FileVersion{}
+
+	query := `SELECT file_id,version,size,checksum,creator,created,blob_key FROM file_versions
+	WHERE file_id=$1 ORDER BY version DESC`
+	rows, err := db.Session.Query(context.Background(), query, fileId)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve data from database: %+v", err))
+		return versions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v filestore.FileVersion
+		if err := rows.Scan(&v.FileId, &v.Version, &v.Size, &v.Checksum, &v.Creator,
+			&v.Created, &v.BlobKey); err != nil {
+			log.Error(fmt.Errorf("unable to read data into local variables: %+v", err))
+			return versions, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// db function used to retrieve a single version of a file
+func (db *PostgresPersistence) GetFileVersion(fileId uuid.UUID, version int) (
+	filestore.FileVersion, error) {
+	log.Debug(fmt.Sprintf("fetching version %d of file %s...", version, fileId))
+	var v filestore.FileVersion
+
+	query := `SELECT file_id,version,size,checksum,creator,created,blob_key FROM file_versions
+	WHERE file_id=$1 AND version=$2`
+	if err := db.Session.QueryRow(context.Background(), query, fileId, version).Scan(
+		&v.FileId, &v.Version, &v.Size, &v.Checksum, &v.Creator, &v.Created,
+		&v.BlobKey); err != nil {
+		switch err {
+		case pgx.ErrNoRows:
+			return v, filestore.ErrVersionNotFound
+		default:
+			return v, err
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,185 @@
+package filestore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrInvalidRetentionPolicy = errors.New("received invalid retention policy")
+
+// define struct used to store a retention policy. a policy applies
+// to archived files with the given metadata tag, optionally restricted
+// to files where the tag has a given value, and purges files that have
+// been archived for longer than the maximum age
+type RetentionPolicy struct {
+	Tag        string      `json:"tag"`
+	Value      interface{} `json:"value,omitempty"`
+	MaxAgeDays int         `json:"max_age_days"`
+}
+
+// function used to determine if a policy applies to a file
+func (p RetentionPolicy) Matches(file FileMetadata) bool {
+	value, ok := file.Meta[p.Tag]
+	if !ok {
+		return false
+	}
+	return p.Value == nil || reflect.DeepEqual(value, p.Value)
+}
+
+// function used to parse a list of retention policies from JSON
+func ParseRetentionPolicies(body string) ([]RetentionPolicy, error) {
+	policies := []RetentionPolicy{}
+	if len(body) == 0 {
+		return policies, nil
+	}
+	if err := json.Unmarshal([]byte(body), &policies); err != nil {
+		log.Error(fmt.Errorf("unable to parse retention policies: %+v", err))
+		return policies, ErrInvalidRetentionPolicy
+	}
+	for _, p := range policies {
+		if len(p.Tag) == 0 || p.MaxAgeDays < 1 {
+			log.Error(fmt.Errorf("received invalid retention policy %+v", p))
+			return policies, ErrInvalidRetentionPolicy
+		}
+	}
+	return policies, nil
+}
+
+// define struct used to store an archived file that has
+// exceeded the maximum age of its retention policy
+type ExpiredFile struct {
+	FileId     uuid.UUID       `json:"file_id"`
+	FileName   string          `json:"file_name"`
+	ArchivedAt time.Time       `json:"archived_at"`
+	ExpiredAt  time.Time       `json:"expired_at"`
+	Policy     RetentionPolicy `json:"policy"`
+}
+
+// define struct used to report the result of a retention run
+type RetentionReport struct {
+	Generated time.Time         `json:"generated"`
+	DryRun    bool              `json:"dry_run"`
+	Policies  []RetentionPolicy `json:"policies"`
+	Archived  int               `json:"archived"`
+	Expired   []ExpiredFile     `json:"expired"`
+	Purged    int               `json:"purged"`
+}
+
+// function used to evaluate retention policies against all archived
+// files. files are governed by the first policy that matches them,
+// so more specific policies should be listed first. files archived
+// before archive times were recorded are aged from their creation
+func EvaluateRetention(p FileStorePersistence, policies []RetentionPolicy,
+	now time.Time) (RetentionReport, []FileMetadata, error) {
+	report := RetentionReport{Generated: now, DryRun: true, Policies: policies,
+		Expired: []ExpiredFile{}}
+	expired := []FileMetadata{}
+
+	files, err := p.ListFiles(true)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve archived files: %+v", err))
+		return report, expired, err
+	}
+	report.Archived = len(files)
+
+	for _, file := range files {
+		archivedAt := file.Created
+		if file.ArchivedAt != nil {
+			archivedAt = *file.ArchivedAt
+		}
+		for _, policy := range policies {
+			if !policy.Matches(file) {
+				continue
+			}
+			expiry := archivedAt.AddDate(0, 0, policy.MaxAgeDays)
+			if !expiry.After(now) {
+				report.Expired = append(report.Expired, ExpiredFile{FileId: file.FileId,
+					FileName: file.FileName, ArchivedAt: archivedAt, ExpiredAt: expiry,
+					Policy: policy})
+				expired = append(expired, file)
+			}
+			break
+		}
+	}
+	return report, expired, nil
+}
+
+type RetentionEngine struct {
+	Persistence FileStorePersistence
+	Policies    []RetentionPolicy
+	Interval    time.Duration
+
+	stop chan struct{}
+}
+
+// function used to start the retention engine. the engine periodically
+// purges archived files that have exceeded the maximum age of their
+// retention policy
+func (e *RetentionEngine) Start() {
+	log.Info(fmt.Sprintf("starting retention engine with %d policies and interval %s",
+		len(e.Policies), e.Interval))
+	e.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(e.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.Run()
+			case <-e.stop:
+				log.Info("stopping retention engine")
+				return
+			}
+		}
+	}()
+}
+
+// function used to stop a running retention engine
+func (e *RetentionEngine) Stop() {
+	if e.stop != nil {
+		close(e.stop)
+	}
+}
+
+// function used to execute a single retention run
+func (e *RetentionEngine) Run() RetentionReport {
+	report, expired, err := EvaluateRetention(e.Persistence, e.Policies, time.Now().UTC())
+	if err != nil {
+		return report
+	}
+	report.DryRun = false
+	for _, file := range expired {
+		if err := e.Persistence.DeleteFile(file); err != nil {
+			log.Error(fmt.Errorf("unable to purge file %s: %+v", file.FileId, err))
+			continue
+		}
+		report.Purged++
+	}
+	if report.Purged > 0 {
+		log.Info(fmt.Sprintf("purged %d expired archived file(s)", report.Purged))
+	}
+	return report
+}
+
+// API handler used to generate a dry-run retention report listing
+// all archived files that would be purged by the next retention run
+func RetentionReportHandler(ctx *gin.Context) {
+	log.Info("received request to generate retention report")
+	report, _, err := EvaluateRetention(persistence, serviceConfig.RetentionPolicies,
+		time.Now().UTC())
+	if err != nil {
+		status := http.StatusInternalServerError
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Internal server error"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK, "report": report})
+}
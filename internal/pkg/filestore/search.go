@@ -0,0 +1,176 @@
+package filestore
+
+import (
+	b64 "encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrInvalidSearch = errors.New("received invalid search query")
+	ErrInvalidCursor = errors.New("received invalid pagination cursor")
+)
+
+const (
+	// define default and maximum page sizes for searches
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// define operators supported by metadata search conditions
+type SearchOperator string
+
+const (
+	OpEq     SearchOperator = "eq"
+	OpNe     SearchOperator = "ne"
+	OpIn     SearchOperator = "in"
+	OpGt     SearchOperator = "gt"
+	OpGte    SearchOperator = "gte"
+	OpLt     SearchOperator = "lt"
+	OpLte    SearchOperator = "lte"
+	OpExists SearchOperator = "exists"
+	OpPrefix SearchOperator = "prefix"
+)
+
+// define struct used to store a single search condition. paths
+// address nested metadata fields using dot notation, with numeric
+// segments addressing array elements (e.g. customer.tags.0)
+//
+// - eq and ne compare JSON values. ne only matches fields that exist
+// - in matches fields equal to any element of an array value
+// - gt, gte, lt and lte compare numbers, or dates if the value is an
+// RFC 3339 timestamp. fields of any other type never match
+// - exists matches fields that are present, or absent if the value is false
+// - prefix matches string fields starting with the value
+type SearchCondition struct {
+	Path  string         `json:"path"`
+	Op    SearchOperator `json:"op"`
+	Value interface{}    `json:"value"`
+}
+
+// define struct used to search files by metadata. conditions are
+// combined according to the search mode: CompleteMatch returns files
+// matching all conditions, PartialMatch files matching at least one
+// condition and NoMatch files matching none of the conditions
+type SearchQuery struct {
+	Conditions []SearchCondition
+	Mode       SearchType
+	Limit      int
+	Cursor     *FileCursor
+}
+
+// define struct used to store position of last file returned in a
+// page of search results
+type FileCursor struct {
+	Created time.Time `json:"c"`
+	FileId  uuid.UUID `json:"id"`
+}
+
+// define struct used to return a single page of files
+type FilePage struct {
+	Files      []FileMetadata `json:"files"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	Total      int            `json:"total"`
+}
+
+// function used to encode a cursor into an opaque string
+func (c FileCursor) Encode() string {
+	body, _ := json.Marshal(c)
+	return b64.URLEncoding.EncodeToString(body)
+}
+
+// function used to decode an opaque cursor string
+func DecodeFileCursor(cursor string) (FileCursor, error) {
+	var c FileCursor
+	body, err := b64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(body, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// function used to parse a search mode. the default mode
+// is CompleteMatch
+func ParseSearchType(mode string) (SearchType, error) {
+	switch mode {
+	case "", "complete":
+		return CompleteMatch, nil
+	case "partial":
+		return PartialMatch, nil
+	case "none":
+		return NoMatch, nil
+	default:
+		return CompleteMatch, ErrInvalidSearch
+	}
+}
+
+// function used to convert a search mode into the
+// name accepted by ParseSearchType
+func (t SearchType) Name() string {
+	return [...]string{"complete", "partial", "none"}[t]
+}
+
+// function used to split the path of a condition into its segments
+func (c SearchCondition) Segments() []string {
+	return strings.Split(c.Path, ".")
+}
+
+// function used to determine if a comparison condition compares dates
+func (c SearchCondition) ComparesDates() bool {
+	_, ok := c.Value.(string)
+	return ok
+}
+
+// function used to validate a search condition
+func (c SearchCondition) Validate() error {
+	for _, segment := range c.Segments() {
+		if len(segment) == 0 {
+			log.Error(fmt.Errorf("received invalid search path '%s'", c.Path))
+			return ErrInvalidSearch
+		}
+	}
+
+	switch c.Op {
+	case OpEq, OpNe:
+	case OpIn:
+		if _, ok := c.Value.([]interface{}); !ok {
+			log.Error(fmt.Errorf("received non-array value for in condition on %s", c.Path))
+			return ErrInvalidSearch
+		}
+	case OpGt, OpGte, OpLt, OpLte:
+		switch value := c.Value.(type) {
+		case float64:
+		case string:
+			if _, err := time.Parse(time.RFC3339, value); err != nil {
+				log.Error(fmt.Errorf("received invalid timestamp %s: %+v", value, err))
+				return ErrInvalidSearch
+			}
+		default:
+			log.Error(fmt.Errorf("received invalid comparison value for %s", c.Path))
+			return ErrInvalidSearch
+		}
+	case OpExists:
+		if _, ok := c.Value.(bool); !ok && c.Value != nil {
+			log.Error(fmt.Errorf("received non-boolean value for exists condition on %s", c.Path))
+			return ErrInvalidSearch
+		}
+	case OpPrefix:
+		if _, ok := c.Value.(string); !ok {
+			log.Error(fmt.Errorf("received non-string value for prefix condition on %s", c.Path))
+			return ErrInvalidSearch
+		}
+	default:
+		log.Error(fmt.Errorf("received invalid search operator %s", c.Op))
+		return ErrInvalidSearch
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package filestore
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// define struct used to combine a metadata store with a blob store.
+// file contents are written to the blob store before the metadata
+// referencing them is stored, so that metadata never references
+// missing contents. blobs left behind by failed writes are removed
+// on a best effort basis
+type Store struct {
+	Metadata MetadataStore
+	Blobs    BlobStore
+}
+
+// function used to retrieve metadata for all unarchived
+// or archived files
+func (s *Store) ListFiles(archived bool) ([]FileMetadata, error) {
+	return s.Metadata.ListFiles(archived)
+}
+
+// function used to retrieve metadata for a single file
+func (s *Store) GetFileMetadata(fileId uuid.UUID) (FileMetadata, error) {
+	return s.Metadata.GetFileMetadata(fileId)
+}
+
+// function used to retrieve a single version of a file. files
+// created before versioning was introduced have no stored
+// versions, and their contents are stored under the file ID
+func (s *Store) GetFileVersion(fileId uuid.UUID, version int) (FileVersion, error) {
+	v, err := s.Metadata.GetFileVersion(fileId, version)
+	if err == ErrVersionNotFound && version == 1 {
+		meta, err := s.Metadata.GetFileMetadata(fileId)
+		if err != nil || meta.Version != 1 {
+			return v, ErrVersionNotFound
+		}
+		return FileVersion{FileId: fileId, Version: 1, Size: int64(meta.Size),
+			Created: meta.Created, BlobKey: fileId.String()}, nil
+	}
+	return v, err
+}
+
+// function used to list all versions of a file
+func (s *Store) ListFileVersions(fileId uuid.UUID) ([]FileVersion, error) {
+	return s.Metadata.ListFileVersions(fileId)
+}
+
+// function used to open the contents of a file version
+func (s *Store) GetFileContents(version FileVersion) (Blob, error) {
+	log.Debug(fmt.Sprintf("fetching contents of version %d of file %s", version.Version,
+		version.FileId))
+	return s.Blobs.Get(version.BlobKey)
+}
+
+// function used to write a stream to a new blob while computing the
+// checksum and size of the contents. a max size of 0 disables the
+// size limit
+func (s *Store) putBlob(content io.Reader, maxSize int64) (FileVersion, error) {
+	v := FileVersion{BlobKey: uuid.New().String()}
+	reader := NewHashingReader(content)
+	var source io.Reader = reader
+	// read a single byte past the limit to detect files that are too large
+	if maxSize > 0 {
+		source = io.LimitReader(reader, maxSize+1)
+	}
+	if err := s.Blobs.Put(v.BlobKey, source); err != nil {
+		log.Error(fmt.Errorf("unable to write file contents: %+v", err))
+		s.deleteBlob(v.BlobKey)
+		return v, err
+	}
+	if maxSize > 0 && reader.Size > maxSize {
+		log.Warn(fmt.Sprintf("rejecting file exceeding maximum size of %d bytes", maxSize))
+		s.deleteBlob(v.BlobKey)
+		return v, ErrFileTooLarge
+	}
+	v.Size, v.Checksum = reader.Size, reader.Checksum()
+	return v, nil
+}
+
+// function used to remove a newly written blob if the metadata store
+// resolved its contents to an existing blob with the same checksum
+func (s *Store) deduplicate(written, stored FileVersion) {
+	if written.BlobKey != stored.BlobKey {
+		log.Debug(fmt.Sprintf("contents of file %s already stored in blob %s", stored.FileId,
+			stored.BlobKey))
+		s.deleteBlob(written.BlobKey)
+	}
+}
+
+// function used to delete a blob, logging any errors
+func (s *Store) deleteBlob(key string) {
+	if err := s.Blobs.Delete(key); err != nil {
+		log.Error(fmt.Errorf("unable to delete blob %s: %+v", key, err))
+	}
+}
+
+// function used to create a new file
+func (s *Store) CreateFile(content []byte, fileName string, meta map[string]interface{},
+	creator string) (uuid.UUID, error) {
+	result, err := s.CreateFileFromStream(bytes.NewReader(content), fileName, meta, 0, creator)
+	return result.FileId, err
+}
+
+// function used to create a new file from a stream. a max
+// size of 0 disables the size limit
+func (s *Store) CreateFileFromStream(content io.Reader, fileName string,
+	meta map[string]interface{}, maxSize int64, creator string) (FileUploadResult, error) {
+	log.Debug("inserting new file into storage...")
+	result := FileUploadResult{FileId: uuid.New()}
+	v, err := s.putBlob(content, maxSize)
+	if err != nil {
+		return result, err
+	}
+	v.FileId, v.Version, v.Creator = result.FileId, 1, creator
+
+	file := FileMetadata{FileId: result.FileId, FileName: fileName, Size: int(v.Size),
+		Meta: meta, Version: 1, Checksum: v.Checksum}
+	created, err := s.Metadata.CreateFile(file, v)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to store file metadata: %+v", err))
+		s.deleteBlob(v.BlobKey)
+		return result, err
+	}
+	s.deduplicate(v, created)
+	result.Size, result.Checksum = v.Size, v.Checksum
+	return result, nil
+}
+
+// function used to modify an existing file. the new contents are
+// stored as a new version, leaving all previous versions untouched
+func (s *Store) ModifyFile(meta FileMetadata, content io.Reader, maxSize int64,
+	creator string) (FileVersion, error) {
+	log.Debug(fmt.Sprintf("modifying file %s...", meta.FileId))
+	v, err := s.putBlob(content, maxSize)
+	if err != nil {
+		return v, err
+	}
+	v.Creator = creator
+
+	created, err := s.Metadata.CreateFileVersion(meta.FileId, v)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to store file version: %+v", err))
+		s.deleteBlob(v.BlobKey)
+		return created, err
+	}
+	s.deduplicate(v, created)
+	return created, nil
+}
+
+// function used to restore a previous version of a file. restoring
+// a version creates a new version with the contents of the old one so
+// that the history of the file is retained. since blobs are immutable
+// the new version references the blob of the restored version
+func (s *Store) RestoreFileVersion(meta FileMetadata, version int,
+	creator string) (FileVersion, error) {
+	log.Debug(fmt.Sprintf("restoring version %d of file %s...", version, meta.FileId))
+	previous, err := s.GetFileVersion(meta.FileId, version)
+	if err != nil {
+		return previous, err
+	}
+	previous.Creator = creator
+	return s.Metadata.CreateFileVersion(meta.FileId, previous)
+}
+
+// function used to delete a file and all of its versions. blobs are
+// only deleted once they are no longer referenced by any file, and
+// are deleted after the metadata so that a failure leaves behind an
+// unreferenced blob rather than metadata without contents
+func (s *Store) DeleteFile(meta FileMetadata) error {
+	log.Debug(fmt.Sprintf("deleting file %s...", meta.FileId))
+	versions, err := s.Metadata.ListFileVersions(meta.FileId)
+	if err != nil {
+		return err
+	}
+	keys, err := s.Metadata.DeleteFile(meta.FileId)
+	if err != nil {
+		return err
+	}
+	// files created before versioning was introduced
+	// are stored under the file ID
+	if len(versions) == 0 {
+		keys = append(keys, meta.FileId.String())
+	}
+	for _, key := range keys {
+		s.deleteBlob(key)
+	}
+	return nil
+}
+
+// function used to archive a file. archived files are retained
+// in the blob store but are excluded from all file listings
+func (s *Store) ArchiveFile(meta FileMetadata) error {
+	log.Debug(fmt.Sprintf("archiving file %s...", meta.FileId))
+	return s.Metadata.ArchiveFile(meta.FileId)
+}
+
+// function used to restore an archived file
+func (s *Store) UnarchiveFile(fileId uuid.UUID) error {
+	log.Debug(fmt.Sprintf("unarchiving file %s...", fileId))
+	return s.Metadata.UnarchiveFile(fileId)
+}
+
+// function used to search files by metadata
+func (s *Store) SearchFilesByMetadata(query SearchQuery) (FilePage, error) {
+	log.Debug(fmt.Sprintf("searching files with query %+v", query))
+	return s.Metadata.SearchFiles(query)
+}
@@ -0,0 +1,36 @@
+package filestore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+)
+
+// define struct used to compute the checksum and size of a stream
+// while it is being read
+type HashingReader struct {
+	reader io.Reader
+	hash   hash.Hash
+	Size   int64
+}
+
+// function used to generate new hashing reader wrapping a given reader
+func NewHashingReader(r io.Reader) *HashingReader {
+	return &HashingReader{reader: r, hash: sha256.New()}
+}
+
+func (r *HashingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.hash.Write(p[:n])
+		r.Size += int64(n)
+	}
+	return n, err
+}
+
+// function used to retrieve the hex encoded SHA-256 checksum
+// of all bytes read so far
+func (r *HashingReader) Checksum() string {
+	return hex.EncodeToString(r.hash.Sum(nil))
+}
@@ -1,5 +1,8 @@
 package filestore
 
+import "fmt"
+
+// define modes used to combine search conditions
 type SearchType int
 
 const (
@@ -12,51 +15,12 @@ func (t SearchType) String() string {
 	return [...]string{"CompleteMatch", "PartialMatch", "NoMatch"}[t]
 }
 
-// function used to search a given map with a given list of terms
-func MapMatchesTerms(items, terms map[string]interface{},
-	t SearchType) bool {
-	matches := []bool{}
-	// iterate over search terms and compare key:val pairs
-	for key, value := range terms {
-		if val, ok := items[key]; ok {
-			// if value is present and matches, add true to
-			if val == value {
-				matches = append(matches, true)
-				// else add false
-			} else {
-				matches = append(matches, false)
-			}
-			// if key is not present in items, add false
-		} else {
-			matches = append(matches, false)
-		}
-	}
-
-	switch t {
-	// return true only if all terms are matched
-	case CompleteMatch:
-		for _, match := range matches {
-			if !match {
-				return false
-			}
-		}
-		return true
-	// return true if one or more terms matched
-	case PartialMatch:
-		for _, match := range matches {
-			if match {
-				return true
-			}
-		}
-		return false
-	// return true if no terms matched
-	case NoMatch:
-		for _, match := range matches {
-			if match {
-				return false
-			}
-		}
-		return true
+// function used to generate the entity tag of a file version. the
+// checksum of the contents is used where available, so that versions
+// with identical contents share the same tag
+func FileETag(v FileVersion) string {
+	if len(v.Checksum) > 0 {
+		return fmt.Sprintf("\"%s\"", v.Checksum)
 	}
-	return false
+	return fmt.Sprintf("\"%s-%d\"", v.FileId, v.Version)
 }
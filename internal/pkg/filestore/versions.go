@@ -0,0 +1,105 @@
+package filestore
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// API handler used to list all versions of a file
+func ListFileVersionsHandler(ctx *gin.Context) {
+	log.Info("received request to list file versions")
+	fileId, err := uuid.Parse(ctx.Param("fileId"))
+	if err != nil {
+		log.Error(fmt.Errorf("received invalid file ID %s", ctx.Param("fileId")))
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"http_code": http.StatusBadRequest,
+			"message": "Invalid file ID"})
+		return
+	}
+	// ensure that file exists before listing versions
+	meta, err := persistence.GetFileMetadata(fileId)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve file metadata: %+v", err))
+		switch err {
+		case ErrFileNotFound:
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"http_code": http.StatusNotFound,
+				"message": "Cannot find file"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
+		return
+	}
+
+	versions, err := persistence.ListFileVersions(fileId)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve file versions: %+v", err))
+		status := http.StatusInternalServerError
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Internal server error"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"current_version": meta.Version, "versions": versions})
+}
+
+// API handler used to restore a previous version of a file. the
+// contents of the restored version are stored as a new version
+func RestoreFileVersionHandler(ctx *gin.Context) {
+	log.Info("received request to restore file version")
+	fileId, err := uuid.Parse(ctx.Param("fileId"))
+	if err != nil {
+		log.Error(fmt.Errorf("received invalid file ID %s", ctx.Param("fileId")))
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"http_code": http.StatusBadRequest,
+			"message": "Invalid file ID"})
+		return
+	}
+	version, err := strconv.Atoi(ctx.Param("version"))
+	if err != nil || version < 1 {
+		log.Error(fmt.Errorf("received invalid file version %s", ctx.Param("version")))
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"http_code": http.StatusBadRequest,
+			"message": "Invalid file version"})
+		return
+	}
+	// retrieve file metadata from persistence layer
+	meta, err := persistence.GetFileMetadata(fileId)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve file metadata: %+v", err))
+		switch err {
+		case ErrFileNotFound:
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"http_code": http.StatusNotFound,
+				"message": "Cannot find file"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
+		return
+	}
+
+	restored, err := persistence.RestoreFileVersion(meta, version, ctx.MustGet("uid").(string))
+	if err != nil {
+		log.Error(fmt.Errorf("unable to restore file version: %+v", err))
+		switch err {
+		case ErrFileNotFound:
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"http_code": http.StatusNotFound,
+				"message": "Cannot find file"})
+		case ErrVersionNotFound:
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"http_code": http.StatusNotFound,
+				"message": "Cannot find file version"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"message": fmt.Sprintf("Successfully restored version %d", version),
+		"version": restored})
+}
@@ -2,8 +2,11 @@ package jobs
 
 import (
 	"fmt"
+	"mime/multipart"
 	"net/http"
 
+	"github.com/PSauerborn/gamma-project/internal/pkg/filestore"
+	"github.com/PSauerborn/gamma-project/internal/pkg/roles"
 	"github.com/PSauerborn/gamma-project/internal/pkg/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -18,8 +21,9 @@ var (
 )
 
 type ServiceConfig struct {
-	FilestoreHost string
-	RolesAPIHost  string
+	Filestore *filestore.FileStoreAPIAccessor
+	Roles     *roles.RoleCache
+	Teams     *roles.RolesAPIAccessor
 }
 
 // function used to set global persistence instance
@@ -39,37 +43,69 @@ func HealthCheckHandler(ctx *gin.Context) {
 		"message": "Service running"})
 }
 
-// API handler used to list all jobs
+// API handler used to list all jobs. results are filtered,
+// sorted and paginated based on the query parameters
 func ListJobsHandler(ctx *gin.Context) {
 	log.Info("received request to list jobs")
-	// get all jobs from persistence layer
-	jobs, err := persistence.ListJobs()
+	filter, err := ParseJobFilter(ctx)
 	if err != nil {
-		log.Error(fmt.Errorf("unable to retrieve jobs: %+v", err))
-		status := http.StatusInternalServerError
+		log.Error(fmt.Errorf("unable to parse job filter: %+v", err))
+		status := http.StatusBadRequest
 		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
-			"message": "Internal server error"})
+			"message": "Invalid query parameters"})
+		return
+	}
+	// get page of jobs from persistence layer
+	page, err := persistence.ListJobs(filter)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve jobs: %+v", err))
+		switch err {
+		case ErrInvalidCursor:
+			status := http.StatusBadRequest
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Invalid query parameters"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
-		"jobs": jobs})
+		"jobs": page.Jobs, "next_cursor": page.NextCursor, "total": page.Total})
 }
 
-// API handler used to list all jobs
+// API handler used to list all jobs assigned to the requesting
+// user. supports the same query parameters as ListJobsHandler
 func ListUserJobsHandler(ctx *gin.Context) {
 	log.Info("received request to list jobs for user")
 	uid := ctx.MustGet("uid").(string)
-	// get all jobs from persistence layer
-	jobs, err := persistence.ListUserJobs(uid)
+	filter, err := ParseJobFilter(ctx)
 	if err != nil {
-		log.Error(fmt.Errorf("unable to retrieve jobs: %+v", err))
-		status := http.StatusInternalServerError
+		log.Error(fmt.Errorf("unable to parse job filter: %+v", err))
+		status := http.StatusBadRequest
 		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
-			"message": "Internal server error"})
+			"message": "Invalid query parameters"})
+		return
+	}
+	// get page of jobs from persistence layer
+	page, err := persistence.ListUserJobs(uid, filter)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve jobs: %+v", err))
+		switch err {
+		case ErrInvalidCursor:
+			status := http.StatusBadRequest
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Invalid query parameters"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
-		"jobs": jobs})
+		"jobs": page.Jobs, "next_cursor": page.NextCursor, "total": page.Total})
 }
 
 // API handler used to retrieve a job with given job ID
@@ -84,8 +120,8 @@ func GetJobHandler(ctx *gin.Context) {
 			"message": "Invalid job ID"})
 		return
 	}
-	// get job from persistence layer
-	j, err := persistence.GetJob(jobId)
+	// get job from persistence layer if visible to user
+	j, err := AuthorizeJobRequest(ctx, jobId, ReadJob)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to retrieve job: %+v", err))
 		switch err {
@@ -100,6 +136,7 @@ func GetJobHandler(ctx *gin.Context) {
 		}
 		return
 	}
+	ctx.Header("ETag", JobETag(j.Version))
 	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
 		"job": j})
 }
@@ -115,10 +152,35 @@ func CreateJobHandler(ctx *gin.Context) {
 			"message": "Invalid request body"})
 		return
 	}
+	// validate that parent job exists and can be updated by user if job
+	// is created as subtask, since subtasks block their parent from completing
+	if j.ParentId != nil {
+		if _, err := AuthorizeJobRequest(ctx, *j.ParentId, UpdateJob); err != nil {
+			log.Error(fmt.Errorf("unable to retrieve parent job: %+v", err))
+			switch err {
+			case ErrJobDoesNotExists:
+				status := http.StatusBadRequest
+				ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+					"message": "Cannot find parent job with specified ID"})
+			case ErrJobForbidden:
+				status := http.StatusForbidden
+				ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+					"message": "Forbidden"})
+			default:
+				status := http.StatusInternalServerError
+				ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+					"message": "Internal server error"})
+			}
+			return
+		}
+	}
+	// template fields are reserved for jobs created by the template generator
+	j.TemplateId, j.Occurrence = nil, nil
 	// add job creator to metadata
-	j.Meta["creator"] = ctx.MustGet("uid").(string)
+	uid := ctx.MustGet("uid").(string)
+	j.Meta["creator"] = uid
 	// create new job in persistence layer
-	id, err := persistence.CreateJob(j)
+	id, err := persistence.CreateJob(j, uid)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to create new job: %+v", err))
 		status := http.StatusInternalServerError
@@ -143,23 +205,13 @@ func DeleteJobHandler(ctx *gin.Context) {
 		return
 	}
 
-	// get job details from database
-	_, err = persistence.GetJob(jobId)
-	if err != nil {
+	// get job details from database and evaluate access policy
+	if _, err := AuthorizeJobRequest(ctx, jobId, UpdateJob); err != nil {
 		log.Error(fmt.Errorf("unable to retrieve job from database: %+v", err))
-		switch err {
-		case ErrJobDoesNotExists:
-			status := http.StatusNotFound
-			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
-				"message": "Cannot find job with specified ID"})
-		default:
-			status := http.StatusInternalServerError
-			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
-				"message": "Internal server error"})
-		}
+		abortWithLookupError(ctx, err)
 		return
 	}
-	if err := persistence.DeleteJob(jobId); err != nil {
+	if err := persistence.DeleteJob(jobId, ctx.MustGet("uid").(string)); err != nil {
 		log.Error(fmt.Errorf("unable to delete job from database"))
 		status := http.StatusInternalServerError
 		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
@@ -170,11 +222,12 @@ func DeleteJobHandler(ctx *gin.Context) {
 		"message": "Successfully delete job"})
 }
 
-// API handler used to alter job state
+// API handler used to alter job state. state changes are validated
+// against the job state machine and the role of the requesting user
 func AlterJobStateHandler(ctx *gin.Context) {
 	log.Info("received request to update job state")
 	var r struct {
-		State int `json:"state" binding:"required"`
+		State JobState `json:"state" binding:"required"`
 	}
 	if err := ctx.ShouldBind(&r); err != nil {
 		log.Error(fmt.Errorf("unable to parse request body: %+v", err))
@@ -183,6 +236,13 @@ func AlterJobStateHandler(ctx *gin.Context) {
 			"message": "Invalid request body"})
 		return
 	}
+	if !r.State.IsValid() {
+		log.Error(fmt.Errorf("received invalid job state %d", r.State))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid job state"})
+		return
+	}
 
 	// extract job ID from path and parse
 	jobId, err := uuid.Parse(ctx.Param("jobId"))
@@ -193,46 +253,128 @@ func AlterJobStateHandler(ctx *gin.Context) {
 			"message": "Invalid job ID"})
 		return
 	}
-	// get job details from database
-	_, err = persistence.GetJob(jobId)
+	// parse expected job version from request headers
+	version, err := ParseIfMatch(ctx)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse If-Match header: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid If-Match header"})
+		return
+	}
+	// get job details from database if user is permitted to update job
+	j, err := AuthorizeJobRequest(ctx, jobId, UpdateJob)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to retrieve job from database: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+	if version != 0 && j.Version != version {
+		log.Warn(fmt.Sprintf("job %s at version %d does not match expected version %d",
+			jobId, j.Version, version))
+		status := http.StatusPreconditionFailed
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Job was modified by another request", "version": j.Version})
+		return
+	}
+
+	// retrieve permissions of requesting user from roles API
+	uid := ctx.MustGet("uid").(string)
+	grant, err := serviceConfig.Roles.GetUserGrant(ctx.Request.Context(), uid)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve user permissions: %+v", err))
+		status := http.StatusInternalServerError
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Internal server error"})
+		return
+	}
+	// validate state transition against state machine
+	if err := ValidateTransition(j.State, r.State, grant); err != nil {
+		log.Warn(fmt.Sprintf("user %s cannot move job %s from %s to %s: %+v",
+			uid, jobId, j.State, r.State, err))
 		switch err {
-		case ErrJobDoesNotExists:
-			status := http.StatusNotFound
+		case ErrInsufficientRole:
+			status := http.StatusForbidden
 			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
-				"message": "Cannot find job with specified ID"})
+				"message": "Forbidden"})
 		default:
-			status := http.StatusInternalServerError
+			status := http.StatusConflict
 			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
-				"message": "Internal server error"})
+				"message": "Invalid state transition", "current_state": j.State,
+				"allowed_states": AllowedTransitions(j.State)})
 		}
 		return
 	}
-	if err := persistence.AlterJobState(jobId, r.State); err != nil {
-		log.Error(fmt.Errorf("unable to alter job state"))
+
+	// jobs cannot be started or completed until dependencies are met
+	unmet, err := UnmetDependencies(jobId, r.State)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to evaluate job dependencies: %+v", err))
 		status := http.StatusInternalServerError
 		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
 			"message": "Internal server error"})
 		return
 	}
+	if len(unmet) > 0 {
+		log.Warn(fmt.Sprintf("cannot move job %s to %s: %d unmet dependencies",
+			jobId, r.State, len(unmet)))
+		status := http.StatusConflict
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Job has unmet dependencies", "unmet_dependencies": unmet})
+		return
+	}
+
+	if err := persistence.AlterJobState(jobId, version, j.State, r.State, uid); err != nil {
+		log.Error(fmt.Errorf("unable to alter job state: %+v", err))
+		switch err {
+		case ErrJobStateConflict:
+			status := http.StatusConflict
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Job state was modified by another request"})
+		case ErrJobVersionConflict:
+			status := http.StatusPreconditionFailed
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Job was modified by another request"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
+		return
+	}
 	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
 		"message": "Successfully updated job"})
 }
 
-// API handler used to assign job
+// API handler used to assign a user or a team to a job. users are
+// assigned as owner unless a different assignment role is specified.
+// jobs assigned to a team are placed in the queue of the team, from
+// which they are claimed by members of the team
 func AssignJobHandler(ctx *gin.Context) {
 	log.Info("received request to assign job")
 	var r struct {
-		User string `json:"user" binding:"required"`
+		User string         `json:"user"`
+		Team *uuid.UUID     `json:"team"`
+		Role AssignmentRole `json:"role"`
 	}
-	if err := ctx.ShouldBind(&r); err != nil {
+	if err := ctx.ShouldBind(&r); err != nil || (len(r.User) > 0) == (r.Team != nil) {
 		log.Error(fmt.Errorf("unable to parse request body: %+v", err))
 		status := http.StatusBadRequest
 		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
 			"message": "Invalid request body"})
 		return
 	}
+	if len(r.Role) == 0 {
+		r.Role = OwnerRole
+	}
+	// teams can only be assigned as owner of a job
+	if !r.Role.IsValid() || (r.Team != nil && r.Role != OwnerRole) {
+		log.Error(fmt.Errorf("received invalid assignment role %s", r.Role))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid assignment role"})
+		return
+	}
 
 	// extract job ID from path and parse
 	jobId, err := uuid.Parse(ctx.Param("jobId"))
@@ -243,15 +385,112 @@ func AssignJobHandler(ctx *gin.Context) {
 			"message": "Invalid job ID"})
 		return
 	}
-	// get job details from database
-	_, err = persistence.GetJob(jobId)
+	// parse expected job version from request headers
+	version, err := ParseIfMatch(ctx)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse If-Match header: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid If-Match header"})
+		return
+	}
+	// get job details from database if visible to user
+	j, err := AuthorizeJobRequest(ctx, jobId, ReadJob)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to retrieve job from database: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+	if version != 0 && j.Version != version {
+		log.Warn(fmt.Sprintf("job %s at version %d does not match expected version %d",
+			jobId, j.Version, version))
+		status := http.StatusPreconditionFailed
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Job was modified by another request", "version": j.Version})
+		return
+	}
+
+	if r.Team != nil {
+		// validate that team exists before job is queued
+		if _, err := serviceConfig.Teams.GetTeam(ctx.Request.Context(), *r.Team); err != nil {
+			log.Error(fmt.Errorf("unable to retrieve team: %+v", err))
+			switch err {
+			case roles.ErrTeamNotFound:
+				status := http.StatusBadRequest
+				ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+					"message": "Cannot find team with specified ID"})
+			default:
+				status := http.StatusInternalServerError
+				ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+					"message": "Internal server error"})
+			}
+			return
+		}
+		err = persistence.QueueJob(jobId, version, *r.Team, ctx.MustGet("uid").(string))
+	} else {
+		err = persistence.AssignJob(jobId, version, r.User, r.Role, ctx.MustGet("uid").(string))
+	}
+	if err != nil {
+		log.Error(fmt.Errorf("unable to assign job: %+v", err))
+		switch err {
+		case ErrJobVersionConflict:
+			status := http.StatusPreconditionFailed
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Job was modified by another request"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"message": "Successfully updated job"})
+}
+
+// API handler used to remove a user from a job
+func UnassignJobHandler(ctx *gin.Context) {
+	log.Info("received request to unassign job")
+	// extract job ID from path and parse
+	jobId, err := uuid.Parse(ctx.Param("jobId"))
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse job ID: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid job ID"})
+		return
+	}
+	// parse expected job version from request headers
+	version, err := ParseIfMatch(ctx)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse If-Match header: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid If-Match header"})
+		return
+	}
+	if _, err := AuthorizeJobRequest(ctx, jobId, UpdateJob); err != nil {
+		log.Error(fmt.Errorf("unable to retrieve job from database: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+
+	if err := persistence.UnassignJob(jobId, version, ctx.Param("uid"),
+		ctx.MustGet("uid").(string)); err != nil {
+		log.Error(fmt.Errorf("unable to unassign job: %+v", err))
 		switch err {
 		case ErrJobDoesNotExists:
 			status := http.StatusNotFound
 			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
 				"message": "Cannot find job with specified ID"})
+		case ErrAssignmentNotFound:
+			status := http.StatusNotFound
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "User is not assigned to job"})
+		case ErrJobVersionConflict:
+			status := http.StatusPreconditionFailed
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Job was modified by another request"})
 		default:
 			status := http.StatusInternalServerError
 			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
@@ -259,15 +498,68 @@ func AssignJobHandler(ctx *gin.Context) {
 		}
 		return
 	}
-	if err := persistence.AssignJob(jobId, r.User); err != nil {
-		log.Error(fmt.Errorf("unable to assign job"))
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"message": "Successfully updated job"})
+}
+
+// API handler used to retrieve the change history of a job
+func GetJobHistoryHandler(ctx *gin.Context) {
+	log.Info("received request to retrieve job history")
+	// extract job ID from path and parse
+	jobId, err := uuid.Parse(ctx.Param("jobId"))
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse job ID: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid job ID"})
+		return
+	}
+	limit, offset, err := ParsePagination(ctx)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse pagination parameters: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid pagination parameters"})
+		return
+	}
+	// history is retained for deleted jobs, and is only visible to
+	// users that can read all jobs once the job has been deleted
+	deleted := false
+	if _, err := AuthorizeJobRequest(ctx, jobId, ReadJob); err != nil {
+		if err != ErrJobDoesNotExists {
+			log.Error(fmt.Errorf("unable to retrieve job from database: %+v", err))
+			abortWithLookupError(ctx, err)
+			return
+		}
+		grant, err := serviceConfig.Roles.GetUserGrant(ctx.Request.Context(),
+			ctx.MustGet("uid").(string))
+		if err != nil {
+			log.Error(fmt.Errorf("unable to retrieve user permissions: %+v", err))
+			abortWithLookupError(ctx, err)
+			return
+		}
+		if !grant.Has(roles.PermJobsReadAll) {
+			abortWithLookupError(ctx, ErrJobDoesNotExists)
+			return
+		}
+		deleted = true
+	}
+
+	events, total, err := persistence.ListJobEvents(jobId, limit, offset)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve job history: %+v", err))
 		status := http.StatusInternalServerError
 		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
 			"message": "Internal server error"})
 		return
 	}
+	// a 404 is only returned for deleted jobs if the job has no history
+	if deleted && total == 0 {
+		abortWithLookupError(ctx, ErrJobDoesNotExists)
+		return
+	}
 	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
-		"message": "Successfully updated job"})
+		"events": events, "total": total, "limit": limit, "offset": offset})
 }
 
 func PatchJobMetaHandler(ctx *gin.Context) {
@@ -282,6 +574,16 @@ func PatchJobMetaHandler(ctx *gin.Context) {
 		return
 	}
 
+	// parse expected job version from request headers
+	version, err := ParseIfMatch(ctx)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse If-Match header: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid If-Match header"})
+		return
+	}
+
 	var r struct {
 		Operation []map[string]interface{} `json:"operation" binding:"required"`
 	}
@@ -292,14 +594,23 @@ func PatchJobMetaHandler(ctx *gin.Context) {
 			"message": "Invalid request body"})
 		return
 	}
+	if _, err := AuthorizeJobRequest(ctx, jobId, UpdateJob); err != nil {
+		log.Error(fmt.Errorf("unable to retrieve job from database: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
 
-	if err := UpdateJobMetadata(jobId, r.Operation); err != nil {
+	if err := UpdateJobMetadata(jobId, version, r.Operation, ctx.MustGet("uid").(string)); err != nil {
 		log.Error(fmt.Errorf("unable to perform JSON patch: %+v", err))
 		switch err {
 		case ErrJobDoesNotExists:
 			status := http.StatusNotFound
 			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
 				"message": "Cannot find job with specified ID"})
+		case ErrJobVersionConflict:
+			status := http.StatusPreconditionFailed
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Job was modified by another request"})
 		case utils.ErrInvalidPatch:
 			status := http.StatusBadRequest
 			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
@@ -315,72 +626,64 @@ func PatchJobMetaHandler(ctx *gin.Context) {
 		"message": "Successfully patched job metadata"})
 }
 
-type FileUpload struct {
-	FileName string                 `json:"file_name"`
-	Meta     map[string]interface{} `json:"meta"`
-	Content  string                 `json:"content"`
-}
-
+// API handler used to add an attachment to a job. the attachment
+// is streamed directly to the filestore API
 func AddJobAttachmentHandler(ctx *gin.Context) {
 	log.Info("received request to add attachment to job")
-	jobId, err := ParseAndValidateJobId(ctx, "jobId")
+	jobId, err := ParseAndValidateJobId(ctx, "jobId", UpdateJob)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to validate job ID: %+v", err))
-		switch err {
-		case ErrInvalidJobID:
-			status := http.StatusBadRequest
-			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
-				"message": "Invalid job ID"})
-		case ErrJobDoesNotExists:
-			status := http.StatusNotFound
-			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
-				"message": "Cannot find job with specified ID"})
-		default:
-			status := http.StatusInternalServerError
-			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
-				"message": "Internal server error"})
-		}
+		abortWithLookupError(ctx, err)
 		return
 	}
-	// extract file from request and parse details
-	file, header, err := ctx.Request.FormFile("attachment")
+	// locate attachment in multipart body without buffering it
+	reader, err := ctx.Request.MultipartReader()
 	if err != nil {
-		log.Error(fmt.Errorf("unable to extract file from request: %+v", err))
+		log.Error(fmt.Errorf("unable to read multipart body: %+v", err))
 		status := http.StatusBadRequest
 		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
 			"message": "Invalid file upload"})
 		return
 	}
-
-	// convert file to bytes
-	bytes, err := utils.FileformToBytes(file)
-	if err != nil {
-		log.Error(fmt.Errorf("unable to convert file form to bytes: %+v", err))
-		status := http.StatusBadRequest
-		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
-			"message": "Internal server error"})
-		return
+	var file *multipart.Part
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			log.Error(fmt.Errorf("unable to extract file from request: %+v", err))
+			status := http.StatusBadRequest
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Invalid file upload"})
+			return
+		}
+		if part.FormName() == "attachment" && len(part.FileName()) > 0 {
+			file = part
+			break
+		}
 	}
 
-	upload := FileUpload{
-		FileName: header.Filename,
-		Meta: map[string]interface{}{
-			"job_id":   jobId,
-			"uploader": ctx.MustGet("uid").(string),
-		},
-		Content: utils.BytesToBase64(bytes),
-	}
-	// upload file to filestore API and retrieve file ID
-	uploadId, err := AddFileToFilestore(upload, serviceConfig.FilestoreHost)
+	meta := map[string]interface{}{
+		"job_id":   jobId,
+		"uploader": ctx.MustGet("uid").(string),
+	}
+	// stream file to filestore API and retrieve file ID
+	upload, err := serviceConfig.Filestore.UploadFile(ctx.Request.Context(), file.FileName(),
+		meta, file)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to add file to filestore: %+v", err))
-		status := http.StatusInternalServerError
-		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
-			"message": "Internal server error"})
+		switch err {
+		case filestore.ErrFileTooLarge:
+			status := http.StatusRequestEntityTooLarge
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Attachment exceeds maximum file size"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
 		return
 	}
 	// add file ID to attachments metadata for job
-	if err := AddJobAttachment(jobId, uploadId); err != nil {
+	if err := AddJobAttachment(jobId, upload.FileId, ctx.MustGet("uid").(string)); err != nil {
 		log.Error(fmt.Errorf("unable to add attachment to job metadata: %+v", err))
 		status := http.StatusInternalServerError
 		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
@@ -0,0 +1,68 @@
+package jobs
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/roles"
+)
+
+func (p *fakePersistence) CreateJob(job Job, actor string) (uuid.UUID, error) {
+	p.created = append(p.created, job)
+	return uuid.New(), nil
+}
+
+func TestCreateJobHandlerAuthorizesParent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	parent := Job{JobId: uuid.New(), State: InProgress, Version: 1,
+		Meta: map[string]interface{}{"creator": "creator"}}
+	grants := staticGrants{
+		"creator": roles.Grant{Permissions: []roles.Permission{roles.PermJobsCreate}},
+		"reader": roles.Grant{Permissions: []roles.Permission{roles.PermJobsCreate,
+			roles.PermJobsReadAll}},
+		"stranger": roles.Grant{Permissions: []roles.Permission{roles.PermJobsCreate}},
+	}
+	SetConfig(ServiceConfig{Roles: roles.NewRoleCache(grants, 0, 0)})
+
+	cases := []struct {
+		name   string
+		uid    string
+		status int
+	}{
+		{"parent updated by creator", "creator", http.StatusCreated},
+		// subtasks block their parent from completing, so reading the
+		// parent is not sufficient to add subtasks
+		{"parent only readable", "reader", http.StatusForbidden},
+		{"parent not visible", "stranger", http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := &fakePersistence{job: parent}
+			SetPersistence(p)
+
+			body, _ := json.Marshal(map[string]interface{}{"name": "subtask",
+				"due": time.Now().Add(time.Hour), "meta": map[string]interface{}{},
+				"parent_id": parent.JobId})
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest("POST", "/jobs/new", bytes.NewReader(body))
+			ctx.Request.Header.Set("Content-Type", "application/json")
+			ctx.Set("uid", c.uid)
+			CreateJobHandler(ctx)
+
+			if w.Code != c.status {
+				t.Fatalf("expected status %d, got %d: %s", c.status, w.Code, w.Body.String())
+			}
+			if created := c.status == http.StatusCreated; created != (len(p.created) == 1) {
+				t.Errorf("expected subtask to be created: %t, got %v", created, p.created)
+			}
+		})
+	}
+}
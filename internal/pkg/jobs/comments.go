@@ -0,0 +1,275 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/roles"
+)
+
+var ErrInvalidCommentID = errors.New("received invalid comment ID")
+
+// define pattern used to extract @uid mentions from comment bodies
+var mentionPattern = regexp.MustCompile(`(?:^|\s)@([A-Za-z0-9_.\-]+)`)
+
+// function used to extract the list of unique uids mentioned
+// in a markdown comment body
+func ParseMentions(body string) []string {
+	mentions, seen := []string{}, map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			mentions = append(mentions, match[1])
+		}
+	}
+	return mentions
+}
+
+// function used to parse a comment ID from the request path and
+// validate that the comment belongs to the given job
+func ParseAndValidateCommentId(ctx *gin.Context, key string, jobId uuid.UUID) (Comment, error) {
+	id, err := uuid.Parse(ctx.Param(key))
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse comment id: %+v", err))
+		return Comment{}, ErrInvalidCommentID
+	}
+
+	comment, err := persistence.GetComment(id)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve comment from database: %+v", err))
+		return comment, err
+	}
+	if comment.JobId != jobId {
+		log.Warn(fmt.Sprintf("comment %s does not belong to job %s", id, jobId))
+		return comment, ErrCommentDoesNotExists
+	}
+	return comment, nil
+}
+
+// function used to write error response for failed job and
+// comment lookups
+func abortWithLookupError(ctx *gin.Context, err error) {
+	switch err {
+	case ErrInvalidJobID:
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid job ID"})
+	case ErrInvalidCommentID:
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid comment ID"})
+	case ErrJobDoesNotExists:
+		status := http.StatusNotFound
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Cannot find job with specified ID"})
+	case ErrCommentDoesNotExists:
+		status := http.StatusNotFound
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Cannot find comment with specified ID"})
+	case ErrJobForbidden:
+		status := http.StatusForbidden
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Forbidden"})
+	default:
+		status := http.StatusInternalServerError
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Internal server error"})
+	}
+}
+
+// API handler used to add a new comment to a job
+func AddCommentHandler(ctx *gin.Context) {
+	log.Info("received request to add comment to job")
+	jobId, err := ParseAndValidateJobId(ctx, "jobId", ReadJob)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to validate job ID: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+
+	var r struct {
+		Body string `json:"body" binding:"required"`
+	}
+	if err := ctx.ShouldBind(&r); err != nil {
+		log.Error(fmt.Errorf("unable to parse request body: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid request body"})
+		return
+	}
+
+	comment := Comment{
+		JobId:    jobId,
+		Author:   ctx.MustGet("uid").(string),
+		Body:     r.Body,
+		Mentions: ParseMentions(r.Body),
+	}
+	id, err := persistence.CreateComment(comment)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to create comment: %+v", err))
+		status := http.StatusInternalServerError
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Internal server error"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"http_code": http.StatusCreated,
+		"message": "Successfully created comment", "id": id, "mentions": comment.Mentions})
+}
+
+// API handler used to list comments on a job
+func ListCommentsHandler(ctx *gin.Context) {
+	log.Info("received request to list comments on job")
+	jobId, err := ParseAndValidateJobId(ctx, "jobId", ReadJob)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to validate job ID: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+	limit, offset, err := ParsePagination(ctx)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse pagination parameters: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid pagination parameters"})
+		return
+	}
+
+	comments, total, err := persistence.ListComments(jobId, limit, offset)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve comments: %+v", err))
+		status := http.StatusInternalServerError
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Internal server error"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"comments": comments, "total": total, "limit": limit, "offset": offset})
+}
+
+// API handler used to edit a comment. only the author of the
+// comment is permitted to modify its body
+func EditCommentHandler(ctx *gin.Context) {
+	log.Info("received request to edit comment")
+	jobId, err := ParseAndValidateJobId(ctx, "jobId", ReadJob)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to validate job ID: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+	comment, err := ParseAndValidateCommentId(ctx, "commentId", jobId)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to validate comment ID: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+
+	uid := ctx.MustGet("uid").(string)
+	if comment.Author != uid {
+		log.Warn(fmt.Sprintf("user %s cannot edit comment %s", uid, comment.CommentId))
+		status := http.StatusForbidden
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Forbidden"})
+		return
+	}
+
+	var r struct {
+		Body string `json:"body" binding:"required"`
+	}
+	if err := ctx.ShouldBind(&r); err != nil {
+		log.Error(fmt.Errorf("unable to parse request body: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid request body"})
+		return
+	}
+
+	if err := persistence.UpdateComment(comment.CommentId, r.Body, ParseMentions(r.Body),
+		uid); err != nil {
+		log.Error(fmt.Errorf("unable to update comment: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"message": "Successfully updated comment"})
+}
+
+// API handler used to delete a comment. comments can be deleted
+// by their author or by users with the comments:moderate permission
+func DeleteCommentHandler(ctx *gin.Context) {
+	log.Info("received request to delete comment")
+	jobId, err := ParseAndValidateJobId(ctx, "jobId", ReadJob)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to validate job ID: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+	comment, err := ParseAndValidateCommentId(ctx, "commentId", jobId)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to validate comment ID: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+
+	uid := ctx.MustGet("uid").(string)
+	if comment.Author != uid {
+		grant, err := serviceConfig.Roles.GetUserGrant(ctx.Request.Context(), uid)
+		if err != nil {
+			log.Error(fmt.Errorf("unable to retrieve user permissions: %+v", err))
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+			return
+		}
+		if !grant.Has(roles.PermCommentsModerate) {
+			log.Warn(fmt.Sprintf("user %s cannot delete comment %s", uid, comment.CommentId))
+			status := http.StatusForbidden
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Forbidden"})
+			return
+		}
+	}
+
+	if err := persistence.DeleteComment(comment.CommentId); err != nil {
+		log.Error(fmt.Errorf("unable to delete comment: %+v", err))
+		status := http.StatusInternalServerError
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Internal server error"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"message": "Successfully deleted comment"})
+}
+
+// API handler used to retrieve the edit history of a comment
+func GetCommentHistoryHandler(ctx *gin.Context) {
+	log.Info("received request to retrieve comment history")
+	jobId, err := ParseAndValidateJobId(ctx, "jobId", ReadJob)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to validate job ID: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+	comment, err := ParseAndValidateCommentId(ctx, "commentId", jobId)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to validate comment ID: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+
+	revisions, err := persistence.ListCommentRevisions(comment.CommentId)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve comment revisions: %+v", err))
+		status := http.StatusInternalServerError
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Internal server error"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"comment": comment, "revisions": revisions})
+}
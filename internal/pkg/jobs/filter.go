@@ -0,0 +1,187 @@
+package jobs
+
+import (
+	b64 "encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrInvalidFilter = errors.New("received invalid job filter")
+	ErrInvalidCursor = errors.New("received invalid pagination cursor")
+)
+
+// define fields that job listings can be sorted by
+const (
+	SortByCreated = "created"
+	SortByDue     = "due"
+	SortByName    = "name"
+)
+
+// define struct used to filter, sort and paginate job listings.
+// all filters are optional and are combined with AND
+type JobFilter struct {
+	States     []JobState
+	AssignedTo string
+	// restricts AssignedTo to the given assignment role. jobs where the
+	// user holds any role are matched if no role is given
+	AssignmentRole AssignmentRole
+	DueAfter       *time.Time
+	DueBefore      *time.Time
+	CreatedAfter   *time.Time
+	CreatedBefore  *time.Time
+	Meta           map[string]string
+	SortBy         string
+	Descending     bool
+	Limit          int
+	Cursor         *JobCursor
+
+	// restricts jobs to the queues of the given teams. jobs are not
+	// filtered by team if no teams are given
+	Teams []uuid.UUID
+	// restricts jobs to jobs without an owner
+	Unclaimed bool
+}
+
+// define struct used to store position of last job returned in a
+// page of results. the value of the sort field and the job ID are
+// used to retrieve the next page via keyset pagination
+type JobCursor struct {
+	SortBy string    `json:"s"`
+	Value  string    `json:"v"`
+	JobId  uuid.UUID `json:"id"`
+}
+
+// define struct used to return a single page of jobs
+type JobPage struct {
+	Jobs       []Job  `json:"jobs"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      int    `json:"total"`
+}
+
+// function used to generate a cursor pointing at a given job
+func NewJobCursor(j Job, sortBy string) JobCursor {
+	cursor := JobCursor{SortBy: sortBy, JobId: j.JobId}
+	switch sortBy {
+	case SortByDue:
+		cursor.Value = j.Due.Format(time.RFC3339Nano)
+	case SortByName:
+		cursor.Value = j.Name
+	default:
+		cursor.Value = j.Created.Format(time.RFC3339Nano)
+	}
+	return cursor
+}
+
+// function used to encode a cursor into an opaque string
+func (c JobCursor) Encode() string {
+	body, _ := json.Marshal(c)
+	return b64.URLEncoding.EncodeToString(body)
+}
+
+// function used to decode an opaque cursor string
+func DecodeJobCursor(cursor string) (JobCursor, error) {
+	var c JobCursor
+	body, err := b64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(body, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// function used to parse a job filter from the query parameters
+// of a request. metadata filters are passed as meta.<key>=<value>
+func ParseJobFilter(ctx *gin.Context) (JobFilter, error) {
+	filter := JobFilter{
+		Meta:       map[string]string{},
+		SortBy:     ctx.DefaultQuery("sort", SortByCreated),
+		Descending: ctx.DefaultQuery("order", "desc") == "desc",
+		Limit:      DefaultPageSize,
+	}
+
+	switch filter.SortBy {
+	case SortByCreated, SortByDue, SortByName:
+	default:
+		log.Error(fmt.Errorf("received invalid sort field %s", filter.SortBy))
+		return filter, ErrInvalidFilter
+	}
+	if order := ctx.DefaultQuery("order", "desc"); order != "asc" && order != "desc" {
+		log.Error(fmt.Errorf("received invalid sort order %s", order))
+		return filter, ErrInvalidFilter
+	}
+
+	if limit, ok := ctx.GetQuery("limit"); ok {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 || l > MaxPageSize {
+			log.Error(fmt.Errorf("received invalid page size %s", limit))
+			return filter, ErrInvalidFilter
+		}
+		filter.Limit = l
+	}
+
+	// states can be passed either as repeated or comma separated values
+	for _, param := range ctx.QueryArray("state") {
+		for _, value := range strings.Split(param, ",") {
+			state, err := strconv.Atoi(value)
+			if err != nil || !JobState(state).IsValid() {
+				log.Error(fmt.Errorf("received invalid state filter %s", value))
+				return filter, ErrInvalidFilter
+			}
+			filter.States = append(filter.States, JobState(state))
+		}
+	}
+	filter.AssignedTo = ctx.Query("assigned_to")
+	filter.AssignmentRole = AssignmentRole(ctx.Query("assignment_role"))
+	if len(filter.AssignmentRole) > 0 && !filter.AssignmentRole.IsValid() {
+		log.Error(fmt.Errorf("received invalid assignment role %s", filter.AssignmentRole))
+		return filter, ErrInvalidFilter
+	}
+
+	timestamps := map[string]**time.Time{
+		"due_after":      &filter.DueAfter,
+		"due_before":     &filter.DueBefore,
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+	}
+	for key, target := range timestamps {
+		if value, ok := ctx.GetQuery(key); ok {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				log.Error(fmt.Errorf("received invalid timestamp for %s: %+v", key, err))
+				return filter, ErrInvalidFilter
+			}
+			*target = &t
+		}
+	}
+
+	for key, values := range ctx.Request.URL.Query() {
+		if strings.HasPrefix(key, "meta.") && len(values) > 0 {
+			filter.Meta[strings.TrimPrefix(key, "meta.")] = values[0]
+		}
+	}
+
+	if value, ok := ctx.GetQuery("cursor"); ok {
+		cursor, err := DecodeJobCursor(value)
+		if err != nil {
+			return filter, err
+		}
+		// cursors are only valid for the sort field they were generated with
+		if cursor.SortBy != filter.SortBy {
+			log.Error(fmt.Errorf("received cursor for sort field %s", cursor.SortBy))
+			return filter, ErrInvalidCursor
+		}
+		filter.Cursor = &cursor
+	}
+	return filter, nil
+}
@@ -0,0 +1,108 @@
+package jobs
+
+import (
+	b64 "encoding/base64"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestJobCursor(t *testing.T) {
+	due := time.Date(2021, 3, 1, 9, 30, 0, 500, time.UTC)
+	job := Job{JobId: uuid.New(), Name: "job", Created: due.Add(-time.Hour), Due: due}
+	expected := map[string]string{
+		SortByCreated: "2021-03-01T08:30:00.0000005Z",
+		SortByDue:     "2021-03-01T09:30:00.0000005Z",
+		SortByName:    "job",
+	}
+	for sortBy, value := range expected {
+		cursor := NewJobCursor(job, sortBy)
+		if cursor.Value != value || cursor.JobId != job.JobId {
+			t.Errorf("unexpected cursor for sort field %s: %+v", sortBy, cursor)
+		}
+		decoded, err := DecodeJobCursor(cursor.Encode())
+		if err != nil || decoded != cursor {
+			t.Errorf("expected cursor %+v to be decoded, got %+v (%v)", cursor, decoded, err)
+		}
+	}
+
+	malformed := []string{
+		"",
+		"not base64!",
+		b64.RawURLEncoding.EncodeToString([]byte(`{"s":"name","v":"job"}`)),
+		b64.URLEncoding.EncodeToString([]byte("not json")),
+		b64.URLEncoding.EncodeToString([]byte(`{"s":"name","v":"job","id":"not-a-uuid"}`)),
+		b64.URLEncoding.EncodeToString([]byte(`["name","job"]`)),
+	}
+	for _, value := range malformed {
+		if _, err := DecodeJobCursor(value); err != ErrInvalidCursor {
+			t.Errorf("expected cursor %q to be invalid, got %v", value, err)
+		}
+	}
+}
+
+func TestParseJobFilter(t *testing.T) {
+	after := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	byName := NewJobCursor(Job{JobId: uuid.New(), Name: "job"}, SortByName)
+
+	cases := []struct {
+		name     string
+		query    string
+		expected JobFilter
+	}{
+		{"defaults", "", JobFilter{Meta: map[string]string{}, SortBy: SortByCreated,
+			Descending: true, Limit: DefaultPageSize}},
+		{"sort and order", "sort=due&order=asc&limit=500", JobFilter{Meta: map[string]string{},
+			SortBy: SortByDue, Limit: MaxPageSize}},
+		{"states", "state=1,4&state=6&limit=1", JobFilter{Meta: map[string]string{},
+			SortBy: SortByCreated, Descending: true, Limit: 1,
+			States: []JobState{Assigned, InProgress, Blocked}}},
+		{"assignments and metadata", "assigned_to=user-1&assignment_role=reviewer&meta.site=berlin",
+			JobFilter{Meta: map[string]string{"site": "berlin"}, SortBy: SortByCreated,
+				Descending: true, Limit: DefaultPageSize, AssignedTo: "user-1",
+				AssignmentRole: ReviewerRole}},
+		{"timestamps", "due_after=2021-03-01T00:00:00Z&created_before=2021-03-01T01:00:00%2B01:00",
+			JobFilter{Meta: map[string]string{}, SortBy: SortByCreated, Descending: true,
+				Limit: DefaultPageSize, DueAfter: &after, CreatedBefore: &after}},
+		{"cursor", "sort=name&cursor=" + byName.Encode(), JobFilter{Meta: map[string]string{},
+			SortBy: SortByName, Descending: true, Limit: DefaultPageSize, Cursor: &byName}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			filter, err := ParseJobFilter(newQueryContext(c.query, nil))
+			if err != nil {
+				t.Fatalf("unable to parse filter: %+v", err)
+			}
+			// timestamps are compared by instant rather than location
+			for _, ts := range []*time.Time{filter.DueAfter, filter.CreatedBefore} {
+				if ts != nil && ts.Equal(after) {
+					*ts = after
+				}
+			}
+			if !reflect.DeepEqual(filter, c.expected) {
+				t.Errorf("expected filter %+v, got %+v", c.expected, filter)
+			}
+		})
+	}
+
+	invalid := map[string]error{
+		"sort=owner":                         ErrInvalidFilter,
+		"order=up":                           ErrInvalidFilter,
+		"limit=0":                            ErrInvalidFilter,
+		"limit=501":                          ErrInvalidFilter,
+		"limit=ten":                          ErrInvalidFilter,
+		"state=8":                            ErrInvalidFilter,
+		"state=1,":                           ErrInvalidFilter,
+		"assignment_role=watcher":            ErrInvalidFilter,
+		"due_before=2021-03-01":              ErrInvalidFilter,
+		"cursor=invalid":                     ErrInvalidCursor,
+		"sort=due&cursor=" + byName.Encode(): ErrInvalidCursor,
+	}
+	for query, expected := range invalid {
+		if _, err := ParseJobFilter(newQueryContext(query, nil)); err != expected {
+			t.Errorf("expected query %q to return %v, got %v", query, expected, err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package jobs
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// function used to retrieve the list of jobs that prevent a job from
+// being moved into a given state. jobs can only be started once all of
+// their dependencies have been completed, and can only be completed once
+// all of their dependencies and subtasks have been completed
+func UnmetDependencies(jobId uuid.UUID, target JobState) ([]uuid.UUID, error) {
+	unmet := []uuid.UUID{}
+	if target != InProgress && target != Completed {
+		return unmet, nil
+	}
+
+	dependencies, err := persistence.ListUnmetDependencies(jobId)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve job dependencies: %+v", err))
+		return unmet, err
+	}
+	unmet = append(unmet, dependencies...)
+
+	if target == Completed {
+		subtasks, err := persistence.ListIncompleteSubtasks(jobId)
+		if err != nil {
+			log.Error(fmt.Errorf("unable to retrieve job subtasks: %+v", err))
+			return unmet, err
+		}
+		unmet = append(unmet, subtasks...)
+	}
+	return unmet, nil
+}
+
+// API handler used to add a blocking dependency to a job
+func AddDependencyHandler(ctx *gin.Context) {
+	log.Info("received request to add job dependency")
+	jobId, err := ParseAndValidateJobId(ctx, "jobId", UpdateJob)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to validate job ID: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+
+	var r struct {
+		DependsOn uuid.UUID `json:"depends_on" binding:"required"`
+	}
+	if err := ctx.ShouldBind(&r); err != nil {
+		log.Error(fmt.Errorf("unable to parse request body: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid request body"})
+		return
+	}
+
+	// the job that is depended on must be visible to the user
+	if _, err := AuthorizeJobRequest(ctx, r.DependsOn, ReadJob); err != nil {
+		log.Error(fmt.Errorf("unable to retrieve dependency: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+
+	if err := persistence.AddDependency(jobId, r.DependsOn,
+		ctx.MustGet("uid").(string)); err != nil {
+		log.Error(fmt.Errorf("unable to add job dependency: %+v", err))
+		switch err {
+		case ErrDependencyCycle:
+			status := http.StatusConflict
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Dependency would introduce a cycle"})
+		default:
+			abortWithLookupError(ctx, err)
+		}
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"http_code": http.StatusCreated,
+		"message": "Successfully added dependency"})
+}
+
+// API handler used to remove a blocking dependency from a job
+func RemoveDependencyHandler(ctx *gin.Context) {
+	log.Info("received request to remove job dependency")
+	jobId, err := ParseAndValidateJobId(ctx, "jobId", UpdateJob)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to validate job ID: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+	dependsOn, err := uuid.Parse(ctx.Param("dependencyId"))
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse dependency ID: %+v", err))
+		abortWithLookupError(ctx, ErrInvalidJobID)
+		return
+	}
+
+	if err := persistence.RemoveDependency(jobId, dependsOn,
+		ctx.MustGet("uid").(string)); err != nil {
+		log.Error(fmt.Errorf("unable to remove job dependency: %+v", err))
+		switch err {
+		case ErrDependencyNotFound:
+			status := http.StatusNotFound
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Cannot find dependency"})
+		default:
+			abortWithLookupError(ctx, err)
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"message": "Successfully removed dependency"})
+}
+
+// API handler used to retrieve the dependency graph of a job
+func GetJobGraphHandler(ctx *gin.Context) {
+	log.Info("received request to retrieve job graph")
+	jobId, err := ParseAndValidateJobId(ctx, "jobId", ReadJob)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to validate job ID: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+
+	graph, err := persistence.GetJobGraph(jobId)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve job graph: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+	// remove all jobs from the graph that are not visible to the user
+	if graph, err = filterJobGraph(ctx, graph); err != nil {
+		log.Error(fmt.Errorf("unable to filter job graph: %+v", err))
+		abortWithLookupError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"graph": graph})
+}
+
+// function used to remove all jobs that are not visible to the
+// requesting user from a job graph, along with all edges connected
+// to them. the root job is assumed to have already been authorized.
+// all other jobs in the graph are retrieved in a single query
+func filterJobGraph(ctx *gin.Context, graph JobGraph) (JobGraph, error) {
+	filtered := JobGraph{Root: graph.Root, Nodes: []JobNode{}, Edges: []JobEdge{}}
+	ids := []uuid.UUID{}
+	for _, n := range graph.Nodes {
+		if n.JobId != graph.Root {
+			ids = append(ids, n.JobId)
+		}
+	}
+	nodes, err := persistence.GetJobs(ids)
+	if err != nil {
+		return filtered, err
+	}
+	// teams of the user are only required if any job is queued for a team
+	queued := false
+	for _, j := range nodes {
+		queued = queued || j.TeamId != nil
+	}
+	p, err := RequestPrincipal(ctx, queued)
+	if err != nil {
+		return filtered, err
+	}
+
+	visible := map[uuid.UUID]bool{graph.Root: true}
+	for _, j := range nodes {
+		visible[j.JobId] = AuthorizeJob(p, j, ReadJob) == nil
+	}
+	for _, n := range graph.Nodes {
+		if visible[n.JobId] {
+			filtered.Nodes = append(filtered.Nodes, n)
+		}
+	}
+	for _, e := range graph.Edges {
+		if visible[e.From] && visible[e.To] {
+			filtered.Edges = append(filtered.Edges, e)
+		}
+	}
+	return filtered, nil
+}
@@ -0,0 +1,65 @@
+package jobs
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/roles"
+)
+
+func (p *fakePersistence) GetJobs(jobIds []uuid.UUID) ([]Job, error) {
+	p.batches++
+	results := []Job{}
+	for _, j := range p.batch {
+		for _, id := range jobIds {
+			if j.JobId == id {
+				results = append(results, j)
+			}
+		}
+	}
+	return results, nil
+}
+
+func TestFilterJobGraph(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	root, own, hidden, missing := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	p := &fakePersistence{batch: []Job{
+		{JobId: own, Meta: map[string]interface{}{"creator": "user-1"}},
+		{JobId: hidden, Meta: map[string]interface{}{"creator": "user-2"}},
+	}}
+	SetPersistence(p)
+	// jobs without teams are filtered without retrieving the teams of the user
+	SetConfig(ServiceConfig{Roles: roles.NewRoleCache(staticGrants{}, 0, 0)})
+
+	graph := JobGraph{Root: root,
+		Nodes: []JobNode{{JobId: root}, {JobId: own}, {JobId: hidden}, {JobId: missing}},
+		Edges: []JobEdge{
+			{From: root, To: own, Type: SubtaskEdge},
+			{From: root, To: hidden, Type: SubtaskEdge},
+			{From: own, To: hidden, Type: DependsOnEdge},
+			{From: missing, To: root, Type: DependsOnEdge},
+		},
+	}
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/jobs/"+root.String()+"/graph", nil)
+	ctx.Set("uid", "user-1")
+
+	filtered, err := filterJobGraph(ctx, graph)
+	if err != nil {
+		t.Fatalf("unable to filter graph: %+v", err)
+	}
+	expected := JobGraph{Root: root,
+		Nodes: []JobNode{{JobId: root}, {JobId: own}},
+		Edges: []JobEdge{{From: root, To: own, Type: SubtaskEdge}},
+	}
+	if !reflect.DeepEqual(filtered, expected) {
+		t.Errorf("expected graph %+v, got %+v", expected, filtered)
+	}
+	if p.batches != 1 {
+		t.Errorf("expected jobs in graph to be retrieved in a single batch, got %d", p.batches)
+	}
+}
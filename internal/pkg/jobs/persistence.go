@@ -1,23 +1,98 @@
 package jobs
 
 import (
+	"encoding/json"
 	"errors"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-var ErrJobDoesNotExists = errors.New("cannot find job with specified ID")
+var (
+	ErrJobDoesNotExists     = errors.New("cannot find job with specified ID")
+	ErrCommentDoesNotExists = errors.New("cannot find comment with specified ID")
+	ErrJobStateConflict     = errors.New("job state was modified by another request")
+	ErrDependencyCycle      = errors.New("dependency would introduce a cycle")
+	ErrDependencyNotFound   = errors.New("cannot find dependency between specified jobs")
+	ErrTemplateDoesNotExist = errors.New("cannot find template with specified ID")
+	ErrDuplicateOccurrence  = errors.New("job has already been generated for occurrence")
+	ErrJobVersionConflict   = errors.New("job has been modified by another request")
+	ErrAssignmentNotFound   = errors.New("user is not assigned to job")
+	ErrJobNotQueued         = errors.New("job is not queued for team")
+	ErrJobAlreadyClaimed    = errors.New("job has already been claimed")
+)
 
 type Persistence interface {
 	GetJob(jobId uuid.UUID) (Job, error)
-	ListJobs() ([]Job, error)
-	ListUserJobs(uid string) ([]Job, error)
-	CreateJob(job Job) (uuid.UUID, error)
-	AssignJob(jobId uuid.UUID, uid string) error
-	AlterJobState(jobId uuid.UUID, state int) error
-	UpdateJobMeta(jobId uuid.UUID, meta map[string]interface{}) error
-	DeleteJob(jobId uuid.UUID) error
+	// retrieves multiple jobs in a single query. jobs that do not exist
+	// are omitted and the completion of subtasks is not evaluated
+	GetJobs(jobIds []uuid.UUID) ([]Job, error)
+	ListJobs(filter JobFilter) (JobPage, error)
+	ListUserJobs(uid string, filter JobFilter) (JobPage, error)
+	CreateJob(job Job, actor string) (uuid.UUID, error)
+	// mutations accept the expected version of the job and fail with
+	// ErrJobVersionConflict if the job has since been modified. a
+	// version of 0 applies the mutation regardless of the version
+	AssignJob(jobId uuid.UUID, version int, uid string, role AssignmentRole, actor string) error
+	UnassignJob(jobId uuid.UUID, version int, uid, actor string) error
+	QueueJob(jobId uuid.UUID, version int, teamId uuid.UUID, actor string) error
+	ClaimJob(jobId uuid.UUID, version int, teams []uuid.UUID, uid string) error
+	AlterJobState(jobId uuid.UUID, version int, from, to JobState, actor string) error
+	UpdateJobMeta(jobId uuid.UUID, version int, meta map[string]interface{},
+		patch []map[string]interface{}, actor string) error
+	DeleteJob(jobId uuid.UUID, actor string) error
+	MarkOverdueJobs(now time.Time, limit int) ([]uuid.UUID, error)
+	ListJobEvents(jobId uuid.UUID, limit, offset int) ([]JobEvent, int, error)
+
+	CreateComment(comment Comment) (uuid.UUID, error)
+	GetComment(commentId uuid.UUID) (Comment, error)
+	ListComments(jobId uuid.UUID, limit, offset int) ([]Comment, int, error)
+	UpdateComment(commentId uuid.UUID, body string, mentions []string, editor string) error
+	DeleteComment(commentId uuid.UUID) error
+	ListCommentRevisions(commentId uuid.UUID) ([]CommentRevision, error)
+
+	AddDependency(jobId, dependsOn uuid.UUID, actor string) error
+	RemoveDependency(jobId, dependsOn uuid.UUID, actor string) error
+	ListUnmetDependencies(jobId uuid.UUID) ([]uuid.UUID, error)
+	ListIncompleteSubtasks(jobId uuid.UUID) ([]uuid.UUID, error)
+	GetJobGraph(jobId uuid.UUID) (JobGraph, error)
+
+	CreateTemplate(template JobTemplate) (uuid.UUID, error)
+	GetTemplate(templateId uuid.UUID) (JobTemplate, error)
+	ListTemplates() ([]JobTemplate, error)
+	DeleteTemplate(templateId uuid.UUID) error
+	ListDueTemplates(now time.Time) ([]JobTemplate, error)
+	UpdateTemplateOccurrence(templateId uuid.UUID, previous *time.Time,
+		last, next time.Time) error
+}
+
+// generate new type to store job event types
+type JobEventType string
+
+const (
+	CreatedEvent      JobEventType = "created"
+	StateChangedEvent JobEventType = "state_changed"
+	AssignedEvent     JobEventType = "assigned"
+	UnassignedEvent   JobEventType = "unassigned"
+	QueuedEvent       JobEventType = "queued"
+	ClaimedEvent      JobEventType = "claimed"
+	MetaUpdatedEvent  JobEventType = "meta_updated"
+	DeletedEvent      JobEventType = "deleted"
+	DependencyAdded   JobEventType = "dependency_added"
+	DependencyRemoved JobEventType = "dependency_removed"
+)
+
+// define struct used to store entries in the job history. old
+// and new values contain the fields of the job that were modified
+type JobEvent struct {
+	EventId   uuid.UUID                `json:"event_id"`
+	JobId     uuid.UUID                `json:"job_id"`
+	Actor     string                   `json:"actor"`
+	EventType JobEventType             `json:"event_type"`
+	OldValue  map[string]interface{}   `json:"old_value"`
+	NewValue  map[string]interface{}   `json:"new_value"`
+	Patch     []map[string]interface{} `json:"patch,omitempty"`
+	Created   time.Time                `json:"created"`
 }
 
 // generate new type to store job states as enum intergers
@@ -25,14 +100,26 @@ type JobState int
 
 // function used to convert job state into a string representation
 func (t JobState) String() string {
-	return [...]string{"Created", "Assigned", "Completed", "Overdue"}[t]
+	return [...]string{"Created", "Assigned", "Completed", "Overdue", "InProgress",
+		"Cancelled", "Blocked", "Reopened"}[t]
 }
 
+// function used to determine if job state is a known state
+func (t JobState) IsValid() bool {
+	return t >= Created && t <= Reopened
+}
+
+// note that new states must be appended to the end of the
+// enum since the integer values are persisted in the database
 const (
 	Created JobState = iota
 	Assigned
 	Completed
 	Overdue
+	InProgress
+	Cancelled
+	Blocked
+	Reopened
 )
 
 type Job struct {
@@ -43,4 +130,135 @@ type Job struct {
 	State    JobState               `json:"state"`
 	Created  time.Time              `json:"created"`
 	Assigned bool                   `json:"assigned"`
+	// list of users assigned to the job. jobs are considered assigned
+	// if they have an owner
+	Assignees []Assignment `json:"assignees"`
+	// team whose queue the job is assigned to. jobs without an owner
+	// can be claimed from the queue by members of the team
+	TeamId *uuid.UUID `json:"team_id,omitempty"`
+	// version is incremented on every modification of the job and
+	// is used for optimistic concurrency control
+	Version  int        `json:"version"`
+	ParentId *uuid.UUID `json:"parent_id,omitempty"`
+	// template and occurrence are only set for jobs generated from
+	// recurring templates. the pair is unique across all jobs
+	TemplateId *uuid.UUID `json:"template_id,omitempty"`
+	Occurrence *time.Time `json:"occurrence,omitempty"`
+	// percentage of completed subtasks. only set for jobs with subtasks
+	Completion *float64 `json:"completion,omitempty"`
+}
+
+// generate new type to store roles of users assigned to jobs
+type AssignmentRole string
+
+const (
+	OwnerRole    AssignmentRole = "owner"
+	ReviewerRole AssignmentRole = "reviewer"
+	HelperRole   AssignmentRole = "helper"
+)
+
+// function used to determine if assignment role is a known role
+func (r AssignmentRole) IsValid() bool {
+	return r == OwnerRole || r == ReviewerRole || r == HelperRole
+}
+
+// define struct used to store assignments of users to jobs. each
+// user holds a single role on a job, and each job has at most one owner
+type Assignment struct {
+	Uid      string         `json:"uid"`
+	Role     AssignmentRole `json:"role"`
+	Assigned time.Time      `json:"assigned"`
+}
+
+// define type of edges in job graph
+type JobEdgeType string
+
+const (
+	DependsOnEdge JobEdgeType = "depends_on"
+	SubtaskEdge   JobEdgeType = "subtask"
+)
+
+// define struct used to store node in job graph
+type JobNode struct {
+	JobId uuid.UUID `json:"job_id"`
+	Name  string    `json:"name"`
+	State JobState  `json:"state"`
+}
+
+// define struct used to store edge in job graph. for dependencies
+// the edge points from the job to the job it depends on, and for
+// subtasks the edge points from the parent to the subtask
+type JobEdge struct {
+	From uuid.UUID   `json:"from"`
+	To   uuid.UUID   `json:"to"`
+	Type JobEdgeType `json:"type"`
+}
+
+// define struct used to return the graph of jobs connected to a
+// given job via dependencies and subtasks
+type JobGraph struct {
+	Root  uuid.UUID `json:"root"`
+	Nodes []JobNode `json:"nodes"`
+	Edges []JobEdge `json:"edges"`
+}
+
+// define struct used to store comments on jobs. comment bodies
+// are stored as markdown and mentions contain the uids of all users
+// referenced in the body with @uid
+type Comment struct {
+	CommentId uuid.UUID  `json:"comment_id"`
+	JobId     uuid.UUID  `json:"job_id"`
+	Author    string     `json:"author"`
+	Body      string     `json:"body"`
+	Mentions  []string   `json:"mentions"`
+	Created   time.Time  `json:"created"`
+	Edited    *time.Time `json:"edited,omitempty"`
+}
+
+// define struct used to store previous versions of a comment
+type CommentRevision struct {
+	CommentId uuid.UUID `json:"comment_id"`
+	Body      string    `json:"body"`
+	Editor    string    `json:"editor"`
+	Created   time.Time `json:"created"`
+}
+
+// define struct used to store templates for recurring jobs. jobs are
+// generated from the template at every occurrence of the schedule,
+// and are due DueOffset after the occurrence
+type JobTemplate struct {
+	TemplateId      uuid.UUID              `json:"template_id"`
+	Name            string                 `json:"name" binding:"required"`
+	Meta            map[string]interface{} `json:"meta"`
+	DueOffset       Duration               `json:"due_offset"`
+	DefaultAssignee string                 `json:"default_assignee"`
+	Schedule        string                 `json:"schedule" binding:"required"`
+	Start           time.Time              `json:"start"`
+	Creator         string                 `json:"creator"`
+	Created         time.Time              `json:"created"`
+	LastOccurrence  *time.Time             `json:"last_occurrence"`
+	NextOccurrence  *time.Time             `json:"next_occurrence"`
+}
+
+// generate new type used to store durations in JSON as strings
+// using the format accepted by time.ParseDuration
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var value string
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
 }
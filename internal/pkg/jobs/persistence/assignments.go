@@ -0,0 +1,299 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/jobs"
+)
+
+// function used to lock a job row and validate its version. the
+// current state of the job is returned
+func lockJob(ctx context.Context, tx pgx.Tx, jobId uuid.UUID, version int) (jobs.JobState, error) {
+	var (
+		state   jobs.JobState
+		current int
+	)
+	query := `SELECT state,version FROM jobs WHERE id=$1 FOR UPDATE`
+	if err := tx.QueryRow(ctx, query, jobId).Scan(&state, &current); err != nil {
+		log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+		switch err {
+		case pgx.ErrNoRows:
+			return state, jobs.ErrJobDoesNotExists
+		default:
+			return state, err
+		}
+	}
+	if version != 0 && version != current {
+		return state, jobs.ErrJobVersionConflict
+	}
+	return state, nil
+}
+
+// function used to retrieve the current owner of a job along with
+// the role held by a given user. empty values are returned if the job
+// has no owner or the user is not assigned to the job
+func getAssignmentRoles(ctx context.Context, tx pgx.Tx, jobId uuid.UUID, uid string) (
+	string, jobs.AssignmentRole, error) {
+	var (
+		owner string
+		role  jobs.AssignmentRole
+	)
+	query := `SELECT uid,role FROM assigned_jobs WHERE id=$1 AND (uid=$2 OR role=$3)`
+	rows, err := tx.Query(ctx, query, jobId, uid, string(jobs.OwnerRole))
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve job assignments: %+v", err))
+		return owner, role, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			assignee       string
+			assignmentRole string
+		)
+		if err := rows.Scan(&assignee, &assignmentRole); err != nil {
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			return owner, role, err
+		}
+		if jobs.AssignmentRole(assignmentRole) == jobs.OwnerRole {
+			owner = assignee
+		}
+		if assignee == uid {
+			role = jobs.AssignmentRole(assignmentRole)
+		}
+	}
+	return owner, role, rows.Err()
+}
+
+// function used to update the state of a job after its owner has changed
+func updateOwner(ctx context.Context, tx pgx.Tx, jobId uuid.UUID, state jobs.JobState,
+	previous, owner string) (jobs.JobState, error) {
+	updated := jobs.OwnerChangedState(state, previous, owner)
+	query := `UPDATE jobs SET state=$1, assigned=$2, version=version+1 WHERE id=$3`
+	if _, err := tx.Exec(ctx, query, updated, len(owner) > 0, jobId); err != nil {
+		log.Error(fmt.Errorf("unable to modify job state: %+v", err))
+		return updated, err
+	}
+	return updated, nil
+}
+
+// db function used to assign a user to a job with a given role. if
+// the user is assigned as owner, any existing owner is replaced. each
+// user holds a single role on a job, so assigning a user that is
+// already assigned modifies their role
+func (db *PostgresPersistence) AssignJob(jobId uuid.UUID, version int, uid string,
+	role jobs.AssignmentRole, actor string) error {
+	log.Info(fmt.Sprintf("assigning job %s to user %s as %s...", jobId, uid, role))
+	return db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		state, err := lockJob(ctx, tx, jobId, version)
+		if err != nil {
+			return err
+		}
+		previous, previousRole, err := getAssignmentRoles(ctx, tx, jobId, uid)
+		if err != nil {
+			return err
+		}
+
+		// remove existing owner if job is reassigned to a different user
+		owner := previous
+		switch {
+		case role == jobs.OwnerRole:
+			owner = uid
+			if len(previous) > 0 && previous != uid {
+				query := `DELETE FROM assigned_jobs WHERE id=$1 AND uid=$2`
+				if _, err := tx.Exec(ctx, query, jobId, previous); err != nil {
+					log.Error(fmt.Errorf("unable to remove previous owner: %+v", err))
+					return err
+				}
+			}
+		case previous == uid:
+			owner = ""
+		}
+
+		query := `INSERT INTO assigned_jobs(id,uid,role,assigned) VALUES($1,$2,$3,$4)
+		ON CONFLICT (id,uid) DO UPDATE SET role=$3`
+		if _, err := tx.Exec(ctx, query, jobId, uid, string(role), time.Now().UTC()); err != nil {
+			log.Error(fmt.Errorf("unable to assign job: %+v", err))
+			return err
+		}
+		updated, err := updateOwner(ctx, tx, jobId, state, previous, owner)
+		if err != nil {
+			return err
+		}
+		return insertJobEvent(ctx, tx, jobId, actor, jobs.AssignedEvent,
+			map[string]interface{}{"state": state, "owner": previous, "role": previousRole},
+			map[string]interface{}{"state": updated, "owner": owner, "uid": uid,
+				"role": role}, nil)
+	})
+}
+
+// db function used to remove a user from a job. jobs that lose
+// their owner are reset into the Created state
+func (db *PostgresPersistence) UnassignJob(jobId uuid.UUID, version int, uid, actor string) error {
+	log.Info(fmt.Sprintf("removing user %s from job %s...", uid, jobId))
+	return db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		state, err := lockJob(ctx, tx, jobId, version)
+		if err != nil {
+			return err
+		}
+
+		var role string
+		query := `DELETE FROM assigned_jobs WHERE id=$1 AND uid=$2 RETURNING role`
+		if err := tx.QueryRow(ctx, query, jobId, uid).Scan(&role); err != nil {
+			log.Error(fmt.Errorf("unable to remove assignment: %+v", err))
+			switch err {
+			case pgx.ErrNoRows:
+				return jobs.ErrAssignmentNotFound
+			default:
+				return err
+			}
+		}
+
+		previous, owner := "", ""
+		if jobs.AssignmentRole(role) == jobs.OwnerRole {
+			previous = uid
+		} else {
+			// owner is unchanged but the job is still updated to increment its version
+			previous, _, err = getAssignmentRoles(ctx, tx, jobId, uid)
+			if err != nil {
+				return err
+			}
+			owner = previous
+		}
+		updated, err := updateOwner(ctx, tx, jobId, state, previous, owner)
+		if err != nil {
+			return err
+		}
+		return insertJobEvent(ctx, tx, jobId, actor, jobs.UnassignedEvent,
+			map[string]interface{}{"state": state, "uid": uid, "role": role},
+			map[string]interface{}{"state": updated}, nil)
+	})
+}
+
+// function used to retrieve the assignees of a set of jobs
+func (db *PostgresPersistence) listAssignees(jobIds []uuid.UUID) (
+	map[uuid.UUID][]jobs.Assignment, error) {
+	results := map[uuid.UUID][]jobs.Assignment{}
+	query := `SELECT id,uid,role,assigned FROM assigned_jobs WHERE id = ANY($1)
+	ORDER BY assigned`
+	rows, err := db.Session.Query(context.Background(), query, jobIds)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve job assignments: %+v", err))
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			jobId uuid.UUID
+			a     jobs.Assignment
+			role  string
+		)
+		if err := rows.Scan(&jobId, &a.Uid, &role, &a.Assigned); err != nil {
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			return results, err
+		}
+		a.Role = jobs.AssignmentRole(role)
+		results[jobId] = append(results[jobId], a)
+	}
+	return results, rows.Err()
+}
+
+// db function used to assign a job to the queue of a team. any
+// existing owner is removed from the job so that the job can be
+// claimed by members of the team
+func (db *PostgresPersistence) QueueJob(jobId uuid.UUID, version int, teamId uuid.UUID,
+	actor string) error {
+	log.Info(fmt.Sprintf("assigning job %s to queue of team %s...", jobId, teamId))
+	return db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		state, err := lockJob(ctx, tx, jobId, version)
+		if err != nil {
+			return err
+		}
+		previous, _, err := getAssignmentRoles(ctx, tx, jobId, "")
+		if err != nil {
+			return err
+		}
+		var previousTeam *uuid.UUID
+		query := `SELECT team_id FROM jobs WHERE id=$1`
+		if err := tx.QueryRow(ctx, query, jobId).Scan(&previousTeam); err != nil {
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			return err
+		}
+
+		query = `DELETE FROM assigned_jobs WHERE id=$1 AND role=$2`
+		if _, err := tx.Exec(ctx, query, jobId, string(jobs.OwnerRole)); err != nil {
+			log.Error(fmt.Errorf("unable to remove previous owner: %+v", err))
+			return err
+		}
+		query = `UPDATE jobs SET team_id=$1 WHERE id=$2`
+		if _, err := tx.Exec(ctx, query, teamId, jobId); err != nil {
+			log.Error(fmt.Errorf("unable to assign job to team: %+v", err))
+			return err
+		}
+		updated, err := updateOwner(ctx, tx, jobId, state, previous, "")
+		if err != nil {
+			return err
+		}
+		return insertJobEvent(ctx, tx, jobId, actor, jobs.QueuedEvent,
+			map[string]interface{}{"state": state, "owner": previous, "team_id": previousTeam},
+			map[string]interface{}{"state": updated, "team_id": teamId}, nil)
+	})
+}
+
+// db function used by a user to claim a job from the queue of one
+// of their teams. the user is assigned as owner of the job, and the
+// claim fails if the job has already been claimed
+func (db *PostgresPersistence) ClaimJob(jobId uuid.UUID, version int, teams []uuid.UUID,
+	uid string) error {
+	log.Info(fmt.Sprintf("claiming job %s for user %s...", jobId, uid))
+	return db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		state, err := lockJob(ctx, tx, jobId, version)
+		if err != nil {
+			return err
+		}
+		var teamId *uuid.UUID
+		query := `SELECT team_id FROM jobs WHERE id=$1`
+		if err := tx.QueryRow(ctx, query, jobId).Scan(&teamId); err != nil {
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			return err
+		}
+		queued := false
+		for _, team := range teams {
+			if teamId != nil && *teamId == team {
+				queued = true
+			}
+		}
+		if !queued {
+			return jobs.ErrJobNotQueued
+		}
+		previous, previousRole, err := getAssignmentRoles(ctx, tx, jobId, uid)
+		if err != nil {
+			return err
+		}
+		if len(previous) > 0 {
+			return jobs.ErrJobAlreadyClaimed
+		}
+
+		query = `INSERT INTO assigned_jobs(id,uid,role,assigned) VALUES($1,$2,$3,$4)
+		ON CONFLICT (id,uid) DO UPDATE SET role=$3`
+		if _, err := tx.Exec(ctx, query, jobId, uid, string(jobs.OwnerRole),
+			time.Now().UTC()); err != nil {
+			log.Error(fmt.Errorf("unable to assign job: %+v", err))
+			return err
+		}
+		updated, err := updateOwner(ctx, tx, jobId, state, previous, uid)
+		if err != nil {
+			return err
+		}
+		return insertJobEvent(ctx, tx, jobId, uid, jobs.ClaimedEvent,
+			map[string]interface{}{"state": state, "role": previousRole},
+			map[string]interface{}{"state": updated, "owner": uid, "team_id": teamId}, nil)
+	})
+}
@@ -0,0 +1,164 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/jobs"
+)
+
+// db function used to create a new comment on a job
+func (db *PostgresPersistence) CreateComment(c jobs.Comment) (uuid.UUID, error) {
+	log.Debug(fmt.Sprintf("creating new comment on job %s", c.JobId))
+	id, now := uuid.New(), time.Now().UTC()
+
+	query := `INSERT INTO job_comments(comment_id,job_id,author,body,mentions,created)
+	VALUES($1,$2,$3,$4,$5,$6)`
+	_, err := db.Session.Exec(context.Background(), query, id, c.JobId, c.Author, c.Body,
+		c.Mentions, now)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to insert comment into database: %+v", err))
+		return id, err
+	}
+	return id, nil
+}
+
+// db function used to retrieve a comment with given comment ID
+func (db *PostgresPersistence) GetComment(commentId uuid.UUID) (jobs.Comment, error) {
+	log.Debug(fmt.Sprintf("fetching comment with ID %s", commentId))
+	var c jobs.Comment
+
+	query := `SELECT comment_id,job_id,author,body,mentions,created,edited
+	FROM job_comments WHERE comment_id=$1`
+	row := db.Session.QueryRow(context.Background(), query, commentId)
+	if err := row.Scan(&c.CommentId, &c.JobId, &c.Author, &c.Body, &c.Mentions,
+		&c.Created, &c.Edited); err != nil {
+		log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+		switch err {
+		case pgx.ErrNoRows:
+			return c, jobs.ErrCommentDoesNotExists
+		default:
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+// db function used to list a page of comments on a given job. the
+// total number of comments on the job is also returned
+func (db *PostgresPersistence) ListComments(jobId uuid.UUID, limit, offset int) (
+	[]jobs.Comment, int, error) {
+	log.Debug(fmt.Sprintf("fetching comments for job %s...", jobId))
+	results := []jobs.Comment{}
+
+	var total int
+	query := `SELECT COUNT(*) FROM job_comments WHERE job_id=$1`
+	if err := db.Session.QueryRow(context.Background(), query, jobId).Scan(&total); err != nil {
+		log.Error(fmt.Errorf("unable to count comments: %+v", err))
+		return results, total, err
+	}
+
+	query = `SELECT comment_id,job_id,author,body,mentions,created,edited
+	FROM job_comments WHERE job_id=$1 ORDER BY created LIMIT $2 OFFSET $3`
+	rows, err := db.Session.Query(context.Background(), query, jobId, limit, offset)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve data from database: %+v", err))
+		return results, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c jobs.Comment
+		if err := rows.Scan(&c.CommentId, &c.JobId, &c.Author, &c.Body, &c.Mentions,
+			&c.Created, &c.Edited); err != nil {
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			continue
+		}
+		results = append(results, c)
+	}
+	return results, total, nil
+}
+
+// db function used to modify the body of a comment. the previous
+// body is stored as a revision in the same transaction
+func (db *PostgresPersistence) UpdateComment(commentId uuid.UUID, body string,
+	mentions []string, editor string) error {
+	log.Debug(fmt.Sprintf("updating comment %s...", commentId))
+	ctx, now := context.Background(), time.Now().UTC()
+	return db.WithTransaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		var previous string
+		query := `SELECT body FROM job_comments WHERE comment_id=$1 FOR UPDATE`
+		if err := tx.QueryRow(ctx, query, commentId).Scan(&previous); err != nil {
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			switch err {
+			case pgx.ErrNoRows:
+				return jobs.ErrCommentDoesNotExists
+			default:
+				return err
+			}
+		}
+
+		query = `INSERT INTO job_comment_revisions(comment_id,body,editor,created)
+		VALUES($1,$2,$3,$4)`
+		if _, err := tx.Exec(ctx, query, commentId, previous, editor, now); err != nil {
+			log.Error(fmt.Errorf("unable to insert comment revision: %+v", err))
+			return err
+		}
+
+		query = `UPDATE job_comments SET body=$1, mentions=$2, edited=$3 WHERE comment_id=$4`
+		if _, err := tx.Exec(ctx, query, body, mentions, now, commentId); err != nil {
+			log.Error(fmt.Errorf("unable to update comment: %+v", err))
+			return err
+		}
+		return nil
+	})
+}
+
+// db function used to delete a comment along with its revisions
+func (db *PostgresPersistence) DeleteComment(commentId uuid.UUID) error {
+	log.Warn(fmt.Sprintf("deleting comment with ID %s", commentId))
+	return db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		query := `DELETE FROM job_comment_revisions WHERE comment_id=$1`
+		if _, err := tx.Exec(ctx, query, commentId); err != nil {
+			log.Error(fmt.Errorf("unable to delete comment revisions: %+v", err))
+			return err
+		}
+		query = `DELETE FROM job_comments WHERE comment_id=$1`
+		if _, err := tx.Exec(ctx, query, commentId); err != nil {
+			log.Error(fmt.Errorf("unable to delete comment: %+v", err))
+			return err
+		}
+		return nil
+	})
+}
+
+// db function used to list all previous versions of a comment
+func (db *PostgresPersistence) ListCommentRevisions(commentId uuid.UUID) (
+	[]jobs.CommentRevision, error) {
+	log.Debug(fmt.Sprintf("fetching revisions for comment %s...", commentId))
+	results := []jobs.CommentRevision{}
+
+	query := `SELECT comment_id,body,editor,created FROM job_comment_revisions
+	WHERE comment_id=$1 ORDER BY created DESC`
+	rows, err := db.Session.Query(context.Background(), query, commentId)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve data from database: %+v", err))
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r jobs.CommentRevision
+		if err := rows.Scan(&r.CommentId, &r.Body, &r.Editor, &r.Created); err != nil {
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			continue
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
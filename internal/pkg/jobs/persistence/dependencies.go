@@ -0,0 +1,216 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/jobs"
+)
+
+// define key of advisory lock used to serialize dependency inserts.
+// without the lock two concurrent inserts could each pass the cycle
+// check and together introduce a cycle
+const dependencyLockKey = 4783021
+
+// db function used to add a blocking dependency between two jobs.
+// the dependency is rejected if it would introduce a cycle
+func (db *PostgresPersistence) AddDependency(jobId, dependsOn uuid.UUID, actor string) error {
+	log.Info(fmt.Sprintf("adding dependency from job %s on job %s...", jobId, dependsOn))
+	if jobId == dependsOn {
+		return jobs.ErrDependencyCycle
+	}
+
+	return db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, dependencyLockKey); err != nil {
+			log.Error(fmt.Errorf("unable to acquire dependency lock: %+v", err))
+			return err
+		}
+
+		// ensure that both jobs exist before inserting dependency
+		var count int
+		query := `SELECT COUNT(*) FROM jobs WHERE id = ANY($1)`
+		if err := tx.QueryRow(ctx, query, []uuid.UUID{jobId, dependsOn}).Scan(&count); err != nil {
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			return err
+		}
+		if count != 2 {
+			return jobs.ErrJobDoesNotExists
+		}
+
+		// a cycle is introduced if the job can already be reached
+		// by following the dependencies of the new dependency
+		var cycle bool
+		query = `WITH RECURSIVE upstream(id) AS (
+			SELECT depends_on FROM job_dependencies WHERE job_id=$1
+			UNION
+			SELECT d.depends_on FROM job_dependencies d INNER JOIN upstream u ON d.job_id = u.id
+		) SELECT EXISTS (SELECT 1 FROM upstream WHERE id=$2)`
+		if err := tx.QueryRow(ctx, query, dependsOn, jobId).Scan(&cycle); err != nil {
+			log.Error(fmt.Errorf("unable to evaluate dependency cycle: %+v", err))
+			return err
+		}
+		if cycle {
+			log.Warn(fmt.Sprintf("dependency from %s on %s would introduce cycle", jobId, dependsOn))
+			return jobs.ErrDependencyCycle
+		}
+
+		query = `INSERT INTO job_dependencies(job_id,depends_on) VALUES($1,$2)
+		ON CONFLICT DO NOTHING`
+		if _, err := tx.Exec(ctx, query, jobId, dependsOn); err != nil {
+			log.Error(fmt.Errorf("unable to insert dependency: %+v", err))
+			return err
+		}
+		return insertJobEvent(ctx, tx, jobId, actor, jobs.DependencyAdded,
+			map[string]interface{}{},
+			map[string]interface{}{"depends_on": dependsOn}, nil)
+	})
+}
+
+// db function used to remove a blocking dependency between two jobs
+func (db *PostgresPersistence) RemoveDependency(jobId, dependsOn uuid.UUID, actor string) error {
+	log.Info(fmt.Sprintf("removing dependency from job %s on job %s...", jobId, dependsOn))
+	return db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		query := `DELETE FROM job_dependencies WHERE job_id=$1 AND depends_on=$2`
+		tag, err := tx.Exec(ctx, query, jobId, dependsOn)
+		if err != nil {
+			log.Error(fmt.Errorf("unable to delete dependency: %+v", err))
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return jobs.ErrDependencyNotFound
+		}
+		return insertJobEvent(ctx, tx, jobId, actor, jobs.DependencyRemoved,
+			map[string]interface{}{"depends_on": dependsOn},
+			map[string]interface{}{}, nil)
+	})
+}
+
+// db function used to list all direct dependencies of a job
+// that have not yet been completed
+func (db *PostgresPersistence) ListUnmetDependencies(jobId uuid.UUID) ([]uuid.UUID, error) {
+	log.Debug(fmt.Sprintf("fetching unmet dependencies for job %s...", jobId))
+	query := `SELECT d.depends_on FROM job_dependencies d INNER JOIN jobs j
+	ON j.id = d.depends_on WHERE d.job_id=$1 AND j.state <> $2`
+	return db.queryJobIds(query, jobId, jobs.Completed)
+}
+
+// db function used to list all subtasks of a job (including nested
+// subtasks) that have neither been completed nor cancelled
+func (db *PostgresPersistence) ListIncompleteSubtasks(jobId uuid.UUID) ([]uuid.UUID, error) {
+	log.Debug(fmt.Sprintf("fetching incomplete subtasks for job %s...", jobId))
+	query := `WITH RECURSIVE subtasks(id,state) AS (
+		SELECT id,state FROM jobs WHERE parent_id=$1
+		UNION ALL
+		SELECT j.id,j.state FROM jobs j INNER JOIN subtasks s ON j.parent_id = s.id
+	) SELECT id FROM subtasks WHERE state <> ALL($2)`
+	return db.queryJobIds(query, jobId, []int{int(jobs.Completed), int(jobs.Cancelled)})
+}
+
+// function used to execute a query returning a single column of job IDs
+func (db *PostgresPersistence) queryJobIds(query string, args ...interface{}) ([]uuid.UUID, error) {
+	results := []uuid.UUID{}
+	rows, err := db.Session.Query(context.Background(), query, args...)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve data from database: %+v", err))
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			return results, err
+		}
+		results = append(results, id)
+	}
+	return results, rows.Err()
+}
+
+// db function used to retrieve the graph of all jobs connected to a
+// given job. the graph contains the transitive dependencies of the job,
+// all jobs that transitively depend on it and all of its subtasks
+func (db *PostgresPersistence) GetJobGraph(jobId uuid.UUID) (jobs.JobGraph, error) {
+	log.Debug(fmt.Sprintf("fetching dependency graph for job %s...", jobId))
+	graph := jobs.JobGraph{Root: jobId, Nodes: []jobs.JobNode{}, Edges: []jobs.JobEdge{}}
+	if _, err := db.GetJob(jobId); err != nil {
+		return graph, err
+	}
+
+	query := `WITH RECURSIVE
+	upstream(job_id,depends_on) AS (
+		SELECT job_id,depends_on FROM job_dependencies WHERE job_id=$1
+		UNION
+		SELECT d.job_id,d.depends_on FROM job_dependencies d
+		INNER JOIN upstream u ON d.job_id = u.depends_on
+	),
+	downstream(job_id,depends_on) AS (
+		SELECT job_id,depends_on FROM job_dependencies WHERE depends_on=$1
+		UNION
+		SELECT d.job_id,d.depends_on FROM job_dependencies d
+		INNER JOIN downstream w ON d.depends_on = w.job_id
+	),
+	subtasks(parent_id,id) AS (
+		SELECT parent_id,id FROM jobs WHERE parent_id=$1
+		UNION
+		SELECT j.parent_id,j.id FROM jobs j INNER JOIN subtasks s ON j.parent_id = s.id
+	)
+	SELECT job_id,depends_on,$2::text FROM upstream
+	UNION SELECT job_id,depends_on,$2::text FROM downstream
+	UNION SELECT parent_id,id,$3::text FROM subtasks`
+	rows, err := db.Session.Query(context.Background(), query, jobId,
+		string(jobs.DependsOnEdge), string(jobs.SubtaskEdge))
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve data from database: %+v", err))
+		return graph, err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{jobId}
+	seen := map[uuid.UUID]bool{jobId: true}
+	for rows.Next() {
+		var (
+			edge     jobs.JobEdge
+			edgeType string
+		)
+		if err := rows.Scan(&edge.From, &edge.To, &edgeType); err != nil {
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			return graph, err
+		}
+		edge.Type = jobs.JobEdgeType(edgeType)
+		graph.Edges = append(graph.Edges, edge)
+		for _, id := range []uuid.UUID{edge.From, edge.To} {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return graph, err
+	}
+	rows.Close()
+
+	// retrieve details of all jobs contained in the graph
+	query = `SELECT id,name,state FROM jobs WHERE id = ANY($1) ORDER BY created`
+	nodes, err := db.Session.Query(context.Background(), query, ids)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve data from database: %+v", err))
+		return graph, err
+	}
+	defer nodes.Close()
+
+	for nodes.Next() {
+		var n jobs.JobNode
+		if err := nodes.Scan(&n.JobId, &n.Name, &n.State); err != nil {
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			return graph, err
+		}
+		graph.Nodes = append(graph.Nodes, n)
+	}
+	return graph, nodes.Err()
+}
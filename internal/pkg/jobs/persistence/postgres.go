@@ -3,16 +3,22 @@ package jobs
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/PSauerborn/gamma-project/internal/pkg/jobs"
 	"github.com/PSauerborn/gamma-project/internal/pkg/utils"
 	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	log "github.com/sirupsen/logrus"
 )
 
+// define postgres error code returned when unique constraints are violated
+const uniqueViolation = "23505"
+
 type PostgresPersistence struct {
 	*utils.BasePostgresPersistence
 }
@@ -25,12 +31,12 @@ func (db *PostgresPersistence) GetJob(jobId uuid.UUID) (jobs.Job, error) {
 		meta []byte
 	)
 
-	query := `SELECT name,due,meta,state,created,assigned FROM
-	jobs WHERE id=$1`
+	query := `SELECT name,due,meta,state,created,assigned,version,parent_id,template_id,
+	occurrence,team_id FROM jobs WHERE id=$1`
 	// get data from database and read into local variables
 	row := db.Session.QueryRow(context.Background(), query, jobId)
-	if err := row.Scan(&j.Name, &j.Due, &meta, &j.State,
-		&j.Created, &j.Assigned); err != nil {
+	if err := row.Scan(&j.Name, &j.Due, &meta, &j.State, &j.Created, &j.Assigned,
+		&j.Version, &j.ParentId, &j.TemplateId, &j.Occurrence, &j.TeamId); err != nil {
 		log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
 		switch err {
 		case pgx.ErrNoRows:
@@ -45,70 +51,201 @@ func (db *PostgresPersistence) GetJob(jobId uuid.UUID) (jobs.Job, error) {
 		return j, err
 	}
 	j.JobId = jobId
+
+	assignees, err := db.listAssignees([]uuid.UUID{jobId})
+	if err != nil {
+		return j, err
+	}
+	j.Assignees = append([]jobs.Assignment{}, assignees[jobId]...)
+
+	// evaluate completion percentage from all subtasks. cancelled
+	// subtasks are not included in the completion percentage
+	var total, completed int
+	query = `WITH RECURSIVE subtasks(id,state) AS (
+		SELECT id,state FROM jobs WHERE parent_id=$1
+		UNION ALL
+		SELECT j.id,j.state FROM jobs j INNER JOIN subtasks s ON j.parent_id = s.id
+	) SELECT COUNT(*) FILTER (WHERE state <> $2), COUNT(*) FILTER (WHERE state = $3)
+	FROM subtasks`
+	row = db.Session.QueryRow(context.Background(), query, jobId, jobs.Cancelled, jobs.Completed)
+	if err := row.Scan(&total, &completed); err != nil {
+		log.Error(fmt.Errorf("unable to evaluate subtask completion: %+v", err))
+		return j, err
+	}
+	if total > 0 {
+		completion := 100 * float64(completed) / float64(total)
+		j.Completion = &completion
+	}
 	return j, nil
 }
 
-// db function used to list a collection of jobs
-func (db *PostgresPersistence) ListJobs() ([]jobs.Job, error) {
-	log.Debug("fetching all jobs from database...")
+// db function used to retrieve multiple jobs by ID in a single query.
+// jobs that do not exist are omitted from the results
+func (db *PostgresPersistence) GetJobs(jobIds []uuid.UUID) ([]jobs.Job, error) {
+	log.Debug(fmt.Sprintf("fetching %d jobs by ID", len(jobIds)))
 	results := []jobs.Job{}
+	if len(jobIds) == 0 {
+		return results, nil
+	}
 
-	query := `SELECT id,name,due,meta,state,created,assigned FROM jobs`
-	rows, err := db.Session.Query(context.Background(), query)
+	query := `SELECT id,name,due,meta,state,created,assigned,version,parent_id,template_id,
+	occurrence,team_id FROM jobs WHERE id = ANY($1)`
+	rows, err := db.Session.Query(context.Background(), query, jobIds)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to retrieve data from database: %+v", err))
-		switch err {
-		case pgx.ErrNoRows:
-			return results, nil
-		default:
-			return results, err
-		}
+		return results, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var (
 			j    jobs.Job
 			meta []byte
 		)
-		if err := rows.Scan(&j.JobId, &j.Name, &j.Due, &meta, &j.State,
-			&j.Created, &j.Assigned); err != nil {
+		if err := rows.Scan(&j.JobId, &j.Name, &j.Due, &meta, &j.State, &j.Created,
+			&j.Assigned, &j.Version, &j.ParentId, &j.TemplateId, &j.Occurrence,
+			&j.TeamId); err != nil {
 			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
-			continue
+			return results, err
 		}
 		// convert metadata into JSON and add to struct
 		if err := json.Unmarshal(meta, &j.Meta); err != nil {
 			log.Error(fmt.Errorf("unable to parse JSON metadata: %+v", err))
-			continue
+			return results, err
 		}
 		results = append(results, j)
 	}
+	if err := rows.Err(); err != nil {
+		return results, err
+	}
+	rows.Close()
+
+	// retrieve assignees of all jobs in a single query
+	assignees, err := db.listAssignees(jobIds)
+	if err != nil {
+		return results, err
+	}
+	for i := range results {
+		results[i].Assignees = append([]jobs.Assignment{}, assignees[results[i].JobId]...)
+	}
 	return results, nil
 }
 
-func (db *PostgresPersistence) ListUserJobs(uid string) ([]jobs.Job, error) {
-	log.Debug(fmt.Sprintf("listing jobs for user %s...", uid))
-	results := []jobs.Job{}
+// define mapping between sort fields and database columns
+var sortColumns = map[string]string{
+	jobs.SortByCreated: "j.created",
+	jobs.SortByDue:     "j.due",
+	jobs.SortByName:    "j.name",
+}
 
-	query := `SELECT j.id,j.name,j.due,j.meta,j.state,j.created,j.assigned FROM jobs j
-	INNER JOIN assigned_jobs a ON a.id = j.id WHERE a.uid=$1`
-	rows, err := db.Session.Query(context.Background(), query, uid)
+// function used to translate a job filter into a SQL WHERE clause.
+// the clause for the cursor is returned separately since the total
+// count of jobs must be evaluated without it
+func buildJobFilter(filter jobs.JobFilter) (string, string, []interface{}, error) {
+	conditions, args := []string{"TRUE"}, []interface{}{}
+	// function used to add a new argument and return its placeholder
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if len(filter.States) > 0 {
+		states := []int{}
+		for _, state := range filter.States {
+			states = append(states, int(state))
+		}
+		conditions = append(conditions, fmt.Sprintf("j.state = ANY(%s)", arg(states)))
+	}
+	if len(filter.AssignedTo) > 0 {
+		role := "TRUE"
+		if len(filter.AssignmentRole) > 0 {
+			role = fmt.Sprintf("a.role = %s", arg(string(filter.AssignmentRole)))
+		}
+		conditions = append(conditions, fmt.Sprintf(`EXISTS (SELECT 1 FROM assigned_jobs a
+		WHERE a.id = j.id AND a.uid = %s AND %s)`, arg(filter.AssignedTo), role))
+	}
+	if len(filter.Teams) > 0 {
+		conditions = append(conditions, fmt.Sprintf("j.team_id = ANY(%s)", arg(filter.Teams)))
+	}
+	if filter.Unclaimed {
+		conditions = append(conditions, "NOT j.assigned")
+	}
+	if filter.DueAfter != nil {
+		conditions = append(conditions, fmt.Sprintf("j.due >= %s", arg(*filter.DueAfter)))
+	}
+	if filter.DueBefore != nil {
+		conditions = append(conditions, fmt.Sprintf("j.due < %s", arg(*filter.DueBefore)))
+	}
+	if filter.CreatedAfter != nil {
+		conditions = append(conditions, fmt.Sprintf("j.created >= %s", arg(*filter.CreatedAfter)))
+	}
+	if filter.CreatedBefore != nil {
+		conditions = append(conditions, fmt.Sprintf("j.created < %s", arg(*filter.CreatedBefore)))
+	}
+	for key, value := range filter.Meta {
+		conditions = append(conditions, fmt.Sprintf("j.meta->>%s = %s", arg(key), arg(value)))
+	}
+
+	cursor := "TRUE"
+	if filter.Cursor != nil {
+		var value interface{} = filter.Cursor.Value
+		if filter.SortBy != jobs.SortByName {
+			t, err := time.Parse(time.RFC3339Nano, filter.Cursor.Value)
+			if err != nil {
+				return "", "", args, jobs.ErrInvalidCursor
+			}
+			value = t
+		}
+		operator := ">"
+		if filter.Descending {
+			operator = "<"
+		}
+		cursor = fmt.Sprintf("(%s, j.id) %s (%s, %s)", sortColumns[filter.SortBy], operator,
+			arg(value), arg(filter.Cursor.JobId))
+	}
+	return strings.Join(conditions, " AND "), cursor, args, nil
+}
+
+// db function used to list a page of jobs matching a given filter
+func (db *PostgresPersistence) ListJobs(filter jobs.JobFilter) (jobs.JobPage, error) {
+	log.Debug(fmt.Sprintf("fetching jobs with filter %+v from database...", filter))
+	page := jobs.JobPage{Jobs: []jobs.Job{}}
+
+	where, cursor, args, err := buildJobFilter(filter)
+	if err != nil {
+		return page, err
+	}
+
+	// count total number of jobs matching filter without cursor
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM jobs j WHERE %s`, where)
+	if err := db.Session.QueryRow(context.Background(), query, args...).Scan(&page.Total); err != nil {
+		log.Error(fmt.Errorf("unable to count jobs: %+v", err))
+		return page, err
+	}
+
+	direction := "ASC"
+	if filter.Descending {
+		direction = "DESC"
+	}
+	// an additional row is fetched to determine if another page exists
+	query = fmt.Sprintf(`SELECT j.id,j.name,j.due,j.meta,j.state,j.created,j.assigned,
+	j.version,j.parent_id,j.template_id,j.occurrence,j.team_id FROM jobs j WHERE %s AND %s ORDER BY %s %s, j.id %s LIMIT %d`, where, cursor,
+		sortColumns[filter.SortBy], direction, direction, filter.Limit+1)
+	rows, err := db.Session.Query(context.Background(), query, args...)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to retrieve data from database: %+v", err))
-		switch err {
-		case pgx.ErrNoRows:
-			return results, nil
-		default:
-			return results, err
-		}
+		return page, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var (
 			j    jobs.Job
 			meta []byte
 		)
-		if err := rows.Scan(&j.JobId, &j.Name, &j.Due, &meta, &j.State,
-			&j.Created, &j.Assigned); err != nil {
+		if err := rows.Scan(&j.JobId, &j.Name, &j.Due, &meta, &j.State, &j.Created,
+			&j.Assigned, &j.Version, &j.ParentId, &j.TemplateId, &j.Occurrence,
+			&j.TeamId); err != nil {
 			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
 			continue
 		}
@@ -117,12 +254,44 @@ func (db *PostgresPersistence) ListUserJobs(uid string) ([]jobs.Job, error) {
 			log.Error(fmt.Errorf("unable to parse JSON metadata: %+v", err))
 			continue
 		}
-		results = append(results, j)
+		page.Jobs = append(page.Jobs, j)
 	}
-	return results, nil
+
+	rows.Close()
+
+	if len(page.Jobs) > filter.Limit {
+		page.Jobs = page.Jobs[:filter.Limit]
+		page.NextCursor = jobs.NewJobCursor(page.Jobs[filter.Limit-1], filter.SortBy).Encode()
+	}
+
+	// retrieve assignees of all jobs on page in a single query
+	ids := []uuid.UUID{}
+	for _, j := range page.Jobs {
+		ids = append(ids, j.JobId)
+	}
+	assignees, err := db.listAssignees(ids)
+	if err != nil {
+		return page, err
+	}
+	for i := range page.Jobs {
+		page.Jobs[i].Assignees = append([]jobs.Assignment{}, assignees[page.Jobs[i].JobId]...)
+	}
+	return page, nil
+}
+
+// db function used to list a page of jobs that a given user is
+// assigned to with any assignment role
+func (db *PostgresPersistence) ListUserJobs(uid string, filter jobs.JobFilter) (jobs.JobPage, error) {
+	log.Debug(fmt.Sprintf("listing jobs for user %s...", uid))
+	filter.AssignedTo = uid
+	return db.ListJobs(filter)
 }
 
-func (db *PostgresPersistence) UpdateJobMeta(jobId uuid.UUID, meta map[string]interface{}) error {
+// db function used to update the metadata of a job. the patch
+// operation that produced the new metadata is stored in the job
+// history along with the previous metadata
+func (db *PostgresPersistence) UpdateJobMeta(jobId uuid.UUID, version int,
+	meta map[string]interface{}, patch []map[string]interface{}, actor string) error {
 	log.Debug(fmt.Sprintf("updating metadata for %s with %+v...", jobId, meta))
 	metaJSON, err := json.Marshal(meta)
 	if err != nil {
@@ -130,13 +299,44 @@ func (db *PostgresPersistence) UpdateJobMeta(jobId uuid.UUID, meta map[string]in
 		return err
 	}
 
-	query := `UPDATE jobs SET meta=$1 WHERE id=$2`
-	_, err = db.Session.Exec(context.Background(), query, metaJSON, jobId)
-	return err
+	return db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		// retrieve current metadata and lock row until transaction completes
+		var (
+			previous     map[string]interface{}
+			previousJSON []byte
+			current      int
+		)
+		query := `SELECT meta,version FROM jobs WHERE id=$1 FOR UPDATE`
+		if err := tx.QueryRow(ctx, query, jobId).Scan(&previousJSON, &current); err != nil {
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			switch err {
+			case pgx.ErrNoRows:
+				return jobs.ErrJobDoesNotExists
+			default:
+				return err
+			}
+		}
+		if version != 0 && version != current {
+			return jobs.ErrJobVersionConflict
+		}
+		if err := json.Unmarshal(previousJSON, &previous); err != nil {
+			log.Error(fmt.Errorf("unable to parse JSON metadata: %+v", err))
+			return err
+		}
+
+		query = `UPDATE jobs SET meta=$1, version=version+1 WHERE id=$2`
+		if _, err := tx.Exec(ctx, query, metaJSON, jobId); err != nil {
+			log.Error(fmt.Errorf("unable to update job metadata: %+v", err))
+			return err
+		}
+		return insertJobEvent(ctx, tx, jobId, actor, jobs.MetaUpdatedEvent,
+			map[string]interface{}{"meta": previous},
+			map[string]interface{}{"meta": meta}, patch)
+	})
 }
 
 // db function used to create a new job
-func (db *PostgresPersistence) CreateJob(j jobs.Job) (uuid.UUID, error) {
+func (db *PostgresPersistence) CreateJob(j jobs.Job, actor string) (uuid.UUID, error) {
 	log.Debug(fmt.Sprintf("creating new job with values %+v", j))
 	// generate new uuid for job and record current time in UTC format
 	id, now := uuid.New(), time.Now().UTC()
@@ -150,51 +350,235 @@ func (db *PostgresPersistence) CreateJob(j jobs.Job) (uuid.UUID, error) {
 		return id, err
 	}
 
-	query := `INSERT INTO jobs(id,name,due,meta,state,created)
-	VALUES($1,$2,$3,$4,$5,$6)`
-	_, err = db.Session.Exec(context.Background(), query, id, j.Name, j.Due, meta, jobs.Created,
-		now)
-	if err != nil {
-		log.Error(fmt.Errorf("unable to insert job into database: %+v", err))
-		return id, err
-	}
-	return id, nil
+	err = db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		query := `INSERT INTO jobs(id,name,due,meta,state,created,parent_id,template_id,occurrence)
+		VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9)`
+		if _, err := tx.Exec(ctx, query, id, j.Name, j.Due, meta, jobs.Created, now, j.ParentId,
+			j.TemplateId, j.Occurrence); err != nil {
+			log.Error(fmt.Errorf("unable to insert job into database: %+v", err))
+			// jobs generated from templates are unique per occurrence
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+				return jobs.ErrDuplicateOccurrence
+			}
+			return err
+		}
+		return insertJobEvent(ctx, tx, id, actor, jobs.CreatedEvent,
+			map[string]interface{}{},
+			map[string]interface{}{"name": j.Name, "due": j.Due, "meta": j.Meta,
+				"state": jobs.Created, "parent_id": j.ParentId}, nil)
+	})
+	return id, err
 }
 
-// db function used to delete a job
-func (db *PostgresPersistence) DeleteJob(jobId uuid.UUID) error {
+// db function used to delete a job. note that the job history
+// is retained after the job itself has been removed
+func (db *PostgresPersistence) DeleteJob(jobId uuid.UUID, actor string) error {
 	log.Warn(fmt.Sprintf("deleting job with ID %+v", jobId))
-	query := `DELETE FROM jobs WHERE id=$1`
-	_, err := db.Session.Exec(context.Background(), query, jobId)
-	return err
+	return db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		var (
+			name  string
+			state jobs.JobState
+		)
+		query := `DELETE FROM jobs WHERE id=$1 RETURNING name,state`
+		if err := tx.QueryRow(ctx, query, jobId).Scan(&name, &state); err != nil {
+			log.Error(fmt.Errorf("unable to delete job: %+v", err))
+			switch err {
+			case pgx.ErrNoRows:
+				return jobs.ErrJobDoesNotExists
+			default:
+				return err
+			}
+		}
+		// remove dependencies on the job and detach any subtasks
+		query = `DELETE FROM job_dependencies WHERE job_id=$1 OR depends_on=$1`
+		if _, err := tx.Exec(ctx, query, jobId); err != nil {
+			log.Error(fmt.Errorf("unable to delete job dependencies: %+v", err))
+			return err
+		}
+		query = `UPDATE jobs SET parent_id=NULL WHERE parent_id=$1`
+		if _, err := tx.Exec(ctx, query, jobId); err != nil {
+			log.Error(fmt.Errorf("unable to detach subtasks: %+v", err))
+			return err
+		}
+		return insertJobEvent(ctx, tx, jobId, actor, jobs.DeletedEvent,
+			map[string]interface{}{"name": name, "state": state},
+			map[string]interface{}{}, nil)
+	})
 }
 
-// db function used to alter a job state
-func (db *PostgresPersistence) AlterJobState(jobId uuid.UUID, state int) error {
-	log.Info(fmt.Sprintf("updating job %s with state %d...", jobId, state))
-	query := `UPDATE jobs SET state=$1 WHERE id=$2`
-	_, err := db.Session.Exec(context.Background(), query, state, jobId)
-	return err
+// db function used to alter a job state. the job row is locked and
+// the current state compared against the expected state to prevent
+// concurrent requests from applying transitions to a job that has
+// since changed state
+func (db *PostgresPersistence) AlterJobState(jobId uuid.UUID, version int,
+	from, to jobs.JobState, actor string) error {
+	log.Info(fmt.Sprintf("updating job %s from state %s to %s...", jobId, from, to))
+	return db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		state, err := lockJob(ctx, tx, jobId, version)
+		if err != nil {
+			return err
+		}
+		if state != from {
+			return jobs.ErrJobStateConflict
+		}
+
+		query := `UPDATE jobs SET state=$1, version=version+1 WHERE id=$2`
+		if _, err := tx.Exec(ctx, query, to, jobId); err != nil {
+			log.Error(fmt.Errorf("unable to modify job state: %+v", err))
+			return err
+		}
+		return insertJobEvent(ctx, tx, jobId, actor, jobs.StateChangedEvent,
+			map[string]interface{}{"state": from},
+			map[string]interface{}{"state": to}, nil)
+	})
 }
 
-// db function to assign jobs to a given user
-func (db *PostgresPersistence) AssignJob(jobId uuid.UUID, uid string) error {
-	log.Info(fmt.Sprintf("updating job %s with state %s...", jobId, uid))
-	var query string
-	query = `UPDATE jobs SET state=$1, assigned=true WHERE id=$2`
-	_, err := db.Session.Exec(context.Background(), query, jobs.Assigned, jobId)
+// db function used to retrieve a page of events from the history
+// of a given job in reverse insertion order. the total number of
+// events is also returned
+func (db *PostgresPersistence) ListJobEvents(jobId uuid.UUID, limit, offset int) (
+	[]jobs.JobEvent, int, error) {
+	log.Debug(fmt.Sprintf("fetching history for job %s...", jobId))
+	results := []jobs.JobEvent{}
+
+	var total int
+	query := `SELECT COUNT(*) FROM job_events WHERE job_id=$1`
+	if err := db.Session.QueryRow(context.Background(), query, jobId).Scan(&total); err != nil {
+		log.Error(fmt.Errorf("unable to count job events: %+v", err))
+		return results, total, err
+	}
+
+	query = `SELECT event_id,job_id,actor,event_type,old_value,new_value,patch,created
+	FROM job_events WHERE job_id=$1 ORDER BY seq DESC LIMIT $2 OFFSET $3`
+	rows, err := db.Session.Query(context.Background(), query, jobId, limit, offset)
 	if err != nil {
-		log.Error(fmt.Errorf("unable to modify job state: %+v", err))
-		return err
+		log.Error(fmt.Errorf("unable to retrieve data from database: %+v", err))
+		return results, total, err
 	}
+	defer rows.Close()
 
-	query = `INSERT INTO assigned_jobs(id, uid) VALUES($1,$2)
-	ON CONFLICT (id) DO
-		UPDATE SET uid=$2`
-	_, err = db.Session.Exec(context.Background(), query, jobId, uid)
+	for rows.Next() {
+		var (
+			e                         jobs.JobEvent
+			oldValue, newValue, patch []byte
+		)
+		if err := rows.Scan(&e.EventId, &e.JobId, &e.Actor, &e.EventType, &oldValue,
+			&newValue, &patch, &e.Created); err != nil {
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			continue
+		}
+		if err := json.Unmarshal(oldValue, &e.OldValue); err != nil {
+			log.Error(fmt.Errorf("unable to parse JSON event: %+v", err))
+			continue
+		}
+		if err := json.Unmarshal(newValue, &e.NewValue); err != nil {
+			log.Error(fmt.Errorf("unable to parse JSON event: %+v", err))
+			continue
+		}
+		if patch != nil {
+			if err := json.Unmarshal(patch, &e.Patch); err != nil {
+				log.Error(fmt.Errorf("unable to parse JSON event: %+v", err))
+				continue
+			}
+		}
+		results = append(results, e)
+	}
+	return results, total, nil
+}
+
+// db function used to move all jobs that have passed their due date
+// into the Overdue state. rows are locked with SKIP LOCKED so that
+// multiple instances of the scheduler can run concurrently without
+// processing the same jobs twice
+func (db *PostgresPersistence) MarkOverdueJobs(now time.Time, limit int) ([]uuid.UUID, error) {
+	log.Debug(fmt.Sprintf("marking jobs due before %s as overdue...", now))
+	updated := []uuid.UUID{}
+
+	err := db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		eligible := []int{}
+		for _, state := range jobs.OverdueEligibleStates {
+			eligible = append(eligible, int(state))
+		}
+
+		query := `SELECT id,state FROM jobs WHERE due < $1 AND state = ANY($2)
+		ORDER BY due LIMIT $3 FOR UPDATE SKIP LOCKED`
+		rows, err := tx.Query(ctx, query, now, eligible, limit)
+		if err != nil {
+			log.Error(fmt.Errorf("unable to retrieve overdue jobs: %+v", err))
+			return err
+		}
+
+		previous := map[uuid.UUID]jobs.JobState{}
+		for rows.Next() {
+			var (
+				jobId uuid.UUID
+				state jobs.JobState
+			)
+			if err := rows.Scan(&jobId, &state); err != nil {
+				log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+				continue
+			}
+			previous[jobId] = state
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for jobId, state := range previous {
+			query = `UPDATE jobs SET state=$1, version=version+1 WHERE id=$2`
+			if _, err := tx.Exec(ctx, query, jobs.Overdue, jobId); err != nil {
+				log.Error(fmt.Errorf("unable to mark job %s as overdue: %+v", jobId, err))
+				return err
+			}
+			if err := insertJobEvent(ctx, tx, jobId, jobs.SchedulerActor, jobs.StateChangedEvent,
+				map[string]interface{}{"state": state},
+				map[string]interface{}{"state": jobs.Overdue}, nil); err != nil {
+				return err
+			}
+			updated = append(updated, jobId)
+		}
+		return nil
+	})
 	if err != nil {
-		log.Error(fmt.Errorf("unable to assign job: %+v", err))
+		return []uuid.UUID{}, err
+	}
+	return updated, nil
+}
+
+// function used to insert a new event into the job history. events
+// are inserted using the transaction that the mutation is executed in
+// so that the history cannot diverge from the state of the job
+func insertJobEvent(ctx context.Context, tx pgx.Tx, jobId uuid.UUID, actor string,
+	eventType jobs.JobEventType, oldValue, newValue map[string]interface{},
+	patch []map[string]interface{}) error {
+	oldJSON, err := json.Marshal(oldValue)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to convert event value to JSON: %+v", err))
 		return err
 	}
-	return nil
+	newJSON, err := json.Marshal(newValue)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to convert event value to JSON: %+v", err))
+		return err
+	}
+
+	// patch is only stored for events generated by JSON patch operations
+	var patchJSON []byte
+	if patch != nil {
+		if patchJSON, err = json.Marshal(patch); err != nil {
+			log.Error(fmt.Errorf("unable to convert event patch to JSON: %+v", err))
+			return err
+		}
+	}
+
+	query := `INSERT INTO job_events(event_id,job_id,actor,event_type,old_value,new_value,
+	patch,created) VALUES($1,$2,$3,$4,$5,$6,$7,$8)`
+	_, err = tx.Exec(ctx, query, uuid.New(), jobId, actor, string(eventType), oldJSON,
+		newJSON, patchJSON, time.Now().UTC())
+	if err != nil {
+		log.Error(fmt.Errorf("unable to insert job event: %+v", err))
+	}
+	return err
 }
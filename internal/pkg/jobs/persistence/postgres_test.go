@@ -0,0 +1,55 @@
+package jobs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/jobs"
+	"github.com/PSauerborn/gamma-project/internal/pkg/utils/pgtest"
+)
+
+func TestGetJobsUsesSingleQuery(t *testing.T) {
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	team := uuid.New()
+	now := time.Now()
+	rows := func(sql string, args []interface{}) [][]interface{} {
+		switch {
+		case strings.Contains(sql, "FROM jobs WHERE id = ANY"):
+			// the last job does not exist
+			return [][]interface{}{
+				{ids[0], "first", now, []byte(`{"creator":"creator"}`), int(jobs.Created),
+					now, false, 1, nil, nil, nil, nil},
+				{ids[1], "second", now, []byte(`{}`), int(jobs.Assigned), now, true, 2,
+					nil, nil, nil, &team},
+			}
+		case strings.Contains(sql, "FROM assigned_jobs WHERE id = ANY"):
+			return [][]interface{}{{ids[1], "user-1", string(jobs.OwnerRole), now}}
+		}
+		return nil
+	}
+	s := &pgtest.Session{Rows: rows}
+	results, err := newTestPersistence(s).GetJobs(ids)
+	if err != nil {
+		t.Fatalf("unable to get jobs: %+v", err)
+	}
+	if statements := len(s.Committed()); statements != 2 {
+		t.Errorf("expected jobs and assignees to be fetched in 2 queries, got %d", statements)
+	}
+	if len(results) != 2 || results[0].Meta["creator"] != "creator" ||
+		results[1].TeamId == nil || *results[1].TeamId != team {
+		t.Fatalf("unexpected jobs %+v", results)
+	}
+	if len(results[0].Assignees) != 0 || len(results[1].Assignees) != 1 ||
+		results[1].Assignees[0].Uid != "user-1" {
+		t.Errorf("unexpected assignees %+v, %+v", results[0].Assignees, results[1].Assignees)
+	}
+
+	s = &pgtest.Session{Rows: rows}
+	if results, err := newTestPersistence(s).GetJobs(nil); err != nil || len(results) != 0 ||
+		len(s.Committed()) != 0 {
+		t.Errorf("expected no queries for empty ID list, got %v (%v)", results, err)
+	}
+}
@@ -0,0 +1,149 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/jobs"
+)
+
+// define columns selected when retrieving templates
+const templateColumns = `template_id,name,meta,due_offset,default_assignee,schedule,start,
+creator,created,last_occurrence,next_occurrence`
+
+// function used to scan a template from a database row
+func scanTemplate(row pgx.Row) (jobs.JobTemplate, error) {
+	var (
+		t         jobs.JobTemplate
+		meta      []byte
+		dueOffset int64
+	)
+	if err := row.Scan(&t.TemplateId, &t.Name, &meta, &dueOffset, &t.DefaultAssignee,
+		&t.Schedule, &t.Start, &t.Creator, &t.Created, &t.LastOccurrence,
+		&t.NextOccurrence); err != nil {
+		return t, err
+	}
+	t.DueOffset = jobs.Duration{Duration: time.Duration(dueOffset) * time.Second}
+	if err := json.Unmarshal(meta, &t.Meta); err != nil {
+		log.Error(fmt.Errorf("unable to parse JSON metadata: %+v", err))
+		return t, err
+	}
+	return t, nil
+}
+
+// db function used to create a new job template
+func (db *PostgresPersistence) CreateTemplate(t jobs.JobTemplate) (uuid.UUID, error) {
+	log.Debug(fmt.Sprintf("creating new job template with values %+v", t))
+	id := uuid.New()
+	meta, err := json.Marshal(t.Meta)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to convert metadata to JSON: %+v", err))
+		return id, err
+	}
+
+	query := `INSERT INTO job_templates(template_id,name,meta,due_offset,default_assignee,
+	schedule,start,creator,created,next_occurrence) VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)`
+	_, err = db.Session.Exec(context.Background(), query, id, t.Name, meta,
+		int64(t.DueOffset.Seconds()), t.DefaultAssignee, t.Schedule, t.Start, t.Creator,
+		time.Now().UTC(), t.NextOccurrence)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to insert template into database: %+v", err))
+		return id, err
+	}
+	return id, nil
+}
+
+// db function used to retrieve a job template with given ID
+func (db *PostgresPersistence) GetTemplate(templateId uuid.UUID) (jobs.JobTemplate, error) {
+	log.Debug(fmt.Sprintf("fetching job template with ID %s", templateId))
+	query := fmt.Sprintf(`SELECT %s FROM job_templates WHERE template_id=$1`, templateColumns)
+	t, err := scanTemplate(db.Session.QueryRow(context.Background(), query, templateId))
+	if err != nil {
+		log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+		switch err {
+		case pgx.ErrNoRows:
+			return t, jobs.ErrTemplateDoesNotExist
+		default:
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+// db function used to list all job templates
+func (db *PostgresPersistence) ListTemplates() ([]jobs.JobTemplate, error) {
+	log.Debug("fetching all job templates from database...")
+	query := fmt.Sprintf(`SELECT %s FROM job_templates ORDER BY created`, templateColumns)
+	return db.queryTemplates(query)
+}
+
+// db function used to list all templates with an occurrence at or
+// before the given time. templates that have no further occurrences
+// are stored with a NULL next occurrence and are never returned
+func (db *PostgresPersistence) ListDueTemplates(now time.Time) ([]jobs.JobTemplate, error) {
+	log.Debug(fmt.Sprintf("fetching job templates due before %s...", now))
+	query := fmt.Sprintf(`SELECT %s FROM job_templates WHERE next_occurrence <= $1
+	ORDER BY next_occurrence`, templateColumns)
+	return db.queryTemplates(query, now)
+}
+
+// function used to execute a query returning a list of templates
+func (db *PostgresPersistence) queryTemplates(query string, args ...interface{}) (
+	[]jobs.JobTemplate, error) {
+	results := []jobs.JobTemplate{}
+	rows, err := db.Session.Query(context.Background(), query, args...)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve data from database: %+v", err))
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			continue
+		}
+		results = append(results, t)
+	}
+	return results, nil
+}
+
+// db function used to delete a job template. jobs that were
+// generated from the template are not modified
+func (db *PostgresPersistence) DeleteTemplate(templateId uuid.UUID) error {
+	log.Warn(fmt.Sprintf("deleting job template with ID %s", templateId))
+	query := `DELETE FROM job_templates WHERE template_id=$1`
+	tag, err := db.Session.Exec(context.Background(), query, templateId)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return jobs.ErrTemplateDoesNotExist
+	}
+	return nil
+}
+
+// db function used to record the last generated occurrence of a
+// template. the update is only applied if the last occurrence has
+// not been modified since it was read, which prevents concurrent
+// generators from moving the schedule backwards
+func (db *PostgresPersistence) UpdateTemplateOccurrence(templateId uuid.UUID,
+	previous *time.Time, last, next time.Time) error {
+	log.Debug(fmt.Sprintf("updating occurrence of template %s to %s", templateId, last))
+	var nextOccurrence *time.Time
+	if !next.IsZero() {
+		nextOccurrence = &next
+	}
+	query := `UPDATE job_templates SET last_occurrence=$1, next_occurrence=$2
+	WHERE template_id=$3 AND last_occurrence IS NOT DISTINCT FROM $4`
+	_, err := db.Session.Exec(context.Background(), query, last, nextOccurrence,
+		templateId, previous)
+	return err
+}
@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/jobs"
+	"github.com/PSauerborn/gamma-project/internal/pkg/utils"
+	"github.com/PSauerborn/gamma-project/internal/pkg/utils/pgtest"
+)
+
+func newTestPersistence(s *pgtest.Session) *PostgresPersistence {
+	return &PostgresPersistence{&utils.BasePostgresPersistence{Session: s}}
+}
+
+func TestAssignJobIsAtomic(t *testing.T) {
+	jobId := uuid.New()
+	rows := func(sql string, args []interface{}) [][]interface{} {
+		switch {
+		case strings.Contains(sql, "SELECT state,version FROM jobs"):
+			return [][]interface{}{{int(jobs.InProgress), 3}}
+		case strings.Contains(sql, "SELECT uid,role FROM assigned_jobs"):
+			return [][]interface{}{{"previous", string(jobs.OwnerRole)}}
+		}
+		return nil
+	}
+	// reassigning the owner removes the previous owner, inserts the
+	// assignment, updates the job and records an event
+	pgtest.CheckAtomic(t, rows, func(s *pgtest.Session) error {
+		return newTestPersistence(s).AssignJob(jobId, 3, "owner", jobs.OwnerRole, "actor")
+	})
+}
+
+func TestUpdateJobMetaIsAtomic(t *testing.T) {
+	jobId := uuid.New()
+	rows := func(sql string, args []interface{}) [][]interface{} {
+		if strings.Contains(sql, "SELECT meta,version FROM jobs") {
+			return [][]interface{}{{[]byte(`{"priority":"low"}`), 3}}
+		}
+		return nil
+	}
+	pgtest.CheckAtomic(t, rows, func(s *pgtest.Session) error {
+		return newTestPersistence(s).UpdateJobMeta(jobId, 3,
+			map[string]interface{}{"priority": "high"}, nil, "actor")
+	})
+}
+
+func TestUpdateJobMetaVersionConflictPersistsNothing(t *testing.T) {
+	s := &pgtest.Session{Rows: func(sql string, args []interface{}) [][]interface{} {
+		return [][]interface{}{{[]byte(`{}`), 4}}
+	}}
+	err := newTestPersistence(s).UpdateJobMeta(uuid.New(), 3, map[string]interface{}{}, nil, "actor")
+	if err != jobs.ErrJobVersionConflict {
+		t.Fatalf("expected version conflict, got %+v", err)
+	}
+	if len(s.Committed()) > 0 || s.Rollbacks() != 1 {
+		t.Errorf("expected transaction to be rolled back")
+	}
+}
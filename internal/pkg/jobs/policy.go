@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"errors"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/roles"
+	"github.com/google/uuid"
+)
+
+var ErrJobForbidden = errors.New("user is not permitted to modify job")
+
+// generate new type to store actions that users perform on jobs
+type JobAction int
+
+const (
+	// reading a job includes its history, graph and comments.
+	// commenting on a job only requires the job to be visible
+	ReadJob JobAction = iota
+	// updating a job includes its state, metadata, attachments
+	// and dependencies
+	UpdateJob
+)
+
+// define struct used to store the user that the job access policy
+// is evaluated for. teams are only required for jobs that have been
+// assigned to the queue of a team
+type Principal struct {
+	Uid   string
+	Grant roles.Grant
+	Teams []uuid.UUID
+}
+
+// function used to determine if a user created a job
+func (p Principal) IsCreator(j Job) bool {
+	creator, _ := j.Meta["creator"].(string)
+	return len(p.Uid) > 0 && creator == p.Uid
+}
+
+// function used to determine if a user is assigned to a job
+// with any assignment role
+func (p Principal) IsAssignee(j Job) bool {
+	for _, a := range j.Assignees {
+		if a.Uid == p.Uid {
+			return true
+		}
+	}
+	return false
+}
+
+// function used to determine if a job is queued for a team
+// that the user is a member of
+func (p Principal) InQueue(j Job) bool {
+	if j.TeamId == nil {
+		return false
+	}
+	for _, team := range p.Teams {
+		if team == *j.TeamId {
+			return true
+		}
+	}
+	return false
+}
+
+// function used to evaluate the job access policy. jobs are visible
+// to their creator, their assignees, members of the team the job is
+// queued for and users with the jobs:read_all permission. jobs can
+// only be updated by their creator, their assignees and users with
+// the jobs:update_all permission. ErrJobDoesNotExists is returned
+// for jobs that are not visible to the user so that the existence
+// of the job is not disclosed, and ErrJobForbidden is returned for
+// visible jobs that the user cannot update
+func AuthorizeJob(p Principal, j Job, action JobAction) error {
+	related := p.IsCreator(j) || p.IsAssignee(j)
+	if !related && !p.InQueue(j) && !p.Grant.Has(roles.PermJobsReadAll) {
+		return ErrJobDoesNotExists
+	}
+	switch action {
+	case ReadJob:
+		return nil
+	case UpdateJob:
+		if related || p.Grant.Has(roles.PermJobsUpdateAll) {
+			return nil
+		}
+	}
+	return ErrJobForbidden
+}
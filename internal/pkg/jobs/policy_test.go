@@ -0,0 +1,59 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/roles"
+)
+
+func TestAuthorizeJob(t *testing.T) {
+	team, otherTeam := uuid.New(), uuid.New()
+	job := Job{
+		JobId:     uuid.New(),
+		Meta:      map[string]interface{}{"creator": "creator"},
+		Assignees: []Assignment{{Uid: "owner", Role: OwnerRole}, {Uid: "reviewer", Role: ReviewerRole}},
+	}
+	queued := job
+	queued.TeamId = &team
+
+	readAll := roles.Grant{Permissions: []roles.Permission{roles.PermJobsReadAll}}
+	updateAll := roles.Grant{Permissions: []roles.Permission{
+		roles.PermJobsReadAll, roles.PermJobsUpdateAll}}
+	// jobs:update_all does not make jobs visible on its own
+	updateOnly := roles.Grant{Permissions: []roles.Permission{roles.PermJobsUpdateAll}}
+
+	cases := []struct {
+		name      string
+		principal Principal
+		job       Job
+		read      error
+		update    error
+	}{
+		{"creator", Principal{Uid: "creator"}, job, nil, nil},
+		{"owner", Principal{Uid: "owner"}, job, nil, nil},
+		{"reviewer", Principal{Uid: "reviewer"}, job, nil, nil},
+		{"team member", Principal{Uid: "member", Teams: []uuid.UUID{team}}, queued, nil, ErrJobForbidden},
+		{"member of other team", Principal{Uid: "member", Teams: []uuid.UUID{otherTeam}}, queued,
+			ErrJobDoesNotExists, ErrJobDoesNotExists},
+		{"team member of unqueued job", Principal{Uid: "member", Teams: []uuid.UUID{team}}, job,
+			ErrJobDoesNotExists, ErrJobDoesNotExists},
+		{"read all", Principal{Uid: "reader", Grant: readAll}, job, nil, ErrJobForbidden},
+		{"update all", Principal{Uid: "planner", Grant: updateAll}, job, nil, nil},
+		{"update all without read all", Principal{Uid: "planner", Grant: updateOnly}, job,
+			ErrJobDoesNotExists, ErrJobDoesNotExists},
+		{"stranger", Principal{Uid: "stranger"}, job, ErrJobDoesNotExists, ErrJobDoesNotExists},
+		{"anonymous", Principal{}, Job{Meta: map[string]interface{}{}}, ErrJobDoesNotExists, ErrJobDoesNotExists},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := AuthorizeJob(c.principal, c.job, ReadJob); err != c.read {
+				t.Errorf("read: expected %v, got %v", c.read, err)
+			}
+			if err := AuthorizeJob(c.principal, c.job, UpdateJob); err != c.update {
+				t.Errorf("update: expected %v, got %v", c.update, err)
+			}
+		})
+	}
+}
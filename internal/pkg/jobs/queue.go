@@ -0,0 +1,152 @@
+package jobs
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// function used to retrieve the IDs of all teams that a user is a
+// member of from the roles API
+func listUserTeamIds(ctx *gin.Context, uid string) ([]uuid.UUID, error) {
+	teams, err := serviceConfig.Teams.ListUserTeams(ctx.Request.Context(), uid)
+	if err != nil {
+		return nil, err
+	}
+	ids := []uuid.UUID{}
+	for _, team := range teams {
+		ids = append(ids, team.TeamId)
+	}
+	return ids, nil
+}
+
+// API handler used to list unclaimed jobs in the queues of all teams
+// that the requesting user is a member of. the queue of a single team
+// can be selected with the team query parameter. supports the same
+// query parameters as ListJobsHandler
+func ListQueuedJobsHandler(ctx *gin.Context) {
+	log.Info("received request to list queued jobs for user")
+	uid := ctx.MustGet("uid").(string)
+	filter, err := ParseJobFilter(ctx)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse job filter: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid query parameters"})
+		return
+	}
+	teams, err := listUserTeamIds(ctx, uid)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve teams of user: %+v", err))
+		status := http.StatusInternalServerError
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Internal server error"})
+		return
+	}
+	if value, ok := ctx.GetQuery("team"); ok {
+		teamId, err := uuid.Parse(value)
+		if err != nil {
+			log.Error(fmt.Errorf("unable to parse team ID: %+v", err))
+			status := http.StatusBadRequest
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Invalid query parameters"})
+			return
+		}
+		selected := []uuid.UUID{}
+		for _, team := range teams {
+			if team == teamId {
+				selected = append(selected, team)
+			}
+		}
+		teams = selected
+	}
+	// users that are not a member of any of the selected teams
+	// have an empty queue
+	if len(teams) == 0 {
+		ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+			"jobs": []Job{}, "next_cursor": "", "total": 0})
+		return
+	}
+	filter.Teams, filter.Unclaimed = teams, true
+
+	// get page of jobs from persistence layer
+	page, err := persistence.ListJobs(filter)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve jobs: %+v", err))
+		switch err {
+		case ErrInvalidCursor:
+			status := http.StatusBadRequest
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Invalid query parameters"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"jobs": page.Jobs, "next_cursor": page.NextCursor, "total": page.Total})
+}
+
+// API handler used to claim a job from the queue of a team. the
+// requesting user must be a member of the team, and is assigned as
+// owner of the job
+func ClaimJobHandler(ctx *gin.Context) {
+	log.Info("received request to claim job")
+	uid := ctx.MustGet("uid").(string)
+	// extract job ID from path and parse
+	jobId, err := uuid.Parse(ctx.Param("jobId"))
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse job ID: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid job ID"})
+		return
+	}
+	// parse expected job version from request headers
+	version, err := ParseIfMatch(ctx)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse If-Match header: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid If-Match header"})
+		return
+	}
+	teams, err := listUserTeamIds(ctx, uid)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve teams of user: %+v", err))
+		status := http.StatusInternalServerError
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Internal server error"})
+		return
+	}
+
+	if err := persistence.ClaimJob(jobId, version, teams, uid); err != nil {
+		log.Error(fmt.Errorf("unable to claim job: %+v", err))
+		switch err {
+		case ErrJobDoesNotExists, ErrJobNotQueued:
+			status := http.StatusNotFound
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Cannot find job in queue of user teams"})
+		case ErrJobAlreadyClaimed:
+			status := http.StatusConflict
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Job has already been claimed"})
+		case ErrJobVersionConflict:
+			status := http.StatusPreconditionFailed
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Job was modified by another request"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"message": "Successfully claimed job"})
+}
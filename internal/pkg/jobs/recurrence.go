@@ -0,0 +1,359 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrInvalidSchedule = errors.New("received invalid recurrence schedule")
+
+// define the maximum time span searched for the next occurrence of a
+// schedule. schedules without occurrences in this span are treated as
+// finished
+const maxScheduleSearch = 5 * 366 * 24 * time.Hour
+
+// define interface for recurrence rules. Next returns the first
+// occurrence strictly after the given time, or the zero time if
+// the schedule has no further occurrences
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+// function used to parse a recurrence schedule. schedules are either
+// five field cron expressions (minute hour day-of-month month day-of-week),
+// one of the cron macros @hourly, @daily, @weekly and @monthly, or a
+// subset of RFC 5545 RRULEs prefixed with RRULE:. the start time is used
+// to anchor the interval of RRULEs and all times are evaluated in UTC
+func ParseSchedule(expr string, start time.Time) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(strings.ToUpper(expr), "RRULE:") {
+		return parseRRule(expr[len("RRULE:"):], start.UTC())
+	}
+	return parseCron(expr)
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	// cron evaluates day fields with OR if both are restricted
+	domRestricted, dowRestricted bool
+}
+
+var cronMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// function used to parse a five field cron expression
+func parseCron(expr string) (Schedule, error) {
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, ErrInvalidSchedule
+	}
+
+	// note that day-of-week accepts both 0 and 7 for sunday
+	bounds := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	parsed := make([]map[int]bool, 5)
+	for i, field := range fields {
+		values, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, err
+		}
+		parsed[i] = values
+	}
+	if parsed[4][7] {
+		parsed[4][0] = true
+	}
+	return &cronSchedule{
+		minute:        parsed[0],
+		hour:          parsed[1],
+		dom:           parsed[2],
+		month:         parsed[3],
+		dow:           parsed[4],
+		domRestricted: fields[2] != "*",
+		dowRestricted: fields[4] != "*",
+	}, nil
+}
+
+// function used to parse a single cron field containing lists,
+// ranges and steps into the set of matching values
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s < 1 {
+				return nil, ErrInvalidSchedule
+			}
+			step, part = s, part[:i]
+		}
+
+		low, high := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			l, err := strconv.Atoi(bounds[0])
+			if err != nil {
+				return nil, ErrInvalidSchedule
+			}
+			h, err := strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, ErrInvalidSchedule
+			}
+			low, high = l, h
+		default:
+			v, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, ErrInvalidSchedule
+			}
+			low, high = v, v
+			// a single value with a step applies from the value to the maximum
+			if step > 1 {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, ErrInvalidSchedule
+		}
+		for v := low; v <= high; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom, dow := c.dom[t.Day()], c.dow[int(t.Weekday())]
+	if c.domRestricted && c.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+func (c *cronSchedule) Next(after time.Time) time.Time {
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxScheduleSearch)
+	for t.Before(limit) {
+		switch {
+		case !c.month[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !c.hour[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.UTC)
+		case !c.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+type rruleSchedule struct {
+	freq       string
+	interval   int
+	byDay      map[time.Weekday]bool
+	byMonthDay map[int]bool
+	byHour     []int
+	byMinute   []int
+	start      time.Time
+	until      time.Time
+	// maximum number of occurrences counted from the start of the rule
+	count int
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// function used to parse the supported subset of RRULEs. supported
+// parts are FREQ (DAILY, WEEKLY or MONTHLY), INTERVAL, BYDAY (without
+// ordinals), BYMONTHDAY, BYHOUR, BYMINUTE, UNTIL and COUNT
+func parseRRule(rule string, start time.Time) (Schedule, error) {
+	r := &rruleSchedule{
+		interval:   1,
+		byDay:      map[time.Weekday]bool{},
+		byMonthDay: map[int]bool{},
+		byHour:     []int{start.Hour()},
+		byMinute:   []int{start.Minute()},
+		start:      start.Truncate(time.Minute),
+	}
+	for _, part := range strings.Split(rule, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, ErrInvalidSchedule
+		}
+		key, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		var err error
+		switch key {
+		case "FREQ":
+			if value != "DAILY" && value != "WEEKLY" && value != "MONTHLY" {
+				return nil, ErrInvalidSchedule
+			}
+			r.freq = value
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(value)
+			if err != nil || r.interval < 1 {
+				return nil, ErrInvalidSchedule
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := rruleWeekdays[day]
+				if !ok {
+					return nil, ErrInvalidSchedule
+				}
+				r.byDay[weekday] = true
+			}
+		case "BYMONTHDAY":
+			days, err := parseIntList(value, 1, 31)
+			if err != nil {
+				return nil, err
+			}
+			for _, day := range days {
+				r.byMonthDay[day] = true
+			}
+		case "BYHOUR":
+			if r.byHour, err = parseIntList(value, 0, 23); err != nil {
+				return nil, err
+			}
+		case "BYMINUTE":
+			if r.byMinute, err = parseIntList(value, 0, 59); err != nil {
+				return nil, err
+			}
+		case "UNTIL":
+			if r.until, err = time.Parse("20060102T150405Z", value); err != nil {
+				return nil, ErrInvalidSchedule
+			}
+		case "COUNT":
+			r.count, err = strconv.Atoi(value)
+			if err != nil || r.count < 1 {
+				return nil, ErrInvalidSchedule
+			}
+		default:
+			log.Error(fmt.Errorf("received unsupported RRULE part %s", key))
+			return nil, ErrInvalidSchedule
+		}
+	}
+	// UNTIL and COUNT are mutually exclusive as defined by RFC 5545
+	if len(r.freq) == 0 || (r.count > 0 && !r.until.IsZero()) {
+		return nil, ErrInvalidSchedule
+	}
+	return r, nil
+}
+
+// function used to parse a comma separated list of integers
+func parseIntList(value string, min, max int) ([]int, error) {
+	values := []int{}
+	for _, v := range strings.Split(value, ",") {
+		i, err := strconv.Atoi(v)
+		if err != nil || i < min || i > max {
+			return nil, ErrInvalidSchedule
+		}
+		values = append(values, i)
+	}
+	sort.Ints(values)
+	return values, nil
+}
+
+// function used to determine if a given day is part of the rule
+func (r *rruleSchedule) dayMatches(day time.Time) bool {
+	startDay := time.Date(r.start.Year(), r.start.Month(), r.start.Day(), 0, 0, 0, 0, time.UTC)
+	switch r.freq {
+	case "DAILY":
+		days := int(day.Sub(startDay).Hours() / 24)
+		if days%r.interval != 0 {
+			return false
+		}
+		if len(r.byDay) > 0 && !r.byDay[day.Weekday()] {
+			return false
+		}
+		return len(r.byMonthDay) == 0 || r.byMonthDay[day.Day()]
+	case "WEEKLY":
+		// weeks are evaluated from monday as defined by RFC 5545
+		monday := func(t time.Time) time.Time {
+			return t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+		}
+		weeks := int(monday(day).Sub(monday(startDay)).Hours() / (24 * 7))
+		if weeks%r.interval != 0 {
+			return false
+		}
+		if len(r.byDay) > 0 {
+			return r.byDay[day.Weekday()]
+		}
+		return day.Weekday() == r.start.Weekday()
+	case "MONTHLY":
+		months := (day.Year()-startDay.Year())*12 + int(day.Month()) - int(startDay.Month())
+		if months%r.interval != 0 {
+			return false
+		}
+		if len(r.byMonthDay) > 0 {
+			return r.byMonthDay[day.Day()]
+		}
+		if len(r.byDay) > 0 {
+			return r.byDay[day.Weekday()]
+		}
+		return day.Day() == r.start.Day()
+	}
+	return false
+}
+
+func (r *rruleSchedule) Next(after time.Time) time.Time {
+	if r.count == 0 {
+		return r.next(after)
+	}
+	// occurrences are counted from the start of the rule, so all
+	// occurrences up to the given time are evaluated
+	t := r.start.Add(-time.Minute)
+	for i := 0; i < r.count; i++ {
+		if t = r.next(t); t.IsZero() || t.After(after) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// function used to retrieve the next occurrence of the rule without
+// applying the occurrence count
+func (r *rruleSchedule) next(after time.Time) time.Time {
+	after = after.UTC()
+	if after.Before(r.start) {
+		after = r.start.Add(-time.Minute)
+	}
+	day := time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, time.UTC)
+	limit := day.Add(maxScheduleSearch)
+	for ; day.Before(limit); day = day.AddDate(0, 0, 1) {
+		if !r.until.IsZero() && day.After(r.until) {
+			break
+		}
+		if !r.dayMatches(day) {
+			continue
+		}
+		for _, hour := range r.byHour {
+			for _, minute := range r.byMinute {
+				t := day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+				if !t.After(after) {
+					continue
+				}
+				if !r.until.IsZero() && t.After(r.until) {
+					return time.Time{}
+				}
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,198 @@
+package jobs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mustParseTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+// function used to list the next occurrences of a schedule in RFC 3339
+// format. finished schedules are listed with an empty occurrence
+func occurrences(s Schedule, after time.Time, n int) []string {
+	listed := []string{}
+	for i := 0; i < n; i++ {
+		after = s.Next(after)
+		if after.IsZero() {
+			return append(listed, "")
+		}
+		listed = append(listed, after.Format(time.RFC3339))
+	}
+	return listed
+}
+
+func TestCronSchedule(t *testing.T) {
+	cases := []struct {
+		name     string
+		expr     string
+		after    string
+		expected []string
+	}{
+		{"step", "*/15 * * * *", "2021-03-01T10:07:30Z", []string{
+			"2021-03-01T10:15:00Z", "2021-03-01T10:30:00Z", "2021-03-01T10:45:00Z",
+			"2021-03-01T11:00:00Z"}},
+		{"range with step", "0 9-17/4 * * *", "2021-03-01T00:00:00Z", []string{
+			"2021-03-01T09:00:00Z", "2021-03-01T13:00:00Z", "2021-03-01T17:00:00Z",
+			"2021-03-02T09:00:00Z"}},
+		{"value with step", "0 20/2 * * *", "2021-03-01T00:00:00Z", []string{
+			"2021-03-01T20:00:00Z", "2021-03-01T22:00:00Z", "2021-03-02T20:00:00Z"}},
+		{"list", "30 6 * * 1,3,5", "2021-03-01T07:00:00Z", []string{
+			"2021-03-03T06:30:00Z", "2021-03-05T06:30:00Z", "2021-03-08T06:30:00Z"}},
+		{"occurrence is strictly after", "0 0 * * *", "2021-03-01T00:00:00Z", []string{
+			"2021-03-02T00:00:00Z"}},
+		// cron matches either day field if both are restricted
+		{"day-of-month or day-of-week", "0 0 1 * 1", "2021-03-01T00:00:00Z", []string{
+			"2021-03-08T00:00:00Z", "2021-03-15T00:00:00Z", "2021-03-22T00:00:00Z",
+			"2021-03-29T00:00:00Z", "2021-04-01T00:00:00Z"}},
+		{"day-of-month and any day-of-week", "0 0 15 * *", "2021-03-01T00:00:00Z", []string{
+			"2021-03-15T00:00:00Z", "2021-04-15T00:00:00Z"}},
+		{"sunday as 7", "0 0 * * 7", "2021-03-01T00:00:00Z", []string{
+			"2021-03-07T00:00:00Z", "2021-03-14T00:00:00Z"}},
+		{"months without day", "0 0 31 * *", "2021-01-31T00:00:00Z", []string{
+			"2021-03-31T00:00:00Z", "2021-05-31T00:00:00Z", "2021-07-31T00:00:00Z"}},
+		{"leap day", "0 0 29 2 *", "2021-01-01T00:00:00Z", []string{
+			"2024-02-29T00:00:00Z", "2028-02-29T00:00:00Z"}},
+		{"impossible date", "0 0 30 2 *", "2021-01-01T00:00:00Z", []string{""}},
+		{"year end", "59 23 31 12 *", "2021-12-31T23:59:00Z", []string{
+			"2022-12-31T23:59:00Z"}},
+		{"hourly macro", "@hourly", "2021-03-01T10:07:00Z", []string{
+			"2021-03-01T11:00:00Z", "2021-03-01T12:00:00Z"}},
+		{"daily macro", "@daily", "2021-03-01T10:07:00Z", []string{"2021-03-02T00:00:00Z"}},
+		{"weekly macro", "@weekly", "2021-03-01T10:07:00Z", []string{"2021-03-07T00:00:00Z"}},
+		{"monthly macro", "@monthly", "2021-01-15T00:00:00Z", []string{
+			"2021-02-01T00:00:00Z", "2021-03-01T00:00:00Z"}},
+		// schedules are evaluated in UTC regardless of daylight saving time
+		{"daylight saving time", "0 9 * * *", "2021-03-27T12:00:00+01:00", []string{
+			"2021-03-28T09:00:00Z", "2021-03-29T09:00:00Z"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, err := ParseSchedule(c.expr, time.Time{})
+			if err != nil {
+				t.Fatalf("unable to parse schedule: %+v", err)
+			}
+			listed := occurrences(s, mustParseTime(t, c.after), len(c.expected))
+			if !reflect.DeepEqual(listed, c.expected) {
+				t.Errorf("expected occurrences %v, got %v", c.expected, listed)
+			}
+		})
+	}
+}
+
+func TestRRuleSchedule(t *testing.T) {
+	cases := []struct {
+		name     string
+		rule     string
+		start    string
+		after    string
+		expected []string
+	}{
+		{"daily", "FREQ=DAILY", "2021-03-01T09:30:00Z", "2021-01-01T00:00:00Z", []string{
+			"2021-03-01T09:30:00Z", "2021-03-02T09:30:00Z", "2021-03-03T09:30:00Z"}},
+		{"lowercase", "freq=daily", "2021-03-01T09:30:00Z", "2021-03-01T09:30:00Z", []string{
+			"2021-03-02T09:30:00Z"}},
+		{"daily interval", "FREQ=DAILY;INTERVAL=3", "2021-03-01T09:30:00Z",
+			"2021-03-01T12:00:00Z", []string{"2021-03-04T09:30:00Z", "2021-03-07T09:30:00Z"}},
+		{"daily hours and minutes", "FREQ=DAILY;BYHOUR=17,8;BYMINUTE=30,0",
+			"2021-03-01T09:30:00Z", "2021-01-01T00:00:00Z", []string{
+				"2021-03-01T17:00:00Z", "2021-03-01T17:30:00Z", "2021-03-02T08:00:00Z",
+				"2021-03-02T08:30:00Z"}},
+		{"daily by day", "FREQ=DAILY;BYDAY=SA,SU", "2021-03-01T09:30:00Z",
+			"2021-03-01T00:00:00Z", []string{"2021-03-06T09:30:00Z", "2021-03-07T09:30:00Z",
+				"2021-03-13T09:30:00Z"}},
+		{"weekly on start day", "FREQ=WEEKLY", "2021-03-01T09:30:00Z", "2021-03-01T00:00:00Z",
+			[]string{"2021-03-01T09:30:00Z", "2021-03-08T09:30:00Z"}},
+		{"weekly by day", "FREQ=WEEKLY;BYDAY=MO,FR;BYHOUR=6;BYMINUTE=0",
+			"2021-03-01T09:30:00Z", "2021-03-01T00:00:00Z", []string{
+				"2021-03-05T06:00:00Z", "2021-03-08T06:00:00Z", "2021-03-12T06:00:00Z"}},
+		// weeks start on monday, so the sunday before the start is skipped
+		{"biweekly", "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,SU", "2021-03-01T09:30:00Z",
+			"2021-03-01T00:00:00Z", []string{"2021-03-02T09:30:00Z", "2021-03-07T09:30:00Z",
+				"2021-03-16T09:30:00Z", "2021-03-21T09:30:00Z"}},
+		{"monthly on start day", "FREQ=MONTHLY", "2021-01-31T00:00:00Z", "2021-01-01T00:00:00Z",
+			[]string{"2021-01-31T00:00:00Z", "2021-03-31T00:00:00Z", "2021-05-31T00:00:00Z"}},
+		{"monthly by month day", "FREQ=MONTHLY;BYMONTHDAY=1,30", "2021-01-15T08:00:00Z",
+			"2021-01-01T00:00:00Z", []string{"2021-01-30T08:00:00Z", "2021-02-01T08:00:00Z",
+				"2021-03-01T08:00:00Z", "2021-03-30T08:00:00Z"}},
+		{"monthly interval by day", "FREQ=MONTHLY;INTERVAL=2;BYDAY=MO", "2021-03-01T09:30:00Z",
+			"2021-03-20T00:00:00Z", []string{"2021-03-22T09:30:00Z", "2021-03-29T09:30:00Z",
+				"2021-05-03T09:30:00Z"}},
+		{"until is inclusive", "FREQ=DAILY;UNTIL=20210303T093000Z", "2021-03-01T09:30:00Z",
+			"2021-01-01T00:00:00Z", []string{"2021-03-01T09:30:00Z", "2021-03-02T09:30:00Z",
+				"2021-03-03T09:30:00Z", ""}},
+		{"until", "FREQ=DAILY;UNTIL=20210303T000000Z", "2021-03-01T09:30:00Z",
+			"2021-01-01T00:00:00Z", []string{"2021-03-01T09:30:00Z", "2021-03-02T09:30:00Z", ""}},
+		{"count", "FREQ=DAILY;COUNT=3", "2021-03-01T09:30:00Z", "2021-01-01T00:00:00Z",
+			[]string{"2021-03-01T09:30:00Z", "2021-03-02T09:30:00Z", "2021-03-03T09:30:00Z", ""}},
+		// occurrences are counted from the start rather than the given time
+		{"count after start", "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=3", "2021-03-01T09:30:00Z",
+			"2021-03-04T00:00:00Z", []string{"2021-03-08T09:30:00Z", ""}},
+		// the start time is anchored in UTC regardless of daylight saving time
+		{"daylight saving time", "FREQ=DAILY", "2021-03-27T10:00:00+01:00",
+			"2021-03-27T00:00:00Z", []string{"2021-03-27T09:00:00Z", "2021-03-28T09:00:00Z",
+				"2021-03-29T09:00:00Z"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, err := ParseSchedule("RRULE:"+c.rule, mustParseTime(t, c.start))
+			if err != nil {
+				t.Fatalf("unable to parse schedule: %+v", err)
+			}
+			listed := occurrences(s, mustParseTime(t, c.after), len(c.expected))
+			if !reflect.DeepEqual(listed, c.expected) {
+				t.Errorf("expected occurrences %v, got %v", c.expected, listed)
+			}
+		})
+	}
+}
+
+func TestParseScheduleRejectsInvalidSchedules(t *testing.T) {
+	invalid := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"0 0 1 11-2 *",
+		"*/0 * * * *",
+		"*/a * * * *",
+		"a * * * *",
+		"1-a * * * *",
+		"a-1 * * * *",
+		"1,,2 * * * *",
+		"@yearly",
+		"RRULE:",
+		"RRULE:FREQ",
+		"RRULE:INTERVAL=2",
+		"RRULE:FREQ=YEARLY",
+		"RRULE:FREQ=DAILY;INTERVAL=0",
+		"RRULE:FREQ=DAILY;BYDAY=1MO",
+		"RRULE:FREQ=DAILY;BYMONTHDAY=32",
+		"RRULE:FREQ=DAILY;BYMONTHDAY=-1",
+		"RRULE:FREQ=DAILY;BYHOUR=24",
+		"RRULE:FREQ=DAILY;BYMINUTE=60",
+		"RRULE:FREQ=DAILY;UNTIL=2021-03-01",
+		"RRULE:FREQ=DAILY;COUNT=0",
+		"RRULE:FREQ=DAILY;COUNT=2;UNTIL=20210303T000000Z",
+		"RRULE:FREQ=DAILY;BYSETPOS=1",
+	}
+	for _, expr := range invalid {
+		if _, err := ParseSchedule(expr, time.Now()); err != ErrInvalidSchedule {
+			t.Errorf("expected schedule %q to be invalid, got %v", expr, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// define actor used to record changes made by the scheduler
+const SchedulerActor = "jobs-scheduler"
+
+type OverdueScheduler struct {
+	Persistence Persistence
+	Interval    time.Duration
+	BatchSize   int
+
+	stop chan struct{}
+}
+
+// function used to start the scheduler. the scheduler periodically
+// scans the persistence layer for jobs that have passed their due
+// date and moves them into the Overdue state
+func (s *OverdueScheduler) Start() {
+	log.Info(fmt.Sprintf("starting overdue scheduler with interval %s", s.Interval))
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.Run()
+			case <-s.stop:
+				log.Info("stopping overdue scheduler")
+				return
+			}
+		}
+	}()
+}
+
+// function used to stop a running scheduler
+func (s *OverdueScheduler) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+	}
+}
+
+// function used to execute a single scan for overdue jobs. batches
+// are processed until no more overdue jobs are found
+func (s *OverdueScheduler) Run() {
+	now := time.Now().UTC()
+	for {
+		updated, err := s.Persistence.MarkOverdueJobs(now, s.BatchSize)
+		if err != nil {
+			log.Error(fmt.Errorf("unable to mark overdue jobs: %+v", err))
+			return
+		}
+		if len(updated) > 0 {
+			log.Info(fmt.Sprintf("marked %d job(s) as overdue", len(updated)))
+		}
+		if len(updated) < s.BatchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/roles"
+)
+
+var (
+	// define custom errors for state transitions
+	ErrInvalidJobState        = errors.New("received invalid job state")
+	ErrInvalidStateTransition = errors.New("state transition is not permitted")
+	ErrInsufficientRole       = errors.New("user does not have required permission for state transition")
+)
+
+// define transition table for job states. the outer key is the
+// current state of the job, and the inner map contains the states
+// that the job can be moved into along with the permission
+// required to execute the transition
+var transitions = map[JobState]map[JobState]roles.Permission{
+	Created: {
+		Assigned:  roles.PermJobsAssign,
+		Blocked:   roles.PermJobsTriage,
+		Cancelled: roles.PermJobsCancel,
+	},
+	Assigned: {
+		InProgress: roles.PermJobsUpdate,
+		Blocked:    roles.PermJobsUpdate,
+		Cancelled:  roles.PermJobsCancel,
+	},
+	InProgress: {
+		Completed: roles.PermJobsUpdate,
+		Blocked:   roles.PermJobsUpdate,
+		Cancelled: roles.PermJobsCancel,
+	},
+	Blocked: {
+		Assigned:   roles.PermJobsAssign,
+		InProgress: roles.PermJobsUpdate,
+		Cancelled:  roles.PermJobsCancel,
+	},
+	Overdue: {
+		InProgress: roles.PermJobsUpdate,
+		Completed:  roles.PermJobsUpdate,
+		Blocked:    roles.PermJobsUpdate,
+		Cancelled:  roles.PermJobsCancel,
+	},
+	Completed: {
+		Reopened: roles.PermJobsReopen,
+	},
+	Cancelled: {
+		Reopened: roles.PermJobsReopen,
+	},
+	Reopened: {
+		Assigned:   roles.PermJobsAssign,
+		InProgress: roles.PermJobsUpdate,
+		Blocked:    roles.PermJobsUpdate,
+		Cancelled:  roles.PermJobsCancel,
+	},
+}
+
+// define list of states that are moved into the Overdue state by
+// the scheduler once the due date of the job has passed. note that
+// users cannot move jobs into the Overdue state directly
+var OverdueEligibleStates = []JobState{Created, Assigned, InProgress, Blocked, Reopened}
+
+// function used to retrieve the list of states that a job
+// can be moved into from a given state
+func AllowedTransitions(from JobState) []JobState {
+	allowed := []JobState{}
+	for state := range transitions[from] {
+		allowed = append(allowed, state)
+	}
+	// sort states to ensure that API responses are deterministic
+	sort.Slice(allowed, func(i, j int) bool { return allowed[i] < allowed[j] })
+	return allowed
+}
+
+// function used to validate that a job can be moved from one
+// state to another by a user with the given grant
+func ValidateTransition(from, to JobState, grant roles.Grant) error {
+	if !to.IsValid() {
+		return ErrInvalidJobState
+	}
+	required, ok := transitions[from][to]
+	if !ok {
+		return ErrInvalidStateTransition
+	}
+	if !grant.Has(required) {
+		return ErrInsufficientRole
+	}
+	return nil
+}
+
+// function used to evaluate the state of a job after its owner has
+// changed. jobs that receive an owner are moved into the Assigned state,
+// and work on jobs that are handed over to a different owner restarts
+// from the Assigned state. jobs that lose their owner are moved back
+// into the Created state. overdue and closed jobs retain their state
+func OwnerChangedState(state JobState, previous, owner string) JobState {
+	if previous == owner {
+		return state
+	}
+	if len(owner) == 0 {
+		switch state {
+		case Assigned, InProgress, Blocked:
+			return Created
+		}
+		return state
+	}
+	switch state {
+	case Created, Reopened:
+		return Assigned
+	case InProgress, Blocked:
+		if len(previous) > 0 {
+			return Assigned
+		}
+	}
+	return state
+}
@@ -0,0 +1,248 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/roles"
+)
+
+var allStates = []JobState{Created, Assigned, Completed, Overdue, InProgress, Cancelled,
+	Blocked, Reopened}
+
+// define expected transitions along with the permission required
+// to execute them. all other transitions are rejected
+var expectedTransitions = map[[2]JobState]roles.Permission{
+	{Created, Assigned}:     roles.PermJobsAssign,
+	{Created, Blocked}:      roles.PermJobsTriage,
+	{Created, Cancelled}:    roles.PermJobsCancel,
+	{Assigned, InProgress}:  roles.PermJobsUpdate,
+	{Assigned, Blocked}:     roles.PermJobsUpdate,
+	{Assigned, Cancelled}:   roles.PermJobsCancel,
+	{InProgress, Completed}: roles.PermJobsUpdate,
+	{InProgress, Blocked}:   roles.PermJobsUpdate,
+	{InProgress, Cancelled}: roles.PermJobsCancel,
+	{Blocked, Assigned}:     roles.PermJobsAssign,
+	{Blocked, InProgress}:   roles.PermJobsUpdate,
+	{Blocked, Cancelled}:    roles.PermJobsCancel,
+	{Overdue, InProgress}:   roles.PermJobsUpdate,
+	{Overdue, Completed}:    roles.PermJobsUpdate,
+	{Overdue, Blocked}:      roles.PermJobsUpdate,
+	{Overdue, Cancelled}:    roles.PermJobsCancel,
+	{Completed, Reopened}:   roles.PermJobsReopen,
+	{Cancelled, Reopened}:   roles.PermJobsReopen,
+	{Reopened, Assigned}:    roles.PermJobsAssign,
+	{Reopened, InProgress}:  roles.PermJobsUpdate,
+	{Reopened, Blocked}:     roles.PermJobsUpdate,
+	{Reopened, Cancelled}:   roles.PermJobsCancel,
+}
+
+// function used to generate a grant containing all permissions
+// except for the given permission
+func grantWithout(excluded roles.Permission) roles.Grant {
+	grant := roles.Grant{}
+	for _, p := range roles.Permissions {
+		if p != excluded {
+			grant.Permissions = append(grant.Permissions, p)
+		}
+	}
+	return grant
+}
+
+func TestValidateTransition(t *testing.T) {
+	for _, from := range allStates {
+		for _, to := range allStates {
+			required, allowed := expectedTransitions[[2]JobState{from, to}]
+			t.Run(fmt.Sprintf("%s to %s", from, to), func(t *testing.T) {
+				if !allowed {
+					if err := ValidateTransition(from, to, grantWithout("")); err != ErrInvalidStateTransition {
+						t.Errorf("expected transition to be rejected, got %v", err)
+					}
+					return
+				}
+				granted := roles.Grant{Permissions: []roles.Permission{required}}
+				if err := ValidateTransition(from, to, granted); err != nil {
+					t.Errorf("expected transition with %s to be permitted, got %v", required, err)
+				}
+				if err := ValidateTransition(from, to, grantWithout(required)); err != ErrInsufficientRole {
+					t.Errorf("expected transition without %s to be forbidden, got %v", required, err)
+				}
+			})
+		}
+	}
+
+	for _, to := range []JobState{-1, Reopened + 1} {
+		if err := ValidateTransition(Created, to, grantWithout("")); err != ErrInvalidJobState {
+			t.Errorf("expected state %d to be invalid, got %v", to, err)
+		}
+	}
+}
+
+func TestAllowedTransitions(t *testing.T) {
+	expected := map[JobState][]JobState{
+		Created:    {Assigned, Cancelled, Blocked},
+		Assigned:   {InProgress, Cancelled, Blocked},
+		InProgress: {Completed, Cancelled, Blocked},
+		Blocked:    {Assigned, InProgress, Cancelled},
+		Overdue:    {Completed, InProgress, Cancelled, Blocked},
+		Completed:  {Reopened},
+		Cancelled:  {Reopened},
+		Reopened:   {Assigned, InProgress, Cancelled, Blocked},
+	}
+	for _, state := range allStates {
+		if allowed := AllowedTransitions(state); !reflect.DeepEqual(allowed, expected[state]) {
+			t.Errorf("expected transitions %v from %s, got %v", expected[state], state, allowed)
+		}
+	}
+	// the Overdue state is only entered by the scheduler
+	for _, state := range allStates {
+		for _, to := range AllowedTransitions(state) {
+			if to == Overdue {
+				t.Errorf("expected %s to not allow transition to Overdue", state)
+			}
+		}
+	}
+}
+
+func TestOwnerChangedState(t *testing.T) {
+	cases := []struct {
+		state           JobState
+		previous, owner string
+		expected        JobState
+	}{
+		// jobs that receive an owner are assigned
+		{Created, "", "user-1", Assigned},
+		{Reopened, "", "user-1", Assigned},
+		{Blocked, "", "user-1", Blocked},
+		{InProgress, "", "user-1", InProgress},
+		// work restarts if jobs are handed over
+		{Assigned, "user-1", "user-2", Assigned},
+		{InProgress, "user-1", "user-2", Assigned},
+		{Blocked, "user-1", "user-2", Assigned},
+		// jobs that lose their owner are reset
+		{Assigned, "user-1", "", Created},
+		{InProgress, "user-1", "", Created},
+		{Blocked, "user-1", "", Created},
+		// overdue and closed jobs retain their state
+		{Overdue, "user-1", "", Overdue},
+		{Overdue, "user-1", "user-2", Overdue},
+		{Completed, "user-1", "user-2", Completed},
+		{Cancelled, "user-1", "", Cancelled},
+		// unchanged owners do not alter the state
+		{InProgress, "user-1", "user-1", InProgress},
+		{Created, "", "", Created},
+	}
+	for _, c := range cases {
+		if state := OwnerChangedState(c.state, c.previous, c.owner); state != c.expected {
+			t.Errorf("expected %s with owner %q -> %q to become %s, got %s", c.state,
+				c.previous, c.owner, c.expected, state)
+		}
+	}
+}
+
+// define fake persistence storing a single job. methods that are not
+// used by the tested handlers are not implemented
+type fakePersistence struct {
+	Persistence
+	job     Job
+	altered []JobState
+	created []Job
+	// jobs returned in batches by GetJobs along with the number of batches
+	batch   []Job
+	batches int
+}
+
+func (p *fakePersistence) GetJob(jobId uuid.UUID) (Job, error) {
+	if jobId != p.job.JobId {
+		return Job{}, ErrJobDoesNotExists
+	}
+	return p.job, nil
+}
+
+func (p *fakePersistence) ListUnmetDependencies(jobId uuid.UUID) ([]uuid.UUID, error) {
+	return []uuid.UUID{}, nil
+}
+
+func (p *fakePersistence) ListIncompleteSubtasks(jobId uuid.UUID) ([]uuid.UUID, error) {
+	return []uuid.UUID{}, nil
+}
+
+func (p *fakePersistence) AlterJobState(jobId uuid.UUID, version int, from, to JobState,
+	actor string) error {
+	p.altered = append(p.altered, to)
+	return nil
+}
+
+// define role lookup returning fixed grants per user
+type staticGrants map[string]roles.Grant
+
+func (g staticGrants) GetUserGrant(ctx context.Context, uid string) (roles.Grant, error) {
+	return g[uid], nil
+}
+
+func TestAlterJobStateHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	job := Job{JobId: uuid.New(), State: Completed, Version: 2,
+		Meta: map[string]interface{}{"creator": "creator"}}
+	grants := staticGrants{
+		"creator": roles.Grant{Permissions: []roles.Permission{roles.PermJobsUpdate}},
+		"planner": roles.Grant{Permissions: []roles.Permission{roles.PermJobsReadAll,
+			roles.PermJobsUpdateAll, roles.PermJobsUpdate, roles.PermJobsReopen}},
+	}
+	SetConfig(ServiceConfig{Roles: roles.NewRoleCache(grants, 0, 0)})
+
+	cases := []struct {
+		name   string
+		uid    string
+		state  JobState
+		status int
+		body   map[string]interface{}
+	}{
+		{"transition not in table", "planner", InProgress, http.StatusConflict,
+			map[string]interface{}{"current_state": float64(Completed),
+				"allowed_states": []interface{}{float64(Reopened)}}},
+		{"missing permission", "creator", Reopened, http.StatusForbidden, nil},
+		{"permitted transition", "planner", Reopened, http.StatusOK, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := &fakePersistence{job: job}
+			SetPersistence(p)
+
+			body, _ := json.Marshal(map[string]interface{}{"state": c.state})
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest("PATCH", "/jobs/"+job.JobId.String()+"/state",
+				bytes.NewReader(body))
+			ctx.Request.Header.Set("Content-Type", "application/json")
+			ctx.Params = gin.Params{{Key: "jobId", Value: job.JobId.String()}}
+			ctx.Set("uid", c.uid)
+			AlterJobStateHandler(ctx)
+
+			if w.Code != c.status {
+				t.Fatalf("expected status %d, got %d: %s", c.status, w.Code, w.Body.String())
+			}
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range c.body {
+				if !reflect.DeepEqual(response[key], value) {
+					t.Errorf("expected %s to be %v, got %v", key, value, response[key])
+				}
+			}
+			if altered := c.status == http.StatusOK; altered != (len(p.altered) == 1) {
+				t.Errorf("expected job state to be altered: %t, got %v", altered, p.altered)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package jobs
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// define actor used to record jobs created from templates
+const TemplateGeneratorActor = "jobs-template-generator"
+
+// define the maximum number of missed occurrences generated for a
+// single template per run. this prevents a template with a start
+// date far in the past from flooding the jobs table
+const maxOccurrencesPerRun = 100
+
+// API handler used to create a new job template
+func CreateTemplateHandler(ctx *gin.Context) {
+	log.Info("received request to create new job template")
+	var t JobTemplate
+	if err := ctx.ShouldBind(&t); err != nil {
+		log.Error(fmt.Errorf("unable to parse request body: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid request body"})
+		return
+	}
+	if t.Meta == nil {
+		t.Meta = map[string]interface{}{}
+	}
+	if t.Start.IsZero() {
+		t.Start = time.Now().UTC()
+	}
+
+	schedule, err := ParseSchedule(t.Schedule, t.Start)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse template schedule: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid schedule"})
+		return
+	}
+	// the first occurrence is the first match at or after the start time
+	next := schedule.Next(t.Start.Add(-time.Nanosecond))
+	if next.IsZero() {
+		log.Error(fmt.Errorf("schedule %s has no occurrences", t.Schedule))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid schedule"})
+		return
+	}
+	t.NextOccurrence = &next
+	t.Creator = ctx.MustGet("uid").(string)
+
+	id, err := persistence.CreateTemplate(t)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to create job template: %+v", err))
+		status := http.StatusInternalServerError
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Internal server error"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"http_code": http.StatusCreated,
+		"message": "Successfully created template", "id": id, "next_occurrence": next})
+}
+
+// API handler used to list all job templates
+func ListTemplatesHandler(ctx *gin.Context) {
+	log.Info("received request to list job templates")
+	templates, err := persistence.ListTemplates()
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve job templates: %+v", err))
+		status := http.StatusInternalServerError
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Internal server error"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"templates": templates})
+}
+
+// API handler used to retrieve a single job template
+func GetTemplateHandler(ctx *gin.Context) {
+	log.Info("received request to retrieve job template")
+	templateId, err := uuid.Parse(ctx.Param("templateId"))
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse template ID: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid template ID"})
+		return
+	}
+
+	t, err := persistence.GetTemplate(templateId)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve job template: %+v", err))
+		switch err {
+		case ErrTemplateDoesNotExist:
+			status := http.StatusNotFound
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Cannot find template with specified ID"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"template": t})
+}
+
+// API handler used to delete a job template. jobs that have
+// already been generated from the template are retained
+func DeleteTemplateHandler(ctx *gin.Context) {
+	log.Info("received request to delete job template")
+	templateId, err := uuid.Parse(ctx.Param("templateId"))
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse template ID: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid template ID"})
+		return
+	}
+
+	if err := persistence.DeleteTemplate(templateId); err != nil {
+		log.Error(fmt.Errorf("unable to delete job template: %+v", err))
+		switch err {
+		case ErrTemplateDoesNotExist:
+			status := http.StatusNotFound
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Cannot find template with specified ID"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"message": "Successfully deleted template"})
+}
+
+type TemplateGenerator struct {
+	Persistence Persistence
+	Interval    time.Duration
+
+	stop chan struct{}
+}
+
+// function used to start the template generator. the generator
+// periodically creates jobs for all templates with occurrences
+// that have passed since the last run
+func (g *TemplateGenerator) Start() {
+	log.Info(fmt.Sprintf("starting template generator with interval %s", g.Interval))
+	g.stop = make(chan struct{})
+	go func() {
+		// run once on startup to catch up on occurrences missed while
+		// the service was not running
+		g.Run()
+		ticker := time.NewTicker(g.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				g.Run()
+			case <-g.stop:
+				log.Info("stopping template generator")
+				return
+			}
+		}
+	}()
+}
+
+// function used to stop a running generator
+func (g *TemplateGenerator) Stop() {
+	if g.stop != nil {
+		close(g.stop)
+	}
+}
+
+// function used to execute a single generator run
+func (g *TemplateGenerator) Run() {
+	now := time.Now().UTC()
+	templates, err := g.Persistence.ListDueTemplates(now)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve due templates: %+v", err))
+		return
+	}
+	for _, t := range templates {
+		if err := g.generate(t, now); err != nil {
+			log.Error(fmt.Errorf("unable to generate jobs for template %s: %+v",
+				t.TemplateId, err))
+		}
+	}
+}
+
+// function used to generate jobs for all occurrences of a template
+// up to the given time. jobs are unique per template and occurrence,
+// so occurrences generated by a previous run (or a concurrent replica)
+// are skipped rather than duplicated
+func (g *TemplateGenerator) generate(t JobTemplate, now time.Time) error {
+	schedule, err := ParseSchedule(t.Schedule, t.Start)
+	if err != nil {
+		return err
+	}
+
+	previous, occurrence := t.LastOccurrence, *t.NextOccurrence
+	var last time.Time
+	for i := 0; i < maxOccurrencesPerRun && !occurrence.IsZero() && !occurrence.After(now); i++ {
+		if err := g.instantiate(t, occurrence); err != nil {
+			return err
+		}
+		last, occurrence = occurrence, schedule.Next(occurrence)
+	}
+	if last.IsZero() {
+		return nil
+	}
+	return g.Persistence.UpdateTemplateOccurrence(t.TemplateId, previous, last, occurrence)
+}
+
+// function used to create a single job from a template
+func (g *TemplateGenerator) instantiate(t JobTemplate, occurrence time.Time) error {
+	meta := map[string]interface{}{}
+	for k, v := range t.Meta {
+		meta[k] = v
+	}
+	meta["creator"] = t.Creator
+
+	templateId := t.TemplateId
+	j := Job{
+		Name:       t.Name,
+		Due:        occurrence.Add(t.DueOffset.Duration),
+		Meta:       meta,
+		TemplateId: &templateId,
+		Occurrence: &occurrence,
+	}
+	id, err := g.Persistence.CreateJob(j, TemplateGeneratorActor)
+	switch err {
+	case nil:
+	case ErrDuplicateOccurrence:
+		log.Debug(fmt.Sprintf("job for template %s at %s already exists", t.TemplateId,
+			occurrence))
+		return nil
+	default:
+		return err
+	}
+	log.Info(fmt.Sprintf("generated job %s from template %s", id, t.TemplateId))
+
+	if len(t.DefaultAssignee) > 0 {
+		if err := g.Persistence.AssignJob(id, 0, t.DefaultAssignee, OwnerRole,
+			TemplateGeneratorActor); err != nil {
+			log.Error(fmt.Errorf("unable to assign generated job %s: %+v", id, err))
+		}
+	}
+	return nil
+}
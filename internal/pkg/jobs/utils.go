@@ -1,12 +1,10 @@
 package jobs
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/PSauerborn/gamma-project/internal/pkg/utils"
 	"github.com/gin-gonic/gin"
@@ -14,105 +12,154 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// define default and maximum page sizes for paginated routes
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+	// define number of attempts made for read-modify-write operations
+	// that conflict with concurrent modifications
+	MaxConflictRetries = 5
+)
+
 var (
-	ErrFileStorageError = errors.New("unable to store file in filestore")
-	ErrInvalidJobID     = errors.New("received invalid job ID")
+	ErrInvalidPagination = errors.New("received invalid pagination parameters")
+	ErrInvalidJobID      = errors.New("received invalid job ID")
+	ErrInvalidIfMatch    = errors.New("received invalid If-Match header")
 )
 
-func ParseAndValidateJobId(ctx *gin.Context, key string) (uuid.UUID, error) {
+// function used to parse a job ID from the request path and validate
+// that the requesting user can perform the given action on the job
+func ParseAndValidateJobId(ctx *gin.Context, key string, action JobAction) (uuid.UUID, error) {
 	id, err := uuid.Parse(ctx.Param(key))
 	if err != nil {
 		log.Error(fmt.Errorf("unable to parse job id: %+v", err))
 		return id, ErrInvalidJobID
 	}
 
-	_, err = persistence.GetJob(id)
-	if err != nil {
-		log.Error(fmt.Errorf("unable to retrieve job from database: %+v", err))
-		return id, err
-	}
-	return id, nil
+	_, err = AuthorizeJobRequest(ctx, id, action)
+	return id, err
 }
 
-// function used to update job metadata in database via JSON patch operation
-func UpdateJobMetadata(jobId uuid.UUID, patch []map[string]interface{}) error {
-	log.Debug(fmt.Sprintf("patching metadata for job %+v", jobId))
-	job, err := persistence.GetJob(jobId)
+// function used to retrieve a job and evaluate the job access policy
+// for the requesting user. the permissions of the user are retrieved
+// from the roles API, and the teams of the user are only retrieved
+// if the job has been assigned to the queue of a team
+func AuthorizeJobRequest(ctx *gin.Context, jobId uuid.UUID, action JobAction) (Job, error) {
+	j, err := persistence.GetJob(jobId)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to retrieve job from database: %+v", err))
-		return err
+		return j, err
 	}
-	// perform JSON patch operation on metadata
-	patched, err := utils.PatchJSON(job.Meta, patch)
+
+	p, err := RequestPrincipal(ctx, j.TeamId != nil)
 	if err != nil {
-		log.Error(fmt.Errorf("unable to perform JSON patch: %+v", err))
-		return err
+		return j, err
 	}
-	return persistence.UpdateJobMeta(jobId, patched)
+	if err := AuthorizeJob(p, j, action); err != nil {
+		log.Warn(fmt.Sprintf("user %s is not authorized to access job %s: %+v",
+			p.Uid, jobId, err))
+		return j, err
+	}
+	return j, nil
 }
 
-// function used to append an attachment ID to a list of
-// attachments
-func AddJobAttachment(jobId, fileId uuid.UUID) error {
-	log.Debug(fmt.Sprintf("adding file %s to job %s", fileId, jobId))
-	job, err := persistence.GetJob(jobId)
+// function used to build the principal that the job access policy is
+// evaluated for from the requesting user. the teams of the user are
+// only retrieved from the roles API if requested
+func RequestPrincipal(ctx *gin.Context, withTeams bool) (Principal, error) {
+	p := Principal{Uid: ctx.MustGet("uid").(string)}
+	grant, err := serviceConfig.Roles.GetUserGrant(ctx.Request.Context(), p.Uid)
 	if err != nil {
-		log.Error(fmt.Errorf("unable to retrieve job from database: %+v", err))
-		return err
+		log.Error(fmt.Errorf("unable to retrieve user permissions: %+v", err))
+		return p, err
+	}
+	p.Grant = grant
+	if withTeams {
+		if p.Teams, err = listUserTeamIds(ctx, p.Uid); err != nil {
+			log.Error(fmt.Errorf("unable to retrieve teams of user: %+v", err))
+			return p, err
+		}
 	}
-	// get attachments and convert to string slice
-	attachments := job.Meta["attachments"].([]interface{})
-	job.Meta["attachments"] = append(attachments, fileId.String())
-	return persistence.UpdateJobMeta(jobId, job.Meta)
+	return p, nil
 }
 
-func AddFileToFilestore(upload FileUpload, host string) (uuid.UUID, error) {
-	log.Info("adding new file to filestore")
-
-	var r struct {
-		HTTPCode int       `json:"http_code"`
-		FileId   uuid.UUID `json:"file_id"`
+// function used to parse limit and offset query parameters from
+// a request. defaults are applied if the parameters are not set
+func ParsePagination(ctx *gin.Context) (int, int, error) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(DefaultPageSize)))
+	if err != nil || limit < 1 || limit > MaxPageSize {
+		return 0, 0, ErrInvalidPagination
 	}
-
-	jsonBody, err := json.Marshal(upload)
-	if err != nil {
-		log.Error(fmt.Errorf("unable to convert file to JSON format: %+v", err))
-		return r.FileId, err
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		return 0, 0, ErrInvalidPagination
 	}
+	return limit, offset, nil
+}
 
-	url := fmt.Sprintf("%s/filestore/file", host)
-	request, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		log.Error(fmt.Errorf("unable to generate HTTP request: %+v", err))
-		return r.FileId, err
-	}
-	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("X-Authenticated-Userid", "jobs-api")
+// function used to generate the ETag of a job from its version
+func JobETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(request)
-	if err != nil {
-		log.Error(fmt.Errorf("unable to execute HTTP request: %+v", err))
-		return r.FileId, err
+// function used to parse the expected job version from the If-Match
+// header of a request. 0 is returned if the header is not set or
+// matches any version
+func ParseIfMatch(ctx *gin.Context) (int, error) {
+	header := strings.TrimSpace(ctx.GetHeader("If-Match"))
+	if len(header) == 0 || header == "*" {
+		return 0, nil
+	}
+	// weak validators are accepted since versions are compared exactly
+	header = strings.TrimPrefix(header, "W/")
+	version, err := strconv.Atoi(strings.Trim(header, `"`))
+	if err != nil || version < 1 {
+		return 0, ErrInvalidIfMatch
 	}
-	defer resp.Body.Close()
+	return version, nil
+}
 
-	switch resp.StatusCode {
-	case 201:
-		log.Info("successfully added file to filestore")
-		if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
-			log.Error(fmt.Errorf("unable to parse API response: %+v", err))
-			return r.FileId, err
+// function used to update job metadata in database via JSON patch
+// operation. if a version is given, the patch is only applied if the
+// job is still at that version. otherwise the patch is applied to the
+// latest version of the job, and is retried if the job is modified
+// between reading and writing the metadata
+func UpdateJobMetadata(jobId uuid.UUID, version int, patch []map[string]interface{},
+	actor string) error {
+	log.Debug(fmt.Sprintf("patching metadata for job %+v", jobId))
+	for attempt := 1; ; attempt++ {
+		job, err := persistence.GetJob(jobId)
+		if err != nil {
+			log.Error(fmt.Errorf("unable to retrieve job from database: %+v", err))
+			return err
+		}
+		if version != 0 && job.Version != version {
+			return ErrJobVersionConflict
 		}
-		return r.FileId, nil
-	default:
-		body, err := ioutil.ReadAll(resp.Body)
+		// perform JSON patch operation on metadata
+		patched, err := utils.PatchJSON(job.Meta, patch)
 		if err != nil {
-			log.Error("failed to read API response: %+v", err)
-		} else {
-			log.Error(fmt.Sprintf("received invalid API response with code %d: %s",
-				resp.StatusCode, string(body)))
+			log.Error(fmt.Errorf("unable to perform JSON patch: %+v", err))
+			return err
 		}
-		return r.FileId, ErrFileStorageError
+
+		err = persistence.UpdateJobMeta(jobId, job.Version, patched, patch, actor)
+		if err != ErrJobVersionConflict || version != 0 || attempt == MaxConflictRetries {
+			return err
+		}
+		log.Warn(fmt.Sprintf("job %s modified concurrently. retrying patch (attempt %d)",
+			jobId, attempt))
+	}
+}
+
+// function used to append an attachment ID to a list of
+// attachments
+func AddJobAttachment(jobId, fileId uuid.UUID, actor string) error {
+	log.Debug(fmt.Sprintf("adding file %s to job %s", fileId, jobId))
+	// attachments are appended via JSON patch so that the
+	// operation is recorded in the job history
+	patch := []map[string]interface{}{
+		{"op": "add", "path": "/attachments/-", "value": fileId.String()},
 	}
+	return UpdateJobMetadata(jobId, 0, patch, actor)
 }
@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// function used to generate a request context with the given query
+// string and headers
+func newQueryContext(query string, headers map[string]string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/jobs?"+query, nil)
+	for key, value := range headers {
+		ctx.Request.Header.Set(key, value)
+	}
+	return ctx
+}
+
+func TestParsePagination(t *testing.T) {
+	cases := []struct {
+		query         string
+		limit, offset int
+		err           error
+	}{
+		{"", DefaultPageSize, 0, nil},
+		{"limit=1&offset=10", 1, 10, nil},
+		{"limit=500", MaxPageSize, 0, nil},
+		{"limit=0", 0, 0, ErrInvalidPagination},
+		{"limit=501", 0, 0, ErrInvalidPagination},
+		{"limit=-1", 0, 0, ErrInvalidPagination},
+		{"limit=ten", 0, 0, ErrInvalidPagination},
+		{"limit=", 0, 0, ErrInvalidPagination},
+		{"offset=-1", 0, 0, ErrInvalidPagination},
+		{"offset=first", 0, 0, ErrInvalidPagination},
+	}
+	for _, c := range cases {
+		limit, offset, err := ParsePagination(newQueryContext(c.query, nil))
+		if limit != c.limit || offset != c.offset || err != c.err {
+			t.Errorf("expected query %q to return %d, %d (%v), got %d, %d (%v)", c.query,
+				c.limit, c.offset, c.err, limit, offset, err)
+		}
+	}
+}
+
+func TestParseIfMatch(t *testing.T) {
+	cases := []struct {
+		header  string
+		version int
+		err     error
+	}{
+		// missing headers and wildcards match any version
+		{"", 0, nil},
+		{"*", 0, nil},
+		{" * ", 0, nil},
+		{`"3"`, 3, nil},
+		{"3", 3, nil},
+		{`W/"3"`, 3, nil},
+		{` "12" `, 12, nil},
+		{`"0"`, 0, ErrInvalidIfMatch},
+		{`"-1"`, 0, ErrInvalidIfMatch},
+		{`"abc"`, 0, ErrInvalidIfMatch},
+		{`"1", "2"`, 0, ErrInvalidIfMatch},
+		{`W/`, 0, ErrInvalidIfMatch},
+		{`w/"3"`, 0, ErrInvalidIfMatch},
+	}
+	for _, c := range cases {
+		ctx := newQueryContext("", map[string]string{"If-Match": c.header})
+		version, err := ParseIfMatch(ctx)
+		if version != c.version || err != c.err {
+			t.Errorf("expected header %q to return %d (%v), got %d (%v)", c.header, c.version,
+				c.err, version, err)
+		}
+	}
+}
+
+func TestJobETagRoundTrip(t *testing.T) {
+	for _, version := range []int{1, 2, 1000} {
+		etag := JobETag(version)
+		for _, header := range []string{etag, "W/" + etag} {
+			parsed, err := ParseIfMatch(newQueryContext("", map[string]string{"If-Match": header}))
+			if err != nil || parsed != version {
+				t.Errorf("expected ETag %s to match version %d, got %d (%v)", header, version,
+					parsed, err)
+			}
+		}
+	}
+	if etag := JobETag(7); etag != `"7"` {
+		t.Errorf("expected quoted ETag, got %s", etag)
+	}
+}
@@ -0,0 +1,204 @@
+package roles
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/utils"
+)
+
+var (
+	// define custom errors returned by the roles API accessor
+	ErrRoleLookupFailed   = errors.New("unable to retrieve user role from roles API")
+	ErrPermissionDenied   = errors.New("permission denied by roles API")
+	ErrUnexpectedResponse = errors.New("received unexpected response from roles API")
+	ErrNotFound           = errors.New("cannot find resource in roles API")
+	ErrRequestConflict    = errors.New("request conflicts with state of roles API")
+)
+
+// define client used to access the roles API on behalf of a service
+type RolesAPIAccessor struct {
+	*utils.BaseAPIAccessor
+	UserId string
+}
+
+// function used to execute a request against the roles API. the
+// response body is decoded into the given payload on success
+func (accessor *RolesAPIAccessor) request(ctx context.Context, method, path string,
+	body interface{}, payload interface{}) error {
+	content := bytes.NewReader(nil)
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			log.Error(fmt.Errorf("unable to convert request body to JSON: %+v", err))
+			return err
+		}
+		content = bytes.NewReader(jsonBody)
+	}
+
+	url := accessor.FormatURL(path)
+	request, err := accessor.NewJSONRequestWithContext(ctx, method, url, content, nil)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to generate new request: %+v", err))
+		return err
+	}
+	if err := accessor.Authorize(request, accessor.UserId); err != nil {
+		return err
+	}
+
+	response, err := accessor.ExecuteRequest(request)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to execute request: %+v", err))
+		return err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		if payload == nil {
+			return nil
+		}
+		if err := json.NewDecoder(response.Body).Decode(payload); err != nil {
+			log.Error(fmt.Errorf("unable to parse JSON response from API: %+v", err))
+			return ErrUnexpectedResponse
+		}
+		return nil
+	case http.StatusForbidden:
+		return ErrPermissionDenied
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrRequestConflict
+	default:
+		body, _ := ioutil.ReadAll(response.Body)
+		log.Error(fmt.Sprintf("received non-success response from API with code %d: %s",
+			response.StatusCode, string(body)))
+		return ErrUnexpectedResponse
+	}
+}
+
+// function used to check the health of the roles API
+func (accessor *RolesAPIAccessor) HealthCheck(ctx context.Context) error {
+	return accessor.request(ctx, "GET", "/roles/health_check", nil, nil)
+}
+
+// function used to retrieve the role of a given user
+func (accessor *RolesAPIAccessor) GetUserRole(ctx context.Context, uid string) (Role, error) {
+	grant, err := accessor.GetUserGrant(ctx, uid)
+	if err != nil {
+		return Standard, err
+	}
+	return grant.Role, nil
+}
+
+// function used to retrieve the role of a given user along
+// with the permissions granted to the role
+func (accessor *RolesAPIAccessor) GetUserGrant(ctx context.Context, uid string) (Grant, error) {
+	log.Debug(fmt.Sprintf("retrieving role for user %s from roles API", uid))
+	var payload struct {
+		HTTPCode    int          `json:"http_code"`
+		Role        string       `json:"role"`
+		Permissions []Permission `json:"permissions"`
+	}
+	if err := accessor.request(ctx, "GET", fmt.Sprintf("/roles/%s", uid), nil,
+		&payload); err != nil {
+		return Grant{}, ErrRoleLookupFailed
+	}
+	role, err := StringToRole(payload.Role)
+	if err != nil {
+		log.Error(fmt.Errorf("received invalid role %s from API", payload.Role))
+		return Grant{}, ErrRoleLookupFailed
+	}
+	if payload.Permissions == nil {
+		payload.Permissions = []Permission{}
+	}
+	return Grant{Role: role, Permissions: payload.Permissions}, nil
+}
+
+// function used to retrieve known permissions and the
+// permissions granted to each role
+func (accessor *RolesAPIAccessor) ListRolePermissions(ctx context.Context) (
+	map[Role][]Permission, error) {
+	var payload struct {
+		Roles map[string][]Permission `json:"roles"`
+	}
+	results := map[Role][]Permission{}
+	if err := accessor.request(ctx, "GET", "/roles/permissions", nil, &payload); err != nil {
+		return results, err
+	}
+	for name, permissions := range payload.Roles {
+		role, err := StringToRole(name)
+		if err != nil {
+			log.Error(fmt.Errorf("received invalid role %s from API", name))
+			return results, ErrUnexpectedResponse
+		}
+		results[role] = permissions
+	}
+	return results, nil
+}
+
+// function used to replace the permissions granted to a role. the
+// accessor user must have the roles:manage permission
+func (accessor *RolesAPIAccessor) SetRolePermissions(ctx context.Context, role Role,
+	permissions []Permission) error {
+	log.Debug(fmt.Sprintf("setting permissions for role %s", role))
+	body := map[string]interface{}{"permissions": permissions}
+	return accessor.request(ctx, "PUT", fmt.Sprintf("/roles/permissions/%s", role), body, nil)
+}
+
+// function used to set the role of a given user. the accessor
+// user must have the roles:manage permission
+func (accessor *RolesAPIAccessor) SetUserRole(ctx context.Context, uid string, role Role) error {
+	log.Debug(fmt.Sprintf("setting role for user %s to %s", uid, role))
+	body := map[string]interface{}{"uid": uid, "role": role}
+	return accessor.request(ctx, "PUT", "/roles/set", body, nil)
+}
+
+// function used to remove the role granted to a given user. the
+// accessor user must have the roles:manage permission
+func (accessor *RolesAPIAccessor) RevokeUserRole(ctx context.Context, uid string) error {
+	log.Debug(fmt.Sprintf("revoking role of user %s", uid))
+	switch err := accessor.request(ctx, "DELETE", fmt.Sprintf("/roles/%s", uid), nil, nil); err {
+	case ErrNotFound:
+		return ErrRoleGrantNotFound
+	case ErrRequestConflict:
+		return ErrLastAdmin
+	default:
+		return err
+	}
+}
+
+// function used to retrieve a team along with its members
+func (accessor *RolesAPIAccessor) GetTeam(ctx context.Context, teamId uuid.UUID) (Team, error) {
+	log.Debug(fmt.Sprintf("retrieving team %s from roles API", teamId))
+	var payload struct {
+		Team Team `json:"team"`
+	}
+	err := accessor.request(ctx, "GET", fmt.Sprintf("/roles/teams/%s", teamId), nil, &payload)
+	if err == ErrNotFound {
+		return payload.Team, ErrTeamNotFound
+	}
+	return payload.Team, err
+}
+
+// function used to retrieve the teams that a given user is a member of
+func (accessor *RolesAPIAccessor) ListUserTeams(ctx context.Context, uid string) ([]Team, error) {
+	log.Debug(fmt.Sprintf("retrieving teams for user %s from roles API", uid))
+	var payload struct {
+		Teams []Team `json:"teams"`
+	}
+	path := fmt.Sprintf("/roles/teams?member=%s", url.QueryEscape(uid))
+	if err := accessor.request(ctx, "GET", path, nil, &payload); err != nil {
+		return []Team{}, err
+	}
+	return payload.Teams, nil
+}
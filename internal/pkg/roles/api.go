@@ -8,12 +8,26 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-var persistence Persistence
+var (
+	persistence Persistence
+	// define hooks called when the role of a user is changed
+	roleChangeHooks []RoleChangeHook
+)
 
 func SetPersistence(p Persistence) {
 	persistence = p
 }
 
+// define hook called after the role of a user is changed, used
+// to invalidate roles cached by other services. hooks are called
+// with an empty user ID if the permissions of a role are changed
+type RoleChangeHook func(uid string, role Role)
+
+// function used to register hooks called when roles are changed
+func SetRoleChangeHooks(hooks ...RoleChangeHook) {
+	roleChangeHooks = hooks
+}
+
 // API handler used to serve health check routes
 func HealthCheckHandler(ctx *gin.Context) {
 	log.Info("received request for health check route")
@@ -24,7 +38,7 @@ func HealthCheckHandler(ctx *gin.Context) {
 func GetUserRolesHandler(ctx *gin.Context) {
 	log.Info("received request to retrieve user roles")
 	uid := ctx.Param("uid")
-	role, err := persistence.GetUserRole(uid)
+	grant, err := persistence.GetUserGrant(uid)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to retrieve roles"))
 		status := http.StatusInternalServerError
@@ -33,28 +47,35 @@ func GetUserRolesHandler(ctx *gin.Context) {
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
-		"role": role.String()})
+		"role": grant.Role.String(), "permissions": grant.Permissions})
 }
 
-func SetUserRolesHandler(ctx *gin.Context) {
-	log.Info("received request to retrieve set roles")
-	uid := ctx.MustGet("uid").(string)
-
-	role, err := persistence.GetUserRole(uid)
+// function used to abort requests from users without the given
+// permission. returns false if the request was aborted
+func requirePermission(ctx *gin.Context, uid string, permission Permission) bool {
+	grant, err := persistence.GetUserGrant(uid)
 	if err != nil {
-		log.Error(fmt.Errorf("unable to retrieve user role: %+v", err))
+		log.Error(fmt.Errorf("unable to retrieve user permissions: %+v", err))
 		status := http.StatusInternalServerError
 		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
 			"message": "Internal server error"})
-		return
+		return false
 	}
-
-	// only allow admin users to set roles in database
-	if role < Admin {
-		log.Warn(fmt.Sprintf("received request to set roles without permissions from user %s", uid))
+	if !grant.Has(permission) {
+		log.Warn(fmt.Sprintf("user %s does not have permission %s", uid, permission))
 		status := http.StatusForbidden
 		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
 			"message": "Forbidden"})
+		return false
+	}
+	return true
+}
+
+func SetUserRolesHandler(ctx *gin.Context) {
+	log.Info("received request to retrieve set roles")
+	uid := ctx.MustGet("uid").(string)
+	// only allow users that manage roles to set roles in database
+	if !requirePermission(ctx, uid, PermRolesManage) {
 		return
 	}
 
@@ -78,13 +99,173 @@ func SetUserRolesHandler(ctx *gin.Context) {
 		return
 	}
 
-	if err := persistence.SetUserRole(r.Uid, r.UserRole); err != nil {
+	if err := persistence.SetUserRole(r.Uid, r.UserRole, uid); err != nil {
 		log.Error(fmt.Errorf("unable to set user role: %+v", err))
+		switch err {
+		case ErrLastAdmin:
+			status := http.StatusConflict
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Cannot remove role of last Admin"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
+		return
+	}
+	for _, hook := range roleChangeHooks {
+		hook(r.Uid, r.UserRole)
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"message": "Successfully set user role"})
+}
+
+// API handler used to remove the role granted to a user. users
+// without a role are granted the permissions of the Standard role
+func RevokeUserRoleHandler(ctx *gin.Context) {
+	log.Info("received request to revoke user role")
+	uid := ctx.MustGet("uid").(string)
+	if !requirePermission(ctx, uid, PermRolesManage) {
+		return
+	}
+
+	target := ctx.Param("uid")
+	if err := persistence.RevokeUserRole(target, uid); err != nil {
+		log.Error(fmt.Errorf("unable to revoke user role: %+v", err))
+		switch err {
+		case ErrRoleGrantNotFound:
+			status := http.StatusNotFound
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "User has not been granted a role"})
+		case ErrLastAdmin:
+			status := http.StatusConflict
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Cannot remove role of last Admin"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
+		return
+	}
+	for _, hook := range roleChangeHooks {
+		hook(target, Standard)
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"message": "Successfully revoked user role"})
+}
+
+// API handler used to list the users that have been granted
+// a given role along with the user that granted the role
+func ListRoleUsersHandler(ctx *gin.Context) {
+	log.Info("received request to list users with role")
+	uid := ctx.MustGet("uid").(string)
+	if !requirePermission(ctx, uid, PermRolesManage) {
+		return
+	}
+
+	role, err := StringToRole(ctx.Query("role"))
+	if err != nil {
+		log.Error(fmt.Errorf("received invalid role %s", ctx.Query("role")))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid role"})
+		return
+	}
+	grants, err := persistence.ListRoleGrants(role)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve role grants: %+v", err))
 		status := http.StatusInternalServerError
 		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
 			"message": "Internal server error"})
 		return
 	}
+	// convert roles to names for JSON response
+	users := []gin.H{}
+	for _, g := range grants {
+		users = append(users, gin.H{"uid": g.Uid, "role": g.Role.String(),
+			"granted_by": g.GrantedBy, "granted": g.Granted})
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK, "users": users})
+}
+
+// API handler used to list known permissions and the
+// permissions granted to each role
+func ListRolePermissionsHandler(ctx *gin.Context) {
+	log.Info("received request to list role permissions")
+	results, err := persistence.ListRolePermissions()
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve role permissions: %+v", err))
+		status := http.StatusInternalServerError
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Internal server error"})
+		return
+	}
+	// convert roles to names for JSON response
+	granted := map[string][]Permission{}
+	for role, permissions := range results {
+		granted[role.String()] = permissions
+	}
 	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
-		"message": "Successfully set user role"})
+		"permissions": Permissions, "roles": granted})
+}
+
+// API handler used to replace the permissions granted to a role
+func SetRolePermissionsHandler(ctx *gin.Context) {
+	log.Info("received request to set role permissions")
+	uid := ctx.MustGet("uid").(string)
+	if !requirePermission(ctx, uid, PermRolesManage) {
+		return
+	}
+
+	role, err := StringToRole(ctx.Param("role"))
+	if err != nil {
+		log.Error(fmt.Errorf("received invalid role %s", ctx.Param("role")))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid role"})
+		return
+	}
+	var r struct {
+		Permissions []Permission `json:"permissions" binding:"required"`
+	}
+	if err := ctx.ShouldBind(&r); err != nil {
+		log.Error(fmt.Errorf("unable to parse request body: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid request body"})
+		return
+	}
+	for _, p := range r.Permissions {
+		if !p.IsValid() {
+			log.Error(fmt.Errorf("received invalid permission %s", p))
+			status := http.StatusBadRequest
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": fmt.Sprintf("Invalid permission %s", p)})
+			return
+		}
+	}
+	// roles must not lose the permission to manage roles, since doing
+	// so could leave no user able to manage roles
+	if role == Admin && !(Grant{Permissions: r.Permissions}).Has(PermRolesManage) {
+		log.Warn("received request to remove role management permission from Admin role")
+		status := http.StatusConflict
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Admin role must retain roles:manage permission"})
+		return
+	}
+
+	if err := persistence.SetRolePermissions(role, r.Permissions); err != nil {
+		log.Error(fmt.Errorf("unable to set role permissions: %+v", err))
+		status := http.StatusInternalServerError
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Internal server error"})
+		return
+	}
+	// permissions cached by other services are invalidated for all users
+	for _, hook := range roleChangeHooks {
+		hook("", role)
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"message": "Successfully set role permissions"})
 }
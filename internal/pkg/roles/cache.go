@@ -0,0 +1,144 @@
+package roles
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// define default lifetimes of cached role lookups
+	DefaultRoleCacheTTL         = 30 * time.Second
+	DefaultRoleCacheNegativeTTL = 5 * time.Second
+)
+
+// define interface used to look up user roles and permissions
+type RoleLookup interface {
+	GetUserGrant(ctx context.Context, uid string) (Grant, error)
+}
+
+// define in-process cache of user roles and permissions. successful lookups are cached
+// for the TTL, and failed lookups for the shorter negative TTL so that
+// an unavailable roles API is not flooded with requests. concurrent
+// lookups for the same user share a single request to the roles API
+type RoleCache struct {
+	Lookup      RoleLookup
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	// function used to retrieve the current time. defaults to time.Now
+	// and can be replaced to control cache expiry
+	Now func() time.Time
+
+	lock    sync.Mutex
+	entries map[string]roleEntry
+	calls   map[string]*roleCall
+}
+
+// define struct used to store a cached lookup result
+type roleEntry struct {
+	grant   Grant
+	err     error
+	expires time.Time
+}
+
+// define struct used to share an in-flight lookup between callers
+type roleCall struct {
+	done  chan struct{}
+	grant Grant
+	err   error
+}
+
+// function used to generate new role cache
+func NewRoleCache(lookup RoleLookup, ttl, negativeTTL time.Duration) *RoleCache {
+	return &RoleCache{
+		Lookup:      lookup,
+		TTL:         ttl,
+		NegativeTTL: negativeTTL,
+		entries:     map[string]roleEntry{},
+		calls:       map[string]*roleCall{},
+	}
+}
+
+// function used to retrieve the role of a user
+func (c *RoleCache) GetUserRole(ctx context.Context, uid string) (Role, error) {
+	grant, err := c.GetUserGrant(ctx, uid)
+	if err != nil {
+		return Standard, err
+	}
+	return grant.Role, nil
+}
+
+// function used to retrieve the role and permissions of a user, using
+// the cached grant if it has not expired. callers waiting on a lookup
+// started by another request stop waiting once their context is done
+func (c *RoleCache) GetUserGrant(ctx context.Context, uid string) (Grant, error) {
+	c.lock.Lock()
+	if entry, ok := c.entries[uid]; ok && c.now().Before(entry.expires) {
+		c.lock.Unlock()
+		return entry.grant, entry.err
+	}
+	call, ok := c.calls[uid]
+	if !ok {
+		call = &roleCall{done: make(chan struct{})}
+		c.calls[uid] = call
+		go c.lookup(uid, call)
+	}
+	c.lock.Unlock()
+
+	select {
+	case <-call.done:
+		return call.grant, call.err
+	case <-ctx.Done():
+		return Grant{}, ctx.Err()
+	}
+}
+
+// function used to look up the role of a user and store the result.
+// lookups are not tied to the context of any single caller, since
+// the result is shared by all callers waiting on the lookup
+func (c *RoleCache) lookup(uid string, call *roleCall) {
+	call.grant, call.err = c.Lookup.GetUserGrant(context.Background(), uid)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// results of lookups invalidated while in flight are not stored
+	if c.calls[uid] == call {
+		ttl := c.TTL
+		if call.err != nil {
+			ttl = c.NegativeTTL
+		}
+		c.entries[uid] = roleEntry{grant: call.grant, err: call.err,
+			expires: c.now().Add(ttl)}
+		delete(c.calls, uid)
+	}
+	close(call.done)
+}
+
+func (c *RoleCache) now() time.Time {
+	if c.Now == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
+
+// function used to remove the cached role of a user. lookups
+// in flight when the cache is invalidated are discarded
+func (c *RoleCache) Invalidate(uid string) {
+	log.Debug(fmt.Sprintf("invalidating cached role for user %s", uid))
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.entries, uid)
+	delete(c.calls, uid)
+}
+
+// function used to remove the cached roles of all users
+func (c *RoleCache) InvalidateAll() {
+	log.Debug("invalidating all cached roles")
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries = map[string]roleEntry{}
+	c.calls = map[string]*roleCall{}
+}
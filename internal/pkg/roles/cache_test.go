@@ -0,0 +1,254 @@
+package roles
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errLookupFailed = errors.New("lookup failed")
+
+// define fake role lookup that counts lookups per user. lookups block
+// until the gate is closed if a gate is set
+type fakeLookup struct {
+	lock    sync.Mutex
+	calls   map[string]int
+	err     error
+	gate    chan struct{}
+	started chan string
+}
+
+func newFakeLookup() *fakeLookup {
+	return &fakeLookup{calls: map[string]int{}}
+}
+
+func (l *fakeLookup) GetUserGrant(ctx context.Context, uid string) (Grant, error) {
+	l.lock.Lock()
+	l.calls[uid]++
+	err, gate, started := l.err, l.gate, l.started
+	l.lock.Unlock()
+
+	if started != nil {
+		started <- uid
+	}
+	if gate != nil {
+		<-gate
+	}
+	if err != nil {
+		return Grant{}, err
+	}
+	return Grant{Role: Planner, Permissions: []Permission{PermJobsReadAll}}, nil
+}
+
+func (l *fakeLookup) count(uid string) int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.calls[uid]
+}
+
+// define fake clock used to control cache expiry
+type fakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestCache(lookup RoleLookup) (*RoleCache, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)}
+	cache := NewRoleCache(lookup, 30*time.Second, 5*time.Second)
+	cache.Now = clock.Now
+	return cache, clock
+}
+
+func TestRoleCacheExpiry(t *testing.T) {
+	lookup := newFakeLookup()
+	cache, clock := newTestCache(lookup)
+	ctx := context.Background()
+
+	grant, err := cache.GetUserGrant(ctx, "user-1")
+	if err != nil || grant.Role != Planner || !grant.Has(PermJobsReadAll) {
+		t.Fatalf("unexpected grant %+v (%v)", grant, err)
+	}
+	clock.Advance(29 * time.Second)
+	if role, err := cache.GetUserRole(ctx, "user-1"); err != nil || role != Planner {
+		t.Fatalf("unexpected role %v (%v)", role, err)
+	}
+	if calls := lookup.count("user-1"); calls != 1 {
+		t.Errorf("expected cached grant to be used, got %d lookups", calls)
+	}
+
+	clock.Advance(time.Second)
+	if _, err := cache.GetUserGrant(ctx, "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if calls := lookup.count("user-1"); calls != 2 {
+		t.Errorf("expected expired grant to be looked up again, got %d lookups", calls)
+	}
+	// grants are cached per user
+	if _, err := cache.GetUserGrant(ctx, "user-2"); err != nil || lookup.count("user-2") != 1 {
+		t.Errorf("expected separate lookup for other user")
+	}
+}
+
+func TestRoleCacheNegativeExpiry(t *testing.T) {
+	lookup := newFakeLookup()
+	lookup.err = errLookupFailed
+	cache, clock := newTestCache(lookup)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.GetUserGrant(ctx, "user-1"); err != errLookupFailed {
+			t.Fatalf("expected lookup error, got %v", err)
+		}
+	}
+	if role, err := cache.GetUserRole(ctx, "user-1"); err != errLookupFailed || role != Standard {
+		t.Errorf("expected failed lookup to return standard role, got %v (%v)", role, err)
+	}
+	if calls := lookup.count("user-1"); calls != 1 {
+		t.Errorf("expected failed lookup to be cached, got %d lookups", calls)
+	}
+
+	// failed lookups expire after the negative TTL
+	lookup.lock.Lock()
+	lookup.err = nil
+	lookup.lock.Unlock()
+	clock.Advance(5 * time.Second)
+	if _, err := cache.GetUserGrant(ctx, "user-1"); err != nil {
+		t.Fatalf("expected lookup to succeed after negative TTL, got %v", err)
+	}
+	if calls := lookup.count("user-1"); calls != 2 {
+		t.Errorf("expected failed lookup to be retried, got %d lookups", calls)
+	}
+}
+
+func TestRoleCacheSharesConcurrentLookups(t *testing.T) {
+	lookup := newFakeLookup()
+	lookup.gate, lookup.started = make(chan struct{}), make(chan string, 10)
+	cache, _ := newTestCache(lookup)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cache.GetUserGrant(context.Background(), "user-1")
+			errs <- err
+		}()
+	}
+	<-lookup.started
+	// give all callers time to join the lookup in flight
+	time.Sleep(50 * time.Millisecond)
+	close(lookup.gate)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if calls := lookup.count("user-1"); calls != 1 {
+		t.Errorf("expected concurrent lookups to be shared, got %d lookups", calls)
+	}
+}
+
+func TestRoleCacheCancelledCaller(t *testing.T) {
+	lookup := newFakeLookup()
+	lookup.gate, lookup.started = make(chan struct{}), make(chan string, 1)
+	cache, _ := newTestCache(lookup)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		_, err := cache.GetUserGrant(ctx, "user-1")
+		result <- err
+	}()
+	<-lookup.started
+	cancel()
+	if err := <-result; err != context.Canceled {
+		t.Fatalf("expected cancelled caller to stop waiting, got %v", err)
+	}
+
+	// the lookup is completed and cached for other callers
+	close(lookup.gate)
+	if _, err := cache.GetUserGrant(context.Background(), "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.GetUserGrant(context.Background(), "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if calls := lookup.count("user-1"); calls != 1 {
+		t.Errorf("expected lookup to be shared after cancellation, got %d lookups", calls)
+	}
+}
+
+func TestRoleCacheInvalidate(t *testing.T) {
+	lookup := newFakeLookup()
+	cache, _ := newTestCache(lookup)
+	ctx := context.Background()
+
+	for _, uid := range []string{"user-1", "user-2", "user-3"} {
+		if _, err := cache.GetUserGrant(ctx, uid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cache.Invalidate("user-1")
+	for _, uid := range []string{"user-1", "user-2"} {
+		if _, err := cache.GetUserGrant(ctx, uid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lookup.count("user-1") != 2 || lookup.count("user-2") != 1 {
+		t.Errorf("expected only invalidated user to be looked up again, got %v", lookup.calls)
+	}
+
+	cache.InvalidateAll()
+	for _, uid := range []string{"user-2", "user-3"} {
+		if _, err := cache.GetUserGrant(ctx, uid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lookup.count("user-2") != 2 || lookup.count("user-3") != 2 {
+		t.Errorf("expected all users to be looked up again, got %v", lookup.calls)
+	}
+}
+
+func TestRoleCacheDiscardsLookupsInvalidatedInFlight(t *testing.T) {
+	lookup := newFakeLookup()
+	lookup.gate, lookup.started = make(chan struct{}), make(chan string, 2)
+	cache, _ := newTestCache(lookup)
+
+	result := make(chan error)
+	go func() {
+		_, err := cache.GetUserGrant(context.Background(), "user-1")
+		result <- err
+	}()
+	<-lookup.started
+	cache.Invalidate("user-1")
+	close(lookup.gate)
+	// callers waiting on the invalidated lookup still receive its result
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cache.GetUserGrant(context.Background(), "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if calls := lookup.count("user-1"); calls != 2 {
+		t.Errorf("expected result of invalidated lookup to be discarded, got %d lookups", calls)
+	}
+}
@@ -0,0 +1,69 @@
+package roles
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/utils"
+)
+
+// define timeout used when notifying other services of role changes
+const webhookTimeout = 5 * time.Second
+
+// function used to generate a hook that notifies other services of
+// role changes so that they can invalidate their cached roles. the
+// user ID is sent to each URL as a JSON body, and all cached roles
+// are invalidated if the permissions of a role are changed. notifications are sent
+// in the background, and failures are logged but not retried since
+// cached roles expire on their own. notifications are authenticated
+// with tokens from the given source if set
+func NewWebhookHook(urls []string, tokens utils.TokenSource) RoleChangeHook {
+	accessor := &utils.BaseAPIAccessor{
+		Client: &http.Client{Timeout: webhookTimeout},
+		Tokens: tokens,
+	}
+	return func(uid string, role Role) {
+		var notification interface{} = map[string]string{"uid": uid}
+		if len(uid) == 0 {
+			notification = map[string]bool{"all": true}
+		}
+		body, err := json.Marshal(notification)
+		if err != nil {
+			log.Error(fmt.Errorf("unable to convert webhook body to JSON: %+v", err))
+			return
+		}
+		for _, url := range urls {
+			go notifyRoleChange(accessor, url, body)
+		}
+	}
+}
+
+// function used to send a role change notification to a single URL
+func notifyRoleChange(accessor *utils.BaseAPIAccessor, url string, body []byte) {
+	request, err := accessor.NewJSONRequest("POST", url, bytes.NewReader(body), nil)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to generate webhook request: %+v", err))
+		return
+	}
+	if err := accessor.Authorize(request, "roles-api"); err != nil {
+		return
+	}
+
+	response, err := accessor.ExecuteRequest(request)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to notify %s of role change: %+v", url, err))
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		content, _ := ioutil.ReadAll(response.Body)
+		log.Error(fmt.Sprintf("received invalid webhook response from %s with code %d: %s",
+			url, response.StatusCode, string(content)))
+	}
+}
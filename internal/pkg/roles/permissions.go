@@ -0,0 +1,67 @@
+package roles
+
+import "errors"
+
+var ErrInvalidPermission = errors.New("received invalid permission")
+
+// define named permissions granted to roles. each role is
+// granted a set of permissions stored in the roles database
+type Permission string
+
+const (
+	PermJobsReadAll   Permission = "jobs:read_all"
+	PermJobsCreate    Permission = "jobs:create"
+	PermJobsUpdate    Permission = "jobs:update"
+	PermJobsUpdateAll Permission = "jobs:update_all"
+	PermJobsTriage    Permission = "jobs:triage"
+	PermJobsAssign    Permission = "jobs:assign"
+	PermJobsCancel    Permission = "jobs:cancel"
+	PermJobsReopen    Permission = "jobs:reopen"
+	PermJobsTemplates Permission = "jobs:templates"
+	PermJobsDelete    Permission = "jobs:delete"
+
+	PermCommentsModerate Permission = "comments:moderate"
+
+	PermFilesWrite   Permission = "files:write"
+	PermFilesArchive Permission = "files:archive"
+	PermFilesDelete  Permission = "files:delete"
+	PermFilesAdmin   Permission = "files:admin"
+
+	PermRolesManage Permission = "roles:manage"
+	PermTeamsManage Permission = "teams:manage"
+)
+
+// define list of all known permissions
+var Permissions = []Permission{
+	PermJobsReadAll, PermJobsCreate, PermJobsUpdate, PermJobsUpdateAll,
+	PermJobsTriage, PermJobsAssign, PermJobsCancel, PermJobsReopen,
+	PermJobsTemplates, PermJobsDelete, PermCommentsModerate, PermFilesWrite,
+	PermFilesArchive, PermFilesDelete, PermFilesAdmin, PermRolesManage,
+	PermTeamsManage,
+}
+
+func (p Permission) IsValid() bool {
+	for _, known := range Permissions {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
+
+// define struct used to store the role of a user along
+// with the permissions granted to the role
+type Grant struct {
+	Role        Role
+	Permissions []Permission
+}
+
+// function used to determine if a grant contains a permission
+func (g Grant) Has(permission Permission) bool {
+	for _, p := range g.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
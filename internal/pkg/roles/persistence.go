@@ -1,6 +1,11 @@
 package roles
 
-import "errors"
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type Role int
 
@@ -12,7 +17,11 @@ func (r Role) IsValid() bool {
 	return r >= 1 && r <= 4
 }
 
-var ErrInvalidRole = errors.New("cannot convert to role: invalid role")
+var (
+	ErrInvalidRole       = errors.New("cannot convert to role: invalid role")
+	ErrRoleGrantNotFound = errors.New("user has not been granted a role")
+	ErrLastAdmin         = errors.New("cannot remove role of last admin")
+)
 
 func StringToRole(role string) (Role, error) {
 	var r Role
@@ -40,5 +49,31 @@ const (
 
 type Persistence interface {
 	GetUserRole(uid string) (Role, error)
-	SetUserRole(uid string, role Role) error
+	// role changes are recorded in the audit table along with the user
+	// that granted the role, and fail with ErrLastAdmin if no admin
+	// would remain after the change
+	SetUserRole(uid string, role Role, actor string) error
+	RevokeUserRole(uid, actor string) error
+	ListRoleGrants(role Role) ([]RoleGrant, error)
+	GetUserGrant(uid string) (Grant, error)
+	ListRolePermissions() (map[Role][]Permission, error)
+	SetRolePermissions(role Role, permissions []Permission) error
+
+	CreateTeam(team Team) (uuid.UUID, error)
+	GetTeam(teamId uuid.UUID) (Team, error)
+	ListTeams() ([]Team, error)
+	ListUserTeams(uid string) ([]Team, error)
+	DeleteTeam(teamId uuid.UUID) error
+	AddTeamMember(teamId uuid.UUID, uid string, lead bool) error
+	RemoveTeamMember(teamId uuid.UUID, uid string) error
+}
+
+// define struct used to store the role granted to a user along
+// with the user that last granted the role. grants made before
+// role changes were audited have no granting user
+type RoleGrant struct {
+	Uid       string
+	Role      Role
+	GrantedBy *string
+	Granted   *time.Time
 }
@@ -3,9 +3,11 @@ package roles
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/PSauerborn/gamma-project/internal/pkg/roles"
 	"github.com/PSauerborn/gamma-project/internal/pkg/utils"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
 	log "github.com/sirupsen/logrus"
 )
@@ -31,10 +33,187 @@ func (db *PostgresPersistence) GetUserRole(uid string) (roles.Role, error) {
 	return r, nil
 }
 
-func (db *PostgresPersistence) SetUserRole(uid string, r roles.Role) error {
+func (db *PostgresPersistence) SetUserRole(uid string, r roles.Role, actor string) error {
 	log.Debug(fmt.Sprintf("setting user %s with role %d...", uid, r))
-	query := `INSERT INTO user_roles(uid, role) VALUES($1,$2)
-	ON CONFLICT (uid) DO UPDATE SET role = $2`
-	_, err := db.Session.Exec(context.Background(), query, uid, r)
-	return err
+	return db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		return changeUserRole(ctx, tx, uid, &r, actor)
+	})
+}
+
+// db function used to remove the role granted to a user. users
+// without a role are granted the permissions of the Standard role
+func (db *PostgresPersistence) RevokeUserRole(uid, actor string) error {
+	log.Debug(fmt.Sprintf("revoking role of user %s...", uid))
+	return db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		return changeUserRole(ctx, tx, uid, nil, actor)
+	})
+}
+
+// function used to replace or remove (if role is nil) the role granted
+// to a user, and record the change in the audit table. admin grants are
+// locked before the grant of the user is read, so that concurrent
+// requests cannot remove the last admin
+func changeUserRole(ctx context.Context, tx pgx.Tx, uid string, role *roles.Role,
+	actor string) error {
+	admins := map[string]bool{}
+	query := `SELECT uid FROM user_roles WHERE role=$1 ORDER BY uid FOR UPDATE`
+	rows, err := tx.Query(ctx, query, roles.Admin)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve admins: %+v", err))
+		return err
+	}
+	for rows.Next() {
+		var admin string
+		if err := rows.Scan(&admin); err != nil {
+			rows.Close()
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			return err
+		}
+		admins[admin] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Error(fmt.Errorf("unable to retrieve admins: %+v", err))
+		return err
+	}
+
+	var previous *roles.Role
+	query = `SELECT role FROM user_roles WHERE uid=$1 FOR UPDATE`
+	if err := tx.QueryRow(ctx, query, uid).Scan(&previous); err != nil && err != pgx.ErrNoRows {
+		log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+		return err
+	}
+	if previous == nil && role == nil {
+		return roles.ErrRoleGrantNotFound
+	}
+	if admins[uid] && len(admins) == 1 && (role == nil || *role != roles.Admin) {
+		return roles.ErrLastAdmin
+	}
+
+	if role == nil {
+		query = `DELETE FROM user_roles WHERE uid=$1`
+		_, err = tx.Exec(ctx, query, uid)
+	} else {
+		query = `INSERT INTO user_roles(uid, role) VALUES($1,$2)
+		ON CONFLICT (uid) DO UPDATE SET role = $2`
+		_, err = tx.Exec(ctx, query, uid, *role)
+	}
+	if err != nil {
+		log.Error(fmt.Errorf("unable to modify user role: %+v", err))
+		return err
+	}
+	query = `INSERT INTO role_grants_audit(audit_id,uid,role,previous_role,granted_by,granted)
+	VALUES($1,$2,$3,$4,$5,$6)`
+	if _, err := tx.Exec(ctx, query, uuid.New(), uid, role, previous, actor,
+		time.Now().UTC()); err != nil {
+		log.Error(fmt.Errorf("unable to insert role audit entry: %+v", err))
+		return err
+	}
+	return nil
+}
+
+// db function used to list the users that have been granted a
+// given role along with the user that last granted the role
+func (db *PostgresPersistence) ListRoleGrants(role roles.Role) ([]roles.RoleGrant, error) {
+	log.Debug(fmt.Sprintf("fetching users with role %d...", role))
+	grants := []roles.RoleGrant{}
+	query := `SELECT r.uid, r.role, a.granted_by, a.granted FROM user_roles r
+	LEFT JOIN LATERAL (SELECT granted_by, granted FROM role_grants_audit
+		WHERE uid = r.uid ORDER BY granted DESC LIMIT 1) a ON TRUE
+	WHERE r.role=$1 ORDER BY r.uid`
+	rows, err := db.Session.Query(context.Background(), query, role)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve role grants: %+v", err))
+		return grants, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g roles.RoleGrant
+		if err := rows.Scan(&g.Uid, &g.Role, &g.GrantedBy, &g.Granted); err != nil {
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			return grants, err
+		}
+		grants = append(grants, g)
+	}
+	return grants, rows.Err()
+}
+
+// db function used to retrieve the role of a user along with the
+// permissions granted to the role. users without a role are
+// granted the permissions of the Standard role
+func (db *PostgresPersistence) GetUserGrant(uid string) (roles.Grant, error) {
+	log.Debug(fmt.Sprintf("fetching permissions for user %s...", uid))
+	var (
+		role        roles.Role
+		permissions []string
+	)
+	query := `SELECT r.role, COALESCE(array_agg(p.permission ORDER BY p.permission)
+	FILTER (WHERE p.permission IS NOT NULL), '{}')
+	FROM (SELECT COALESCE((SELECT role FROM user_roles WHERE uid=$1), $2) AS role) r
+	LEFT JOIN role_permissions p ON p.role = r.role GROUP BY r.role`
+	row := db.Session.QueryRow(context.Background(), query, uid, roles.Standard)
+	if err := row.Scan(&role, &permissions); err != nil {
+		log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+		return roles.Grant{}, err
+	}
+	grant := roles.Grant{Role: role, Permissions: []roles.Permission{}}
+	for _, p := range permissions {
+		grant.Permissions = append(grant.Permissions, roles.Permission(p))
+	}
+	return grant, nil
+}
+
+// db function used to retrieve the permissions granted to each role
+func (db *PostgresPersistence) ListRolePermissions() (map[roles.Role][]roles.Permission, error) {
+	log.Debug("fetching role permissions...")
+	results := map[roles.Role][]roles.Permission{}
+	for r := roles.Standard; r <= roles.Admin; r++ {
+		results[r] = []roles.Permission{}
+	}
+	query := `SELECT role, permission FROM role_permissions ORDER BY role, permission`
+	rows, err := db.Session.Query(context.Background(), query)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve role permissions: %+v", err))
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			role       roles.Role
+			permission string
+		)
+		if err := rows.Scan(&role, &permission); err != nil {
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			return results, err
+		}
+		results[role] = append(results[role], roles.Permission(permission))
+	}
+	return results, rows.Err()
+}
+
+// db function used to replace the permissions granted to a role
+func (db *PostgresPersistence) SetRolePermissions(role roles.Role,
+	permissions []roles.Permission) error {
+	log.Debug(fmt.Sprintf("setting permissions for role %s...", role))
+	values := []string{}
+	for _, p := range permissions {
+		values = append(values, string(p))
+	}
+
+	return db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		query := `DELETE FROM role_permissions WHERE role=$1`
+		if _, err := tx.Exec(ctx, query, role); err != nil {
+			log.Error(fmt.Errorf("unable to remove role permissions: %+v", err))
+			return err
+		}
+		query = `INSERT INTO role_permissions(role, permission)
+		SELECT $1, UNNEST($2::text[]) ON CONFLICT DO NOTHING`
+		if _, err := tx.Exec(ctx, query, role, values); err != nil {
+			log.Error(fmt.Errorf("unable to insert role permissions: %+v", err))
+			return err
+		}
+		return nil
+	})
 }
@@ -0,0 +1,167 @@
+package roles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/roles"
+)
+
+// define postgres error code returned when unique constraints are violated
+const uniqueViolation = "23505"
+
+// db function used to create a new team along with its initial members
+func (db *PostgresPersistence) CreateTeam(team roles.Team) (uuid.UUID, error) {
+	log.Info(fmt.Sprintf("creating new team %s...", team.Name))
+	teamId, now := uuid.New(), time.Now().UTC()
+	err := db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		query := `INSERT INTO teams(team_id,name,creator,created) VALUES($1,$2,$3,$4)`
+		if _, err := tx.Exec(ctx, query, teamId, team.Name, team.Creator, now); err != nil {
+			log.Error(fmt.Errorf("unable to insert team: %+v", err))
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+				return roles.ErrTeamExists
+			}
+			return err
+		}
+		for _, m := range team.Members {
+			if err := addTeamMember(ctx, tx, teamId, m.Uid, m.Lead, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return teamId, err
+}
+
+// function used to add a member to a team, or modify the
+// lead flag of an existing member
+func addTeamMember(ctx context.Context, tx pgx.Tx, teamId uuid.UUID, uid string,
+	lead bool, added time.Time) error {
+	query := `INSERT INTO team_members(team_id,uid,lead,added) VALUES($1,$2,$3,$4)
+	ON CONFLICT (team_id,uid) DO UPDATE SET lead=$3`
+	if _, err := tx.Exec(ctx, query, teamId, uid, lead, added); err != nil {
+		log.Error(fmt.Errorf("unable to add team member: %+v", err))
+		return err
+	}
+	return nil
+}
+
+// db function used to retrieve a team along with its members
+func (db *PostgresPersistence) GetTeam(teamId uuid.UUID) (roles.Team, error) {
+	log.Debug(fmt.Sprintf("fetching team %s...", teamId))
+	teams, err := db.listTeams(`WHERE t.team_id=$1`, teamId)
+	if err != nil {
+		return roles.Team{}, err
+	}
+	if len(teams) == 0 {
+		return roles.Team{}, roles.ErrTeamNotFound
+	}
+	return teams[0], nil
+}
+
+// db function used to list all teams
+func (db *PostgresPersistence) ListTeams() ([]roles.Team, error) {
+	log.Debug("fetching teams...")
+	return db.listTeams(``)
+}
+
+// db function used to list the teams that a user is a member of
+func (db *PostgresPersistence) ListUserTeams(uid string) ([]roles.Team, error) {
+	log.Debug(fmt.Sprintf("fetching teams for user %s...", uid))
+	return db.listTeams(`WHERE t.team_id IN (SELECT team_id FROM team_members WHERE uid=$1)`, uid)
+}
+
+// function used to list teams matching a given condition along with
+// their members. teams without members are included
+func (db *PostgresPersistence) listTeams(condition string, args ...interface{}) (
+	[]roles.Team, error) {
+	teams := []roles.Team{}
+	query := fmt.Sprintf(`SELECT t.team_id,t.name,t.creator,t.created,m.uid,m.lead,m.added
+	FROM teams t LEFT JOIN team_members m ON m.team_id = t.team_id %s
+	ORDER BY t.name, m.added`, condition)
+	rows, err := db.Session.Query(context.Background(), query, args...)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve teams: %+v", err))
+		return teams, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			t     roles.Team
+			uid   *string
+			lead  *bool
+			added *time.Time
+		)
+		if err := rows.Scan(&t.TeamId, &t.Name, &t.Creator, &t.Created, &uid, &lead,
+			&added); err != nil {
+			log.Error(fmt.Errorf("unable to scan data into local variables: %+v", err))
+			return teams, err
+		}
+		// rows are ordered by team, so members are added to the last team
+		if len(teams) == 0 || teams[len(teams)-1].TeamId != t.TeamId {
+			t.Members = []roles.TeamMember{}
+			teams = append(teams, t)
+		}
+		if uid != nil {
+			current := &teams[len(teams)-1]
+			current.Members = append(current.Members, roles.TeamMember{Uid: *uid,
+				Lead: *lead, Added: *added})
+		}
+	}
+	return teams, rows.Err()
+}
+
+// db function used to delete a team along with its members
+func (db *PostgresPersistence) DeleteTeam(teamId uuid.UUID) error {
+	log.Info(fmt.Sprintf("deleting team %s...", teamId))
+	return db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		query := `DELETE FROM team_members WHERE team_id=$1`
+		if _, err := tx.Exec(ctx, query, teamId); err != nil {
+			log.Error(fmt.Errorf("unable to remove team members: %+v", err))
+			return err
+		}
+		query = `DELETE FROM teams WHERE team_id=$1`
+		result, err := tx.Exec(ctx, query, teamId)
+		if err != nil {
+			log.Error(fmt.Errorf("unable to delete team: %+v", err))
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			return roles.ErrTeamNotFound
+		}
+		return nil
+	})
+}
+
+// db function used to add a member to a team. adding an existing
+// member modifies whether the member is a team lead
+func (db *PostgresPersistence) AddTeamMember(teamId uuid.UUID, uid string, lead bool) error {
+	log.Info(fmt.Sprintf("adding user %s to team %s...", uid, teamId))
+	return db.WithTransaction(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		return addTeamMember(ctx, tx, teamId, uid, lead, time.Now().UTC())
+	})
+}
+
+// db function used to remove a member from a team
+func (db *PostgresPersistence) RemoveTeamMember(teamId uuid.UUID, uid string) error {
+	log.Info(fmt.Sprintf("removing user %s from team %s...", uid, teamId))
+	query := `DELETE FROM team_members WHERE team_id=$1 AND uid=$2`
+	result, err := db.Session.Exec(context.Background(), query, teamId, uid)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to remove team member: %+v", err))
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return roles.ErrTeamMemberNotFound
+	}
+	return nil
+}
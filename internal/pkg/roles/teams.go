@@ -0,0 +1,260 @@
+package roles
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// define custom errors for teams
+	ErrTeamNotFound       = errors.New("cannot find team with specified ID")
+	ErrTeamExists         = errors.New("team with specified name already exists")
+	ErrTeamMemberNotFound = errors.New("user is not a member of team")
+)
+
+// define struct used to store teams. jobs can be assigned to the
+// queue of a team, from which they are claimed by team members
+type Team struct {
+	TeamId  uuid.UUID    `json:"team_id"`
+	Name    string       `json:"name"`
+	Creator string       `json:"creator"`
+	Created time.Time    `json:"created"`
+	Members []TeamMember `json:"members"`
+}
+
+// define struct used to store members of a team. team leads
+// can add and remove members of their team
+type TeamMember struct {
+	Uid   string    `json:"uid"`
+	Lead  bool      `json:"lead"`
+	Added time.Time `json:"added"`
+}
+
+// function used to determine if a user is a member of a team
+func (t Team) IsMember(uid string) bool {
+	for _, m := range t.Members {
+		if m.Uid == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// function used to determine if a user is a lead of a team
+func (t Team) IsLead(uid string) bool {
+	for _, m := range t.Members {
+		if m.Uid == uid && m.Lead {
+			return true
+		}
+	}
+	return false
+}
+
+// function used to parse team ID from request path and retrieve
+// team. requests are aborted if the team cannot be retrieved
+func getTeamFromPath(ctx *gin.Context) (Team, bool) {
+	teamId, err := uuid.Parse(ctx.Param("teamId"))
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse team ID: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid team ID"})
+		return Team{}, false
+	}
+	team, err := persistence.GetTeam(teamId)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve team: %+v", err))
+		switch err {
+		case ErrTeamNotFound:
+			status := http.StatusNotFound
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Cannot find team with specified ID"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
+		return team, false
+	}
+	return team, true
+}
+
+// function used to abort requests from users that cannot manage the
+// members of a team. members are managed by team leads and by users
+// with the teams:manage permission. returns false if aborted
+func requireTeamLead(ctx *gin.Context, uid string, team Team) bool {
+	if team.IsLead(uid) {
+		return true
+	}
+	return requirePermission(ctx, uid, PermTeamsManage)
+}
+
+// API handler used to list teams. teams can be filtered to
+// the teams that a given user is a member of
+func ListTeamsHandler(ctx *gin.Context) {
+	log.Info("received request to list teams")
+	var (
+		teams []Team
+		err   error
+	)
+	if member := ctx.Query("member"); len(member) > 0 {
+		teams, err = persistence.ListUserTeams(member)
+	} else {
+		teams, err = persistence.ListTeams()
+	}
+	if err != nil {
+		log.Error(fmt.Errorf("unable to retrieve teams: %+v", err))
+		status := http.StatusInternalServerError
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Internal server error"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK, "teams": teams})
+}
+
+// API handler used to create a new team. the given leads are
+// added as members of the team
+func CreateTeamHandler(ctx *gin.Context) {
+	log.Info("received request to create team")
+	uid := ctx.MustGet("uid").(string)
+	if !requirePermission(ctx, uid, PermTeamsManage) {
+		return
+	}
+
+	var r struct {
+		Name  string   `json:"name" binding:"required"`
+		Leads []string `json:"leads"`
+	}
+	if err := ctx.ShouldBind(&r); err != nil {
+		log.Error(fmt.Errorf("unable to parse request body: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid request body"})
+		return
+	}
+	team := Team{Name: r.Name, Creator: uid, Members: []TeamMember{}}
+	for _, lead := range r.Leads {
+		team.Members = append(team.Members, TeamMember{Uid: lead, Lead: true})
+	}
+
+	teamId, err := persistence.CreateTeam(team)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to create team: %+v", err))
+		switch err {
+		case ErrTeamExists:
+			status := http.StatusConflict
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Team with specified name already exists"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK, "team_id": teamId})
+}
+
+// API handler used to retrieve a team along with its members
+func GetTeamHandler(ctx *gin.Context) {
+	log.Info("received request to retrieve team")
+	team, ok := getTeamFromPath(ctx)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK, "team": team})
+}
+
+// API handler used to delete a team
+func DeleteTeamHandler(ctx *gin.Context) {
+	log.Info("received request to delete team")
+	uid := ctx.MustGet("uid").(string)
+	if !requirePermission(ctx, uid, PermTeamsManage) {
+		return
+	}
+	team, ok := getTeamFromPath(ctx)
+	if !ok {
+		return
+	}
+	if err := persistence.DeleteTeam(team.TeamId); err != nil {
+		log.Error(fmt.Errorf("unable to delete team: %+v", err))
+		switch err {
+		case ErrTeamNotFound:
+			status := http.StatusNotFound
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Cannot find team with specified ID"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"message": "Successfully deleted team"})
+}
+
+// API handler used to add a member to a team. adding an existing
+// member modifies whether the member is a team lead
+func AddTeamMemberHandler(ctx *gin.Context) {
+	log.Info("received request to add team member")
+	uid := ctx.MustGet("uid").(string)
+	team, ok := getTeamFromPath(ctx)
+	if !ok || !requireTeamLead(ctx, uid, team) {
+		return
+	}
+
+	var r struct {
+		Uid  string `json:"uid" binding:"required"`
+		Lead bool   `json:"lead"`
+	}
+	if err := ctx.ShouldBind(&r); err != nil {
+		log.Error(fmt.Errorf("unable to parse request body: %+v", err))
+		status := http.StatusBadRequest
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Invalid request body"})
+		return
+	}
+	if err := persistence.AddTeamMember(team.TeamId, r.Uid, r.Lead); err != nil {
+		log.Error(fmt.Errorf("unable to add team member: %+v", err))
+		status := http.StatusInternalServerError
+		ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+			"message": "Internal server error"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"message": "Successfully added team member"})
+}
+
+// API handler used to remove a member from a team
+func RemoveTeamMemberHandler(ctx *gin.Context) {
+	log.Info("received request to remove team member")
+	uid := ctx.MustGet("uid").(string)
+	team, ok := getTeamFromPath(ctx)
+	if !ok || !requireTeamLead(ctx, uid, team) {
+		return
+	}
+
+	if err := persistence.RemoveTeamMember(team.TeamId, ctx.Param("uid")); err != nil {
+		log.Error(fmt.Errorf("unable to remove team member: %+v", err))
+		switch err {
+		case ErrTeamMemberNotFound:
+			status := http.StatusNotFound
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "User is not a member of team"})
+		default:
+			status := http.StatusInternalServerError
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Internal server error"})
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+		"message": "Successfully removed team member"})
+}
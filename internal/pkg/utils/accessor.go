@@ -1,18 +1,32 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// define interface used to retrieve bearer tokens that
+// authenticate requests sent between services
+type TokenSource interface {
+	Token() (string, error)
+}
+
 type BaseAPIAccessor struct {
 	Host     string
 	Port     *int
 	Protocol string
+	// client used to execute requests. a new client
+	// without timeout is used for each request if unset
+	Client *http.Client
+	// source of tokens used to authenticate requests. requests
+	// are only identified by the user header if unset
+	Tokens TokenSource
 }
 
 // function used to execute a given request
@@ -20,7 +34,10 @@ func (accessor *BaseAPIAccessor) ExecuteRequest(request *http.Request) (*http.Re
 	// generate new HTTP client and execute request
 	start := time.Now()
 	log.Debug(fmt.Sprintf("making request to url %s...", request.URL))
-	client := &http.Client{}
+	client := accessor.Client
+	if client == nil {
+		client = &http.Client{}
+	}
 	resp, err := client.Do(request)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to execute HTTP request: %+v", err))
@@ -35,6 +52,7 @@ func (accessor *BaseAPIAccessor) ExecuteRequest(request *http.Request) (*http.Re
 // function to format url using a given protocol. host and port
 // are inserted based on the values passed to the accessor
 func (accessor *BaseAPIAccessor) FormatURL(url string) string {
+	url = strings.TrimPrefix(url, "/")
 	if accessor.Port != nil {
 		return fmt.Sprintf("%s://%s:%d/%s", accessor.Protocol, accessor.Host, *accessor.Port, url)
 	} else {
@@ -46,8 +64,16 @@ func (accessor *BaseAPIAccessor) FormatURL(url string) string {
 // a given method, url and body
 func (accessor *BaseAPIAccessor) NewJSONRequest(method, url string, body io.Reader,
 	headers map[string]string) (*http.Request, error) {
+	return accessor.NewJSONRequestWithContext(context.Background(), method, url, body, headers)
+}
+
+// function to generate new HTTP request with JSON settings that is
+// cancelled when the given context is done. headers provided override
+// the JSON content type
+func (accessor *BaseAPIAccessor) NewJSONRequestWithContext(ctx context.Context, method,
+	url string, body io.Reader, headers map[string]string) (*http.Request, error) {
 	// generate new HTTP request with given settings
-	req, err := http.NewRequest(method, url, body)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		log.Error(fmt.Errorf("unable to generate new HTTP Request: %+v", err))
 		return nil, err
@@ -60,3 +86,20 @@ func (accessor *BaseAPIAccessor) NewJSONRequest(method, url string, body io.Read
 	}
 	return req, nil
 }
+
+// function used to identify the sender of a request. the user ID is
+// always sent as a header for services behind a trusted gateway, and
+// a bearer token is attached if the accessor has a token source
+func (accessor *BaseAPIAccessor) Authorize(request *http.Request, userId string) error {
+	request.Header.Set("X-Authenticated-Userid", userId)
+	if accessor.Tokens == nil {
+		return nil
+	}
+	token, err := accessor.Tokens.Token()
+	if err != nil {
+		log.Error(fmt.Errorf("unable to generate service token: %+v", err))
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
@@ -0,0 +1,252 @@
+// package pgtest provides an in-memory implementation of the postgres
+// session used by the persistence layers. statements are not executed,
+// but are recorded and only persisted once their transaction commits,
+// which allows tests to inject failures between the statements of a
+// transaction and verify that nothing is persisted
+package pgtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrInjected = errors.New("injected failure")
+
+// define struct used to store a statement executed against a session
+type Statement struct {
+	SQL  string
+	Args []interface{}
+}
+
+// define function type used to return the rows selected by a query
+type RowsFunc func(sql string, args []interface{}) [][]interface{}
+
+// define struct used to implement an in-memory postgres session
+type Session struct {
+	// function used to return rows for queries. queries return no
+	// rows if no function is set
+	Rows RowsFunc
+	// position of the statement within a transaction that fails with
+	// ErrInjected, starting from 1. statements never fail if 0
+	FailAt int
+
+	mu        sync.Mutex
+	committed []Statement
+	rollbacks int
+}
+
+// function used to retrieve all statements that have been persisted,
+// either directly or via committed transactions
+func (s *Session) Committed() []Statement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Statement{}, s.committed...)
+}
+
+// function used to retrieve the number of rolled back transactions
+func (s *Session) Rollbacks() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rollbacks
+}
+
+func (s *Session) Begin(ctx context.Context) (pgx.Tx, error) {
+	return &Tx{session: s}, nil
+}
+
+func (s *Session) Exec(ctx context.Context, sql string, args ...interface{}) (
+	pgconn.CommandTag, error) {
+	s.persist([]Statement{{SQL: sql, Args: args}})
+	return commandTag(sql), nil
+}
+
+func (s *Session) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	s.persist([]Statement{{SQL: sql, Args: args}})
+	return s.rows(sql, args), nil
+}
+
+func (s *Session) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	s.persist([]Statement{{SQL: sql, Args: args}})
+	return s.rows(sql, args)
+}
+
+func (s *Session) Close() {}
+
+func (s *Session) persist(statements []Statement) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.committed = append(s.committed, statements...)
+}
+
+func (s *Session) rows(sql string, args []interface{}) *Rows {
+	if s.Rows == nil {
+		return &Rows{}
+	}
+	return &Rows{values: s.Rows(sql, args)}
+}
+
+// define struct used to implement an in-memory transaction. methods
+// that are not used by the persistence layers are not implemented
+type Tx struct {
+	pgx.Tx
+	session *Session
+	pending []Statement
+	done    bool
+}
+
+// function used to record a statement in the transaction. ErrInjected
+// is returned if the statement is selected to fail
+func (tx *Tx) record(sql string, args []interface{}) error {
+	if tx.done {
+		return pgx.ErrTxClosed
+	}
+	tx.pending = append(tx.pending, Statement{SQL: sql, Args: args})
+	if len(tx.pending) == tx.session.FailAt {
+		return fmt.Errorf("%w at statement %d: %s", ErrInjected, len(tx.pending),
+			strings.TrimSpace(sql))
+	}
+	return nil
+}
+
+func (tx *Tx) Exec(ctx context.Context, sql string, args ...interface{}) (
+	pgconn.CommandTag, error) {
+	if err := tx.record(sql, args); err != nil {
+		return nil, err
+	}
+	return commandTag(sql), nil
+}
+
+func (tx *Tx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if err := tx.record(sql, args); err != nil {
+		return nil, err
+	}
+	return tx.session.rows(sql, args), nil
+}
+
+func (tx *Tx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if err := tx.record(sql, args); err != nil {
+		return &Rows{err: err}
+	}
+	return tx.session.rows(sql, args)
+}
+
+func (tx *Tx) Commit(ctx context.Context) error {
+	if tx.done {
+		return pgx.ErrTxClosed
+	}
+	tx.done = true
+	tx.session.persist(tx.pending)
+	return nil
+}
+
+func (tx *Tx) Rollback(ctx context.Context) error {
+	if tx.done {
+		return pgx.ErrTxClosed
+	}
+	tx.done = true
+	tx.session.mu.Lock()
+	defer tx.session.mu.Unlock()
+	tx.session.rollbacks++
+	return nil
+}
+
+// define struct used to implement in-memory rows. rows are also used
+// as the result of QueryRow, which returns pgx.ErrNoRows if empty.
+// methods that are not used by the persistence layers are not implemented
+type Rows struct {
+	pgx.Rows
+	values  [][]interface{}
+	current []interface{}
+	err     error
+}
+
+func (r *Rows) Close()     {}
+func (r *Rows) Err() error { return r.err }
+
+func (r *Rows) Next() bool {
+	if r.err != nil || len(r.values) == 0 {
+		return false
+	}
+	r.current, r.values = r.values[0], r.values[1:]
+	return true
+}
+
+func (r *Rows) Values() ([]interface{}, error) {
+	return r.current, r.err
+}
+
+// function used to scan the current row into the given destinations.
+// if no row has been selected the first row is scanned, which allows
+// rows to be used as the result of QueryRow
+func (r *Rows) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.current == nil && !r.Next() {
+		return pgx.ErrNoRows
+	}
+	if len(dest) != len(r.current) {
+		return fmt.Errorf("expected %d destinations, got %d", len(r.current), len(dest))
+	}
+	for i, d := range dest {
+		if d == nil || r.current[i] == nil {
+			continue
+		}
+		target := reflect.ValueOf(d).Elem()
+		value := reflect.ValueOf(r.current[i])
+		if !value.Type().ConvertibleTo(target.Type()) {
+			return fmt.Errorf("cannot scan %T into %T", r.current[i], d)
+		}
+		target.Set(value.Convert(target.Type()))
+	}
+	return nil
+}
+
+// function used to generate the command tag of a statement. all
+// statements are reported to affect a single row
+func commandTag(sql string) pgconn.CommandTag {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return pgconn.CommandTag("")
+	}
+	return pgconn.CommandTag(strings.ToUpper(fields[0]) + " 1")
+}
+
+// function used to verify that an operation executing a transaction
+// is atomic. the operation is first executed without failures to count
+// its statements, and then executed with a failure injected at each
+// statement in turn. no statement may be persisted if any fails
+func CheckAtomic(t *testing.T, rows RowsFunc, op func(s *Session) error) {
+	t.Helper()
+	s := &Session{Rows: rows}
+	if err := op(s); err != nil {
+		t.Fatalf("unexpected error without injected failures: %+v", err)
+	}
+	statements := len(s.Committed())
+	t.Logf("operation executed %d statements", statements)
+	if statements == 0 {
+		t.Fatal("expected operation to persist statements")
+	}
+
+	for i := 1; i <= statements; i++ {
+		s := &Session{Rows: rows, FailAt: i}
+		if err := op(s); !errors.Is(err, ErrInjected) {
+			t.Errorf("statement %d: expected injected failure, got %+v", i, err)
+		}
+		if committed := s.Committed(); len(committed) > 0 {
+			t.Errorf("statement %d: expected no statements to be persisted, got %d",
+				i, len(committed))
+		}
+		if s.Rollbacks() != 1 {
+			t.Errorf("statement %d: expected transaction to be rolled back", i)
+		}
+	}
+}
@@ -4,13 +4,26 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	log "github.com/sirupsen/logrus"
 )
 
+// define interface used to execute statements against postgres. the
+// interface is implemented by *pgxpool.Pool, and allows sessions to be
+// replaced in tests to inject failures between statements
+type Querier interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Close()
+}
+
 type BasePostgresPersistence struct {
 	DatabaseURL string
-	Session     *pgxpool.Pool
+	Session     Querier
 }
 
 // function to connect persistence to postgres server
@@ -31,3 +44,35 @@ func (db *BasePostgresPersistence) Connect() error {
 func (db *BasePostgresPersistence) Close() {
 	db.Session.Close()
 }
+
+// define function type executed within a database transaction
+type TxFunc func(ctx context.Context, tx pgx.Tx) error
+
+// function used to execute a function within a database transaction.
+// the transaction is committed if the function returns without error
+// and rolled back otherwise, including if the function panics
+func (db *BasePostgresPersistence) WithTransaction(ctx context.Context, fn TxFunc) (err error) {
+	tx, err := db.Session.Begin(ctx)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to start transaction: %+v", err))
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback(ctx)
+			panic(p)
+		}
+	}()
+
+	if err := fn(ctx, tx); err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil {
+			log.Error(fmt.Errorf("unable to rollback transaction: %+v", rbErr))
+		}
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Error(fmt.Errorf("unable to commit transaction: %+v", err))
+		return err
+	}
+	return nil
+}
@@ -2,62 +2,185 @@ package filestore
 
 import (
 	"fmt"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/PSauerborn/gamma-project/internal/pkg/filestore"
+	blobs "github.com/PSauerborn/gamma-project/internal/pkg/filestore/blobs"
 	db "github.com/PSauerborn/gamma-project/internal/pkg/filestore/persistence"
+	"github.com/PSauerborn/gamma-project/internal/pkg/roles"
 	"github.com/PSauerborn/gamma-project/pkg/utils"
 )
 
-// function used to generate new API instance
-func NewFilestoreAPI(persistence filestore.FileStorePersistence) *gin.Engine {
+// define interface for blob stores used to store file contents
+type BlobStore = filestore.BlobStore
+
+// function used to generate new service config. roles are retrieved
+// with tokens from the given source if set
+func NewServiceConfig(maxUploadSize int64, policies []filestore.RetentionPolicy,
+	orphanGracePeriod time.Duration, rolesAPIHost string,
+	tokens utils.TokenSource) (filestore.ServiceConfig, error) {
+	cache, err := utils.NewRoleCache(rolesAPIHost, "filestore-api", tokens)
+	if err != nil {
+		return filestore.ServiceConfig{}, err
+	}
+	return filestore.ServiceConfig{
+		MaxUploadSize:     maxUploadSize,
+		RetentionPolicies: policies,
+		OrphanGracePeriod: orphanGracePeriod,
+		Roles:             cache,
+	}, nil
+}
+
+// function used to parse retention policies from JSON
+func ParseRetentionPolicies(body string) ([]filestore.RetentionPolicy, error) {
+	return filestore.ParseRetentionPolicies(body)
+}
+
+// function used to generate new retention engine
+func NewRetentionEngine(p filestore.FileStorePersistence, policies []filestore.RetentionPolicy,
+	interval time.Duration) *filestore.RetentionEngine {
+	return &filestore.RetentionEngine{
+		Persistence: p,
+		Policies:    policies,
+		Interval:    interval,
+	}
+}
+
+// function used to generate new consistency checker
+func NewConsistencyChecker(p filestore.FileStorePersistence, interval,
+	gracePeriod time.Duration, repair bool) *filestore.ConsistencyChecker {
+	return &filestore.ConsistencyChecker{
+		Persistence: p,
+		Interval:    interval,
+		GracePeriod: gracePeriod,
+		Repair:      repair,
+	}
+}
+
+// function used to generate new API instance. requests are
+// authenticated with the given authenticator
+func NewFilestoreAPI(persistence filestore.FileStorePersistence,
+	cfg filestore.ServiceConfig, auth utils.Authenticator) *gin.Engine {
 	// set instance of persistence globally in module
 	filestore.SetFilePersistence(persistence)
+	filestore.SetConfig(cfg)
 
 	// generate new gin router with default middleware
 	r := gin.Default()
-	r.Use(utils.UserHeaderMiddleware())
+	r.Use(utils.AuthMiddleware(auth))
 
 	r.GET("/filestore/health", filestore.HealthCheckHandler)
 	// define routes used to retrieve files
 	r.GET("/filestore/files", filestore.ListFilesHandler)
 	r.GET("/filestore/file/:fileId/content", filestore.GetFileHandler)
 	r.GET("/filestore/file/:fileId/meta", filestore.GetFileMetadataHandler)
+	r.GET("/filestore/file/:fileId/versions", filestore.ListFileVersionsHandler)
 
-	// define routes used to create and modify files
-	r.POST("/filestore/file", filestore.CreateFileHandler)
-	r.PUT("/filestore/file/:fileId", filestore.PutFileHandler)
-	r.PUT("/filestore/file/:fileId/archive", filestore.ArchiveFileHandler)
-	r.DELETE("/filestore/file/:fileId", filestore.DeleteFileHandler)
+	// define routes used to create and modify files. permissions
+	// are retrieved from the roles API
+	write := utils.RequirePermission(roles.PermFilesWrite, cfg.Roles)
+	archive := utils.RequirePermission(roles.PermFilesArchive, cfg.Roles)
+	r.POST("/filestore/file", write, filestore.CreateFileHandler)
+	r.POST("/filestore/file/upload", write, filestore.UploadFileHandler)
+	r.PUT("/filestore/file/:fileId", write, filestore.PutFileHandler)
+	r.PUT("/filestore/file/:fileId/archive", archive, filestore.ArchiveFileHandler)
+	r.PUT("/filestore/file/:fileId/unarchive", archive, filestore.UnarchiveFileHandler)
+	r.PUT("/filestore/file/:fileId/versions/:version/restore", write,
+		filestore.RestoreFileVersionHandler)
+	r.DELETE("/filestore/file/:fileId", utils.RequirePermission(roles.PermFilesDelete,
+		cfg.Roles), filestore.DeleteFileHandler)
 
 	r.POST("/filestore/search", filestore.SearchFilesHandler)
+
+	// define admin routes used to report on retention and check storage consistency
+	admin := utils.RequirePermission(roles.PermFilesAdmin, cfg.Roles)
+	r.GET("/filestore/retention/report", admin, filestore.RetentionReportHandler)
+	r.GET("/filestore/admin/consistency", admin, filestore.ConsistencyReportHandler)
+	r.POST("/filestore/admin/consistency/repair", admin, filestore.RepairConsistencyHandler)
+
+	// define route used by the roles API to invalidate cached permissions
+	r.POST("/filestore/roles/invalidate", utils.RequireServiceOrPermission(roles.PermRolesManage,
+		cfg.Roles), utils.RoleCacheInvalidationHandler(cfg.Roles))
 	return r
 }
 
-// function used to generate new instance of API accessor
-func NewAccessor(host, protocol string, port int) filestore.FileStoreAPIAccessor {
+// function used to generate new instance of API accessor. requests
+// are sent on behalf of the given user, and authenticated with tokens
+// from the given source if set
+func NewAccessor(host, protocol string, port int, userId string,
+	tokens utils.TokenSource) *filestore.FileStoreAPIAccessor {
 	baseAccessor := utils.NewBaseAccessor(host, protocol, port)
-	return filestore.FileStoreAPIAccessor{
+	baseAccessor.Tokens = tokens
+	return &filestore.FileStoreAPIAccessor{
+		BaseAPIAccessor: baseAccessor,
+		UserId:          userId,
+	}
+}
+
+// function used to generate new instance of API accessor from
+// the base URL of the filestore API (e.g. http://localhost:10314)
+func NewAccessorFromURL(baseURL, userId string,
+	tokens utils.TokenSource) (*filestore.FileStoreAPIAccessor, error) {
+	baseAccessor, err := utils.NewBaseAccessorFromURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	baseAccessor.Tokens = tokens
+	return &filestore.FileStoreAPIAccessor{
 		BaseAPIAccessor: baseAccessor,
+		UserId:          userId,
+	}, nil
+}
+
+// function used to generate new instance of postgres metadata store
+func NewPostgresPersistence(url string) *db.PostgresPersistence {
+	basePersistence := utils.NewBasePersistence(url)
+	// generate new instance of base persistence
+	return &db.PostgresPersistence{
+		BasePostgresPersistence: basePersistence,
+	}
+}
+
+// function used to generate new file store from a metadata
+// store and a blob store
+func NewStore(metadata filestore.MetadataStore, blobs filestore.BlobStore) *filestore.Store {
+	return &filestore.Store{
+		Metadata: metadata,
+		Blobs:    blobs,
 	}
 }
 
-// function used to generate new instance of postgres persistence
-func NewPostgresPersistence(url, basePath string) *db.PostgresPersistence {
+// function used to generate new blob store on local disk
+func NewLocalBlobStore(basePath string) *blobs.LocalBlobStore {
 	directories := []string{
 		basePath,
-		fmt.Sprintf("%s/archive", basePath),
+		fmt.Sprintf("%s/tmp", basePath),
 	}
 	// generate required directories st start time
 	for _, dir := range directories {
 		os.MkdirAll(dir, os.ModePerm)
 	}
-	basePersistence := utils.NewBasePersistence(url)
-	// generate new instance of base persistence
-	return &db.PostgresPersistence{
-		BasePostgresPersistence: basePersistence,
-		BaseFilePath:            basePath,
+	return &blobs.LocalBlobStore{BasePath: basePath}
+}
+
+// function used to generate new blob store backed by an S3
+// compatible object store
+func NewS3BlobStore(endpoint, bucket, region, accessKey, secretKey string) *blobs.S3BlobStore {
+	return &blobs.S3BlobStore{
+		Endpoint:  endpoint,
+		Bucket:    bucket,
+		Region:    region,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Client:    &http.Client{},
 	}
 }
+
+// function used to generate new in-memory blob store
+func NewMemoryBlobStore() *blobs.MemoryBlobStore {
+	return blobs.NewMemoryBlobStore()
+}
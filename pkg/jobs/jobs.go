@@ -1,50 +1,119 @@
 package jobs
 
 import (
+	"time"
+
 	"github.com/PSauerborn/gamma-project/internal/pkg/jobs"
 	db "github.com/PSauerborn/gamma-project/internal/pkg/jobs/persistence"
 	"github.com/PSauerborn/gamma-project/internal/pkg/roles"
+	"github.com/PSauerborn/gamma-project/pkg/filestore"
 	"github.com/PSauerborn/gamma-project/pkg/utils"
 	"github.com/gin-gonic/gin"
 )
 
-func NewServiceConfig(fileHost, rolesHost string) jobs.ServiceConfig {
-	return jobs.ServiceConfig{
-		FilestoreHost: fileHost,
-		RolesAPIHost:  rolesHost,
+// function used to generate new service config. files are
+// uploaded to the filestore and roles and teams are retrieved from the
+// roles API on behalf of the jobs API, authenticated with tokens
+// from the given source if set
+func NewServiceConfig(fileHost, rolesHost string,
+	tokens utils.TokenSource) (jobs.ServiceConfig, error) {
+	accessor, err := filestore.NewAccessorFromURL(fileHost, "jobs-api", tokens)
+	if err != nil {
+		return jobs.ServiceConfig{}, err
+	}
+	cache, err := utils.NewRoleCache(rolesHost, "jobs-api", tokens)
+	if err != nil {
+		return jobs.ServiceConfig{}, err
+	}
+	teams, err := utils.NewRolesAccessor(rolesHost, "jobs-api", tokens)
+	if err != nil {
+		return jobs.ServiceConfig{}, err
 	}
+	return jobs.ServiceConfig{
+		Filestore: accessor,
+		Roles:     cache,
+		Teams:     teams,
+	}, nil
 }
 
-// function used to generate new instance of jobs API
-func NewJobsAPI(p jobs.Persistence, cfg jobs.ServiceConfig) *gin.Engine {
+// function used to generate new instance of jobs API. requests
+// are authenticated with the given authenticator
+func NewJobsAPI(p jobs.Persistence, cfg jobs.ServiceConfig,
+	auth utils.Authenticator) *gin.Engine {
 	// set persistence as global within module
 	jobs.SetPersistence(p)
 	jobs.SetConfig(cfg)
 	// generate new instance of gin router and assign routes
 	r := gin.Default()
-	r.Use(utils.UserHeaderMiddleware())
+	r.Use(utils.AuthMiddleware(auth))
 
 	r.GET("/jobs/health_check", jobs.HealthCheckHandler)
 	// add request handlers to retrieve jobs
-	r.GET("/jobs/list/all", utils.RoleMiddelware(roles.Planner, cfg.RolesAPIHost),
+	r.GET("/jobs/list/all", utils.RequirePermission(roles.PermJobsReadAll, cfg.Roles),
 		jobs.ListJobsHandler)
 	r.GET("/jobs/list", jobs.ListUserJobsHandler)
+	r.GET("/jobs/queue", jobs.ListQueuedJobsHandler)
+	r.POST("/jobs/queue/:jobId/claim", jobs.ClaimJobHandler)
 	r.GET("/jobs/:jobId", jobs.GetJobHandler)
+	r.GET("/jobs/:jobId/history", jobs.GetJobHistoryHandler)
+	r.GET("/jobs/:jobId/graph", jobs.GetJobGraphHandler)
 
 	// add request handler to create new jobs
-	r.POST("/jobs/new", utils.RoleMiddelware(roles.Clerk, cfg.RolesAPIHost),
+	r.POST("/jobs/new", utils.RequirePermission(roles.PermJobsCreate, cfg.Roles),
 		jobs.CreateJobHandler)
 	r.POST("/jobs/:jobId/attachments", jobs.AddJobAttachmentHandler)
 	// add request handlers to modify existing jobs
 	r.PATCH("/jobs/:jobId/state", jobs.AlterJobStateHandler)
-	r.PATCH("/jobs/:jobId/assign", utils.RoleMiddelware(roles.Planner, cfg.RolesAPIHost),
+	r.PATCH("/jobs/:jobId/assign", utils.RequirePermission(roles.PermJobsAssign, cfg.Roles),
 		jobs.AssignJobHandler)
+	r.DELETE("/jobs/:jobId/assign/:uid", utils.RequirePermission(roles.PermJobsAssign,
+		cfg.Roles), jobs.UnassignJobHandler)
 	r.PATCH("/jobs/:jobId/meta", jobs.PatchJobMetaHandler)
-	r.DELETE("/jobs/:jobId", utils.RoleMiddelware(roles.Admin, cfg.RolesAPIHost),
+	r.POST("/jobs/:jobId/dependencies", jobs.AddDependencyHandler)
+	r.DELETE("/jobs/:jobId/dependencies/:dependencyId", jobs.RemoveDependencyHandler)
+
+	// add request handlers to manage recurring job templates
+	r.GET("/jobs/templates", utils.RequirePermission(roles.PermJobsTemplates, cfg.Roles),
+		jobs.ListTemplatesHandler)
+	r.POST("/jobs/templates", utils.RequirePermission(roles.PermJobsTemplates, cfg.Roles),
+		jobs.CreateTemplateHandler)
+	r.GET("/jobs/templates/:templateId", utils.RequirePermission(roles.PermJobsTemplates,
+		cfg.Roles), jobs.GetTemplateHandler)
+	r.DELETE("/jobs/templates/:templateId", utils.RequirePermission(roles.PermJobsTemplates,
+		cfg.Roles), jobs.DeleteTemplateHandler)
+
+	// add request handlers to manage comments on jobs
+	r.GET("/jobs/:jobId/comments", jobs.ListCommentsHandler)
+	r.POST("/jobs/:jobId/comments", jobs.AddCommentHandler)
+	r.PATCH("/jobs/:jobId/comments/:commentId", jobs.EditCommentHandler)
+	r.DELETE("/jobs/:jobId/comments/:commentId", jobs.DeleteCommentHandler)
+	r.GET("/jobs/:jobId/comments/:commentId/history", jobs.GetCommentHistoryHandler)
+	r.DELETE("/jobs/:jobId", utils.RequirePermission(roles.PermJobsDelete, cfg.Roles),
 		jobs.DeleteJobHandler)
+
+	// add request handler used by the roles API to invalidate cached roles
+	r.POST("/jobs/roles/invalidate", utils.RequireServiceOrPermission(roles.PermRolesManage,
+		cfg.Roles), utils.RoleCacheInvalidationHandler(cfg.Roles))
 	return r
 }
 
+// function used to generate new instance of overdue job scheduler
+func NewOverdueScheduler(p jobs.Persistence, interval time.Duration) *jobs.OverdueScheduler {
+	return &jobs.OverdueScheduler{
+		Persistence: p,
+		Interval:    interval,
+		BatchSize:   100,
+	}
+}
+
+// function used to generate new instance of recurring job generator
+func NewTemplateGenerator(p jobs.Persistence, interval time.Duration) *jobs.TemplateGenerator {
+	return &jobs.TemplateGenerator{
+		Persistence: p,
+		Interval:    interval,
+	}
+}
+
 // function used to generate new instance of postgres persistence
 func NewPostgresPersistence(url string) *db.PostgresPersistence {
 	// generate base persistence layer
@@ -1,23 +1,46 @@
 package roles
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/PSauerborn/gamma-project/internal/pkg/roles"
 	db "github.com/PSauerborn/gamma-project/internal/pkg/roles/persistence"
 	"github.com/PSauerborn/gamma-project/pkg/utils"
 	"github.com/gin-gonic/gin"
 )
 
-// function used to generate new instance of roles API
-func NewRolesAPI(p roles.Persistence) *gin.Engine {
+// define timeout used by role lookups
+const accessorTimeout = 5 * time.Second
+
+// function used to generate new instance of roles API. requests are
+// authenticated with the given authenticator, and hooks are called
+// whenever the role of a user is changed
+func NewRolesAPI(p roles.Persistence, auth utils.Authenticator,
+	hooks ...roles.RoleChangeHook) *gin.Engine {
 	// set persistence as global within module
 	roles.SetPersistence(p)
+	roles.SetRoleChangeHooks(hooks...)
 	// generate new instance of gin router and assign routes
 	r := gin.Default()
-	r.Use(utils.UserHeaderMiddleware())
+	r.Use(utils.AuthMiddleware(auth))
 
 	r.GET("/roles/health_check", roles.HealthCheckHandler)
 	r.GET("/roles/:uid", roles.GetUserRolesHandler)
 	r.PUT("/roles/set", roles.SetUserRolesHandler)
+	// add request handlers to administer role grants
+	r.GET("/roles/users", roles.ListRoleUsersHandler)
+	r.DELETE("/roles/:uid", roles.RevokeUserRoleHandler)
+	// add request handlers to manage permissions granted to roles
+	r.GET("/roles/permissions", roles.ListRolePermissionsHandler)
+	r.PUT("/roles/permissions/:role", roles.SetRolePermissionsHandler)
+	// add request handlers to manage teams
+	r.GET("/roles/teams", roles.ListTeamsHandler)
+	r.POST("/roles/teams", roles.CreateTeamHandler)
+	r.GET("/roles/teams/:teamId", roles.GetTeamHandler)
+	r.DELETE("/roles/teams/:teamId", roles.DeleteTeamHandler)
+	r.PUT("/roles/teams/:teamId/members", roles.AddTeamMemberHandler)
+	r.DELETE("/roles/teams/:teamId/members/:uid", roles.RemoveTeamMemberHandler)
 
 	return r
 }
@@ -30,3 +53,39 @@ func NewPostgresPersistence(url string) *db.PostgresPersistence {
 		BasePostgresPersistence: base,
 	}
 }
+
+// function used to generate new instance of API accessor. requests
+// are sent on behalf of the given user, and authenticated with tokens
+// from the given source if set
+func NewAccessor(host, protocol string, port int, userId string,
+	tokens utils.TokenSource) *roles.RolesAPIAccessor {
+	baseAccessor := utils.NewBaseAccessor(host, protocol, port)
+	baseAccessor.Client = &http.Client{Timeout: accessorTimeout}
+	baseAccessor.Tokens = tokens
+	return &roles.RolesAPIAccessor{
+		BaseAPIAccessor: baseAccessor,
+		UserId:          userId,
+	}
+}
+
+// function used to generate new instance of API accessor from
+// the base URL of the roles API (e.g. http://localhost:10313)
+func NewAccessorFromURL(baseURL, userId string,
+	tokens utils.TokenSource) (*roles.RolesAPIAccessor, error) {
+	baseAccessor, err := utils.NewBaseAccessorFromURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	baseAccessor.Client = &http.Client{Timeout: accessorTimeout}
+	baseAccessor.Tokens = tokens
+	return &roles.RolesAPIAccessor{
+		BaseAPIAccessor: baseAccessor,
+		UserId:          userId,
+	}, nil
+}
+
+// function used to generate hook that notifies the given
+// URLs whenever the role of a user is changed
+func NewWebhookHook(urls []string, tokens utils.TokenSource) roles.RoleChangeHook {
+	return roles.NewWebhookHook(urls, tokens)
+}
@@ -1,6 +1,11 @@
 package utils
 
-import "github.com/PSauerborn/gamma-project/internal/pkg/utils"
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/utils"
+)
 
 func NewBaseAccessor(host, protocol string, port int) *utils.BaseAPIAccessor {
 	return &utils.BaseAPIAccessor{
@@ -9,3 +14,16 @@ func NewBaseAccessor(host, protocol string, port int) *utils.BaseAPIAccessor {
 		Protocol: protocol,
 	}
 }
+
+// function used to generate new base accessor from a base URL. the
+// port, if any, is retained as part of the host
+func NewBaseAccessorFromURL(baseURL string) (*utils.BaseAPIAccessor, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+		return nil, fmt.Errorf("received invalid base URL '%s'", baseURL)
+	}
+	return &utils.BaseAPIAccessor{
+		Host:     u.Host,
+		Protocol: u.Scheme,
+	}, nil
+}
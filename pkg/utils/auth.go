@@ -0,0 +1,280 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/PSauerborn/gamma-project/internal/pkg/utils"
+)
+
+var (
+	// define custom errors for authenticators
+	ErrMissingCredentials = errors.New("request does not contain credentials")
+	ErrMissingUserId      = errors.New("token does not contain user ID")
+	ErrInvalidAuthMode    = errors.New("received invalid authentication mode")
+)
+
+const (
+	// define supported authentication modes. the trusted gateway mode
+	// accepts the user ID set in the request header by an API gateway
+	// and must only be used if services cannot be reached directly
+	AuthModeJWT            = "jwt"
+	AuthModeTrustedGateway = "trusted_gateway"
+
+	// define lifetime of service tokens. tokens are renewed once
+	// less than the refresh window of their lifetime remains
+	serviceTokenTTL           = 5 * time.Minute
+	serviceTokenRefreshWindow = time.Minute
+)
+
+// define interface used to retrieve bearer tokens for service requests
+type TokenSource = utils.TokenSource
+
+// define struct used to store the identity of an authenticated user
+type Identity struct {
+	Uid    string
+	Claims map[string]interface{}
+}
+
+// define interface used to authenticate incoming requests
+type Authenticator interface {
+	Authenticate(request *http.Request) (Identity, error)
+}
+
+// define struct used to store authentication settings
+type AuthConfig struct {
+	Mode string
+	// file containing secret used to verify and sign HS256 tokens
+	SecretFile string
+	// local JWKS file containing public keys used to verify RS256 tokens
+	JWKSFile string
+	Issuer   string
+	Audience string
+	// claim containing the user ID. defaults to the subject
+	UidClaim string
+	// PEM encoded private key and key ID used to sign RS256 service
+	// tokens. service tokens are signed with the secret if unset
+	SigningKeyFile string
+	SigningKeyId   string
+}
+
+// function used to read authentication settings from a config map
+func NewAuthConfig(cfg *utils.ConfigMap) AuthConfig {
+	return AuthConfig{
+		Mode:           cfg.Get("auth_mode"),
+		SecretFile:     cfg.Get("jwt_secret_file"),
+		JWKSFile:       cfg.Get("jwt_jwks_file"),
+		Issuer:         cfg.Get("jwt_issuer"),
+		Audience:       cfg.Get("jwt_audience"),
+		UidClaim:       cfg.Get("jwt_uid_claim"),
+		SigningKeyFile: cfg.Get("service_token_key_file"),
+		SigningKeyId:   cfg.Get("service_token_key_id"),
+	}
+}
+
+// function used to load the secret used for HS256 tokens, if any
+func (cfg AuthConfig) secret() ([]byte, error) {
+	if len(cfg.SecretFile) == 0 {
+		return nil, nil
+	}
+	secret, err := ioutil.ReadFile(cfg.SecretFile)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to read JWT secret file %s: %+v", cfg.SecretFile, err))
+		return nil, err
+	}
+	secret = bytes.TrimSpace(secret)
+	if len(secret) == 0 {
+		return nil, ErrInvalidKeyConfig
+	}
+	return secret, nil
+}
+
+// function used to generate new authenticator for the configured mode
+func NewAuthenticator(cfg AuthConfig) (Authenticator, error) {
+	switch cfg.Mode {
+	case AuthModeTrustedGateway:
+		log.Warn("trusting user ID headers set by API gateway")
+		return HeaderAuthenticator{}, nil
+	case AuthModeJWT:
+		secret, err := cfg.secret()
+		if err != nil {
+			return nil, err
+		}
+		keys := TokenKeys{Secret: secret}
+		if len(cfg.JWKSFile) > 0 {
+			if keys.PublicKeys, err = LoadJWKS(cfg.JWKSFile); err != nil {
+				return nil, err
+			}
+		}
+		if len(keys.Secret) == 0 && len(keys.PublicKeys) == 0 {
+			log.Error("JWT authentication requires a secret or JWKS file")
+			return nil, ErrInvalidKeyConfig
+		}
+		uidClaim := cfg.UidClaim
+		if len(uidClaim) == 0 {
+			uidClaim = "sub"
+		}
+		return &JWTAuthenticator{
+			Keys:     keys,
+			Issuer:   cfg.Issuer,
+			Audience: cfg.Audience,
+			UidClaim: uidClaim,
+		}, nil
+	default:
+		return nil, ErrInvalidAuthMode
+	}
+}
+
+// define authenticator that trusts the user ID header set by
+// an API gateway. no claims are available in this mode
+type HeaderAuthenticator struct{}
+
+// function used to extract the user ID from the request header
+func (HeaderAuthenticator) Authenticate(request *http.Request) (Identity, error) {
+	uid := request.Header.Get("X-Authenticated-Userid")
+	if len(uid) == 0 || uid == "undefined" {
+		return Identity{}, ErrMissingCredentials
+	}
+	return Identity{Uid: uid, Claims: map[string]interface{}{}}, nil
+}
+
+// define authenticator that validates signed bearer tokens
+type JWTAuthenticator struct {
+	Keys     TokenKeys
+	Issuer   string
+	Audience string
+	UidClaim string
+}
+
+// function used to validate the bearer token of a request and
+// extract the user ID from its claims
+func (auth *JWTAuthenticator) Authenticate(request *http.Request) (Identity, error) {
+	header := request.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return Identity{}, ErrMissingCredentials
+	}
+	claims, err := auth.Keys.Verify(strings.TrimSpace(header[7:]))
+	if err != nil {
+		return Identity{}, err
+	}
+	if err := ValidateClaims(claims, auth.Issuer, auth.Audience, time.Now()); err != nil {
+		return Identity{}, err
+	}
+	uid, ok := claims[auth.UidClaim].(string)
+	if !ok || len(uid) == 0 {
+		return Identity{}, ErrMissingUserId
+	}
+	return Identity{Uid: uid, Claims: claims}, nil
+}
+
+// function used to generate middleware that authenticates requests
+// and sets the user ID and token claims in the request context
+func AuthMiddleware(auth Authenticator) gin.HandlerFunc {
+	_, trusted := auth.(HeaderAuthenticator)
+	return func(ctx *gin.Context) {
+		identity, err := auth.Authenticate(ctx.Request)
+		if err != nil {
+			log.Warn(fmt.Sprintf("unable to authenticate request: %+v", err))
+			// requests without user headers have always been rejected
+			// as forbidden, and are still rejected as such behind a gateway
+			status := http.StatusUnauthorized
+			if trusted {
+				status = http.StatusForbidden
+			} else {
+				ctx.Header("WWW-Authenticate", "Bearer")
+			}
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": http.StatusText(status)})
+			return
+		}
+		ctx.Set("uid", identity.Uid)
+		ctx.Set("claims", identity.Claims)
+		ctx.Next()
+	}
+}
+
+// define token source used to issue tokens that authenticate requests
+// sent by a service to other services. tokens are cached until they
+// are close to expiring
+type ServiceTokenIssuer struct {
+	Service  string
+	Issuer   string
+	Audience string
+	Secret   []byte
+	Key      *rsa.PrivateKey
+	KeyId    string
+
+	lock    sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// function used to generate new service token issuer. tokens are signed
+// with the private key if configured, and with the secret otherwise. no
+// issuer is returned if neither is configured
+func NewServiceTokenIssuer(cfg AuthConfig, service string) (TokenSource, error) {
+	issuer := &ServiceTokenIssuer{
+		Service:  service,
+		Issuer:   cfg.Issuer,
+		Audience: cfg.Audience,
+		KeyId:    cfg.SigningKeyId,
+	}
+	if len(cfg.SigningKeyFile) > 0 {
+		key, err := LoadRSAPrivateKey(cfg.SigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		issuer.Key = key
+		return issuer, nil
+	}
+	secret, err := cfg.secret()
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) == 0 {
+		return nil, nil
+	}
+	issuer.Secret = secret
+	return issuer, nil
+}
+
+// function used to retrieve a valid service token
+func (issuer *ServiceTokenIssuer) Token() (string, error) {
+	issuer.lock.Lock()
+	defer issuer.lock.Unlock()
+
+	now := time.Now()
+	if len(issuer.token) > 0 && now.Add(serviceTokenRefreshWindow).Before(issuer.expires) {
+		return issuer.token, nil
+	}
+	expires := now.Add(serviceTokenTTL)
+	claims := map[string]interface{}{
+		"sub":     issuer.Service,
+		"iat":     now.Unix(),
+		"exp":     expires.Unix(),
+		"service": true,
+	}
+	if len(issuer.Issuer) > 0 {
+		claims["iss"] = issuer.Issuer
+	}
+	if len(issuer.Audience) > 0 {
+		claims["aud"] = issuer.Audience
+	}
+	token, err := SignToken(claims, issuer.Secret, issuer.Key, issuer.KeyId)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to sign service token: %+v", err))
+		return "", err
+	}
+	issuer.token, issuer.expires = token, expires
+	return token, nil
+}
@@ -0,0 +1,263 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	b64 "encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// define custom errors for JSON web tokens
+	ErrInvalidToken     = errors.New("received invalid token")
+	ErrTokenExpired     = errors.New("received expired token")
+	ErrUnsupportedAlg   = errors.New("received token with unsupported algorithm")
+	ErrUnknownKey       = errors.New("received token signed with unknown key")
+	ErrInvalidKeyConfig = errors.New("received invalid key configuration")
+)
+
+// define allowed clock skew when validating token times
+const tokenLeeway = time.Minute
+
+// define struct used to store the keys used to verify tokens. tokens
+// signed with HS256 are verified with the shared secret, and tokens
+// signed with RS256 with the public key matching their key ID
+type TokenKeys struct {
+	Secret     []byte
+	PublicKeys map[string]*rsa.PublicKey
+}
+
+// define struct used to store the header of a token
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// function used to verify the signature of a token and decode
+// its claims. token times are not validated
+func (keys TokenKeys) Verify(token string) (map[string]interface{}, error) {
+	claims := map[string]interface{}{}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, ErrInvalidToken
+	}
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return claims, ErrInvalidToken
+	}
+	signature, err := b64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch header.Alg {
+	case "HS256":
+		if len(keys.Secret) == 0 {
+			return claims, ErrUnsupportedAlg
+		}
+		if !hmac.Equal(signHS256(keys.Secret, signed), signature) {
+			return claims, ErrInvalidToken
+		}
+	case "RS256":
+		key, ok := keys.PublicKeys[header.Kid]
+		// tokens without key IDs are accepted if only a single key is configured
+		if !ok && len(header.Kid) == 0 && len(keys.PublicKeys) == 1 {
+			for _, k := range keys.PublicKeys {
+				key, ok = k, true
+			}
+		}
+		if !ok {
+			return claims, ErrUnknownKey
+		}
+		hashed := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], signature); err != nil {
+			return claims, ErrInvalidToken
+		}
+	default:
+		return claims, ErrUnsupportedAlg
+	}
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return claims, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// function used to validate the registered time, issuer and audience
+// claims of a token. the issuer and audience are only validated if set
+func ValidateClaims(claims map[string]interface{}, issuer, audience string, now time.Time) error {
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return ErrInvalidToken
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(tokenLeeway)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(tokenLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return ErrInvalidToken
+	}
+	if len(issuer) > 0 && claims["iss"] != issuer {
+		return ErrInvalidToken
+	}
+	if len(audience) > 0 && !hasAudience(claims["aud"], audience) {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// function used to determine if the audience claim of a token,
+// which can either be a string or a list of strings, contains
+// the expected audience
+func hasAudience(claim interface{}, audience string) bool {
+	switch aud := claim.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// function used to sign a set of claims. tokens are signed with RS256
+// if a private key is given, and with HS256 using the secret otherwise
+func SignToken(claims map[string]interface{}, secret []byte, key *rsa.PrivateKey,
+	keyId string) (string, error) {
+	header := tokenHeader{Alg: "HS256", Typ: "JWT"}
+	if key != nil {
+		header = tokenHeader{Alg: "RS256", Typ: "JWT", Kid: keyId}
+	}
+	headerSegment, err := encodeSegment(header)
+	if err != nil {
+		return "", err
+	}
+	claimsSegment, err := encodeSegment(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := []byte(headerSegment + "." + claimsSegment)
+	var signature []byte
+	if key != nil {
+		hashed := sha256.Sum256(signed)
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+		if err != nil {
+			return "", err
+		}
+	} else {
+		signature = signHS256(secret, signed)
+	}
+	return string(signed) + "." + b64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func signHS256(secret, data []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func encodeSegment(value interface{}) (string, error) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return b64.RawURLEncoding.EncodeToString(body), nil
+}
+
+func decodeSegment(segment string, value interface{}) error {
+	body, err := b64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, value)
+}
+
+// function used to load RSA public keys from a local JWKS file.
+// keys that are not RSA signing keys are ignored
+func LoadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	keys := map[string]*rsa.PublicKey{}
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to read JWKS file %s: %+v", path, err))
+		return keys, err
+	}
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &jwks); err != nil {
+		log.Error(fmt.Errorf("unable to parse JWKS file %s: %+v", path, err))
+		return keys, ErrInvalidKeyConfig
+	}
+
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (len(k.Use) > 0 && k.Use != "sig") {
+			continue
+		}
+		n, errN := b64.RawURLEncoding.DecodeString(k.N)
+		e, errE := b64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 {
+			log.Error(fmt.Errorf("received invalid RSA key %s in JWKS file", k.Kid))
+			return keys, ErrInvalidKeyConfig
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		log.Error(fmt.Errorf("JWKS file %s contains no RSA signing keys", path))
+		return keys, ErrInvalidKeyConfig
+	}
+	return keys, nil
+}
+
+// function used to load a PEM encoded RSA private key. both PKCS #1
+// and PKCS #8 encoded keys are supported
+func LoadRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to read private key file %s: %+v", path, err))
+		return nil, err
+	}
+	block, _ := pem.Decode(body)
+	if block == nil {
+		return nil, ErrInvalidKeyConfig
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		log.Error(fmt.Errorf("unable to parse private key file %s: %+v", path, err))
+		return nil, ErrInvalidKeyConfig
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKeyConfig
+	}
+	return rsaKey, nil
+}
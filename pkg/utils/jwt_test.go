@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	b64 "encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testSecret = []byte("test-secret")
+	testKey    = mustGenerateKey()
+	otherKey   = mustGenerateKey()
+)
+
+func mustGenerateKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// function used to generate the claims of a valid token
+func testClaims() map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"sub": "user-1",
+		"iss": "issuer",
+		"aud": "audience",
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+}
+
+// function used to sign a token with an arbitrary header
+func signWithHeader(t *testing.T, header tokenHeader, claims map[string]interface{},
+	sign func(signed []byte) []byte) string {
+	headerSegment, err := encodeSegment(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimsSegment, err := encodeSegment(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := headerSegment + "." + claimsSegment
+	return signed + "." + b64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func authenticate(auth Authenticator, token string) (Identity, error) {
+	request, _ := http.NewRequest("GET", "/", nil)
+	if len(token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	return auth.Authenticate(request)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	keys := TokenKeys{
+		Secret:     testSecret,
+		PublicKeys: map[string]*rsa.PublicKey{"key-1": &testKey.PublicKey},
+	}
+	rsaOnly := TokenKeys{PublicKeys: keys.PublicKeys}
+	publicKey := x509.MarshalPKCS1PublicKey(&testKey.PublicKey)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: publicKey})
+
+	sign := func(claims map[string]interface{}, secret []byte, key *rsa.PrivateKey,
+		keyId string) string {
+		token, err := SignToken(claims, secret, key, keyId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	withClaim := func(name string, value interface{}) map[string]interface{} {
+		claims := testClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+	now := time.Now()
+
+	cases := []struct {
+		name  string
+		keys  TokenKeys
+		token string
+		err   error
+	}{
+		{"valid HS256", keys, sign(testClaims(), testSecret, nil, ""), nil},
+		{"valid RS256", keys, sign(testClaims(), nil, testKey, "key-1"), nil},
+		{"RS256 without key ID and single key", keys, sign(testClaims(), nil, testKey, ""), nil},
+		{"audience list", keys, sign(withClaim("aud", []string{"other", "audience"}),
+			testSecret, nil, ""), nil},
+		{"expired within leeway", keys, sign(withClaim("exp", now.Add(-30*time.Second).Unix()),
+			testSecret, nil, ""), nil},
+
+		{"missing token", keys, "", ErrMissingCredentials},
+		{"malformed token", keys, "not-a-token", ErrInvalidToken},
+		{"alg none", keys, signWithHeader(t, tokenHeader{Alg: "none"}, testClaims(),
+			func([]byte) []byte { return nil }), ErrUnsupportedAlg},
+		{"alg none with empty signature segment", keys, strings.TrimSuffix(signWithHeader(t,
+			tokenHeader{Alg: "none"}, testClaims(), func([]byte) []byte { return nil }), "."),
+			ErrInvalidToken},
+		{"HS256 signed with public key", keys, signWithHeader(t, tokenHeader{Alg: "HS256",
+			Kid: "key-1"}, testClaims(), func(signed []byte) []byte {
+			return signHS256(publicPEM, signed)
+		}), ErrInvalidToken},
+		{"HS256 signed with public key without secret", rsaOnly, signWithHeader(t,
+			tokenHeader{Alg: "HS256", Kid: "key-1"}, testClaims(), func(signed []byte) []byte {
+				return signHS256(publicPEM, signed)
+			}), ErrUnsupportedAlg},
+		{"unsupported alg", keys, signWithHeader(t, tokenHeader{Alg: "RS512", Kid: "key-1"},
+			testClaims(), func([]byte) []byte { return []byte("signature") }), ErrUnsupportedAlg},
+		{"unknown key ID", keys, sign(testClaims(), nil, testKey, "key-2"), ErrUnknownKey},
+		{"signed with other key", keys, sign(testClaims(), nil, otherKey, "key-1"), ErrInvalidToken},
+		{"signed with other secret", keys, sign(testClaims(), []byte("other"), nil, ""),
+			ErrInvalidToken},
+		{"expired", keys, sign(withClaim("exp", now.Add(-2*time.Minute).Unix()), testSecret,
+			nil, ""), ErrTokenExpired},
+		{"missing expiry", keys, sign(withClaim("exp", nil), testSecret, nil, ""), ErrInvalidToken},
+		{"not yet valid", keys, sign(withClaim("nbf", now.Add(2*time.Minute).Unix()), testSecret,
+			nil, ""), ErrInvalidToken},
+		{"wrong issuer", keys, sign(withClaim("iss", "other"), testSecret, nil, ""), ErrInvalidToken},
+		{"missing issuer", keys, sign(withClaim("iss", nil), testSecret, nil, ""), ErrInvalidToken},
+		{"wrong audience", keys, sign(withClaim("aud", "other"), testSecret, nil, ""), ErrInvalidToken},
+		{"wrong audience list", keys, sign(withClaim("aud", []string{"other"}), testSecret, nil, ""),
+			ErrInvalidToken},
+		{"missing user ID", keys, sign(withClaim("sub", nil), testSecret, nil, ""), ErrMissingUserId},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			auth := &JWTAuthenticator{Keys: c.keys, Issuer: "issuer", Audience: "audience",
+				UidClaim: "sub"}
+			identity, err := authenticate(auth, c.token)
+			if err != c.err {
+				t.Fatalf("expected error %v, got %v", c.err, err)
+			}
+			if err == nil && identity.Uid != "user-1" {
+				t.Errorf("expected user-1, got %s", identity.Uid)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticatorRejectsTamperedTokens(t *testing.T) {
+	auth := &JWTAuthenticator{
+		Keys: TokenKeys{
+			Secret:     testSecret,
+			PublicKeys: map[string]*rsa.PublicKey{"key-1": &testKey.PublicKey},
+		},
+		UidClaim: "sub",
+	}
+	for _, key := range []*rsa.PrivateKey{nil, testKey} {
+		token, err := SignToken(testClaims(), testSecret, key, "key-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.Split(token, ".")
+
+		// replace the claims with claims for a different user
+		claims := testClaims()
+		claims["sub"] = "admin"
+		forged, _ := encodeSegment(claims)
+		if _, err := authenticate(auth, parts[0]+"."+forged+"."+parts[2]); err != ErrInvalidToken {
+			t.Errorf("expected forged claims to be rejected, got %v", err)
+		}
+
+		// flip a bit of the signature
+		signature, _ := b64.RawURLEncoding.DecodeString(parts[2])
+		signature[0] ^= 1
+		tampered := parts[0] + "." + parts[1] + "." + b64.RawURLEncoding.EncodeToString(signature)
+		if _, err := authenticate(auth, tampered); err != ErrInvalidToken {
+			t.Errorf("expected tampered signature to be rejected, got %v", err)
+		}
+	}
+}
+
+func TestLoadJWKS(t *testing.T) {
+	encode := func(i *big.Int) string { return b64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	jwks := map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "use": "sig", "kid": "key-1", "n": encode(testKey.N),
+			"e": encode(big.NewInt(int64(testKey.E)))},
+		{"kty": "RSA", "use": "enc", "kid": "key-2", "n": encode(otherKey.N),
+			"e": encode(big.NewInt(int64(otherKey.E)))},
+		{"kty": "EC", "kid": "key-3"},
+	}}
+	body, _ := json.Marshal(jwks)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := ioutil.WriteFile(path, body, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadJWKS(path)
+	if err != nil {
+		t.Fatalf("unable to load JWKS: %+v", err)
+	}
+	if len(keys) != 1 || keys["key-1"] == nil || !keys["key-1"].Equal(&testKey.PublicKey) {
+		t.Fatalf("expected only signing key key-1, got %v", keys)
+	}
+	token, _ := SignToken(testClaims(), nil, testKey, "key-1")
+	if _, err := (TokenKeys{PublicKeys: keys}).Verify(token); err != nil {
+		t.Errorf("expected token to be verified with loaded key: %+v", err)
+	}
+}
+
+func TestServiceTokenIssuer(t *testing.T) {
+	cases := []struct {
+		name   string
+		issuer *ServiceTokenIssuer
+		keys   TokenKeys
+	}{
+		{"HS256", &ServiceTokenIssuer{Service: "jobs-api", Issuer: "issuer",
+			Audience: "audience", Secret: testSecret}, TokenKeys{Secret: testSecret}},
+		{"RS256", &ServiceTokenIssuer{Service: "jobs-api", Issuer: "issuer",
+			Audience: "audience", Key: testKey, KeyId: "key-1"},
+			TokenKeys{PublicKeys: map[string]*rsa.PublicKey{"key-1": &testKey.PublicKey}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			token, err := c.issuer.Token()
+			if err != nil {
+				t.Fatalf("unable to issue token: %+v", err)
+			}
+			auth := &JWTAuthenticator{Keys: c.keys, Issuer: "issuer", Audience: "audience",
+				UidClaim: "sub"}
+			identity, err := authenticate(auth, token)
+			if err != nil {
+				t.Fatalf("unable to authenticate service token: %+v", err)
+			}
+			if identity.Uid != "jobs-api" || identity.Claims["service"] != true {
+				t.Errorf("unexpected service identity %+v", identity)
+			}
+
+			// tokens are cached until they are close to expiring
+			cached, err := c.issuer.Token()
+			if err != nil || cached != token {
+				t.Errorf("expected cached token to be returned")
+			}
+			// tokens issued within the same second are identical, so renewal
+			// is detected through the updated expiry
+			expiring := time.Now().Add(serviceTokenRefreshWindow / 2)
+			c.issuer.expires = expiring
+			if _, err := c.issuer.Token(); err != nil || !c.issuer.expires.After(expiring) {
+				t.Errorf("expected token to be renewed close to expiry")
+			}
+		})
+	}
+}
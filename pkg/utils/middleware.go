@@ -1,116 +1,128 @@
 package utils
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/PSauerborn/gamma-project/internal/pkg/roles"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 )
 
-func UserHeaderMiddleware() gin.HandlerFunc {
-	return func(ctx *gin.Context) {
-		// extract user ID from request header and parse
-		userid := ctx.Request.Header.Get("X-Authenticated-Userid")
-		if len(userid) == 0 || userid == "undefined" {
-			log.Warn(("cannot extract user ID from header"))
-			status := http.StatusForbidden
-			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
-				"message": "Forbidden"})
-			return
-		}
-		ctx.Set("uid", userid)
-		ctx.Next()
+// define timeout used by role lookups
+const roleLookupTimeout = 5 * time.Second
+
+// function used to generate new accessor for the roles API at the
+// given base URL. requests are sent on behalf of the given user, and
+// authenticated with tokens from the given source if set
+func NewRolesAccessor(baseURL, userId string, tokens TokenSource) (*roles.RolesAPIAccessor, error) {
+	baseAccessor, err := NewBaseAccessorFromURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	baseAccessor.Client = &http.Client{Timeout: roleLookupTimeout}
+	baseAccessor.Tokens = tokens
+	return &roles.RolesAPIAccessor{
+		BaseAPIAccessor: baseAccessor,
+		UserId:          userId,
+	}, nil
+}
+
+// function used to generate new cache of roles retrieved from the
+// roles API at the given base URL, using the default cache lifetimes.
+// lookups are sent on behalf of the given user, and authenticated with
+// tokens from the given source if set
+func NewRoleCache(baseURL, userId string, tokens TokenSource) (*roles.RoleCache, error) {
+	accessor, err := NewRolesAccessor(baseURL, userId, tokens)
+	if err != nil {
+		return nil, err
 	}
+	return roles.NewRoleCache(accessor, roles.DefaultRoleCacheTTL,
+		roles.DefaultRoleCacheNegativeTTL), nil
 }
 
-func RoleMiddelware(required roles.Role, host string) gin.HandlerFunc {
+// function used to generate middleware that rejects users without
+// the required permission. permissions are retrieved through the
+// given cache
+func RequirePermission(required roles.Permission, cache *roles.RoleCache) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		// get user id from request headers
-		userid := ctx.Request.Header.Get("X-Authenticated-Userid")
-		if len(userid) == 0 || userid == "undefined" {
-			log.Warn(("cannot extract user ID from header"))
+		// get user id set by authentication middleware
+		userid := ctx.GetString("uid")
+		if len(userid) == 0 {
+			log.Warn(("cannot extract user ID from request context"))
 			status := http.StatusForbidden
 			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
 				"message": "Forbidden"})
 			return
 		}
-		// generate new http request
-		url := fmt.Sprintf("%s/roles/%s", host, userid)
-		request, err := http.NewRequest("GET", url, nil)
+
+		grant, err := cache.GetUserGrant(ctx.Request.Context(), userid)
 		if err != nil {
-			log.Error(fmt.Errorf("unable to generate new HTTP request: %+v", err))
+			log.Error(fmt.Errorf("unable to retrieve user permissions: %+v", err))
 			status := http.StatusInternalServerError
 			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
 				"message": "Internal server error"})
 			return
 		}
-		request.Header.Set("Content-Type", "application/json")
-		request.Header.Set("X-Authenticated-Userid", "roles-lookup")
-		// generate http client and get roles from roles API
-		client := &http.Client{}
-
-		resp, err := client.Do(request)
-		if err != nil {
-			log.Error(fmt.Errorf("unable to execute HTTP request: %+v", err))
-			status := http.StatusInternalServerError
+		if !grant.Has(required) {
+			log.Warn(fmt.Errorf("user %s does not have permission %s to access route",
+				userid, required))
+			status := http.StatusForbidden
 			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
-				"message": "Internal server error"})
+				"message": "Forbidden"})
 			return
 		}
-		defer resp.Body.Close()
-
-		// handle response from roles API
-		switch resp.StatusCode {
-		case 200:
-			var r struct {
-				HTTPCode int    `json:"http_code"`
-				Role     string `json:"role"`
-			}
-			// decode API JSON response to struct
-			if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
-				log.Error(fmt.Errorf("unable to parse API response: %+v", err))
-				status := http.StatusInternalServerError
-				ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
-					"message": "Internal server error"})
-				return
-			}
+		ctx.Next()
+	}
+}
 
-			// convert role returned from API into Role instance
-			role, err := roles.StringToRole(r.Role)
-			if err != nil {
-				log.Errorf(fmt.Sprintf("received invalid role %s from API", role))
-				status := http.StatusInternalServerError
-				ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
-					"message": "Internal server error"})
-				return
-			}
+// function used to generate middleware that admits requests sent by
+// other services with a service token, and otherwise rejects users
+// without the required permission
+func RequireServiceOrPermission(required roles.Permission, cache *roles.RoleCache) gin.HandlerFunc {
+	permission := RequirePermission(required, cache)
+	return func(ctx *gin.Context) {
+		value, _ := ctx.Get("claims")
+		claims, _ := value.(map[string]interface{})
+		if service, _ := claims["service"].(bool); service {
+			ctx.Next()
+			return
+		}
+		permission(ctx)
+	}
+}
 
-			// if user role is large or equal to required role,
-			// executer request. else return 403
-			if role >= required {
-				ctx.Next()
-			} else {
-				log.Warn(fmt.Errorf("user %s does not have required roles to access route", userid))
-				status := http.StatusForbidden
-				ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
-					"message": "Forbidden"})
-				return
-			}
-		default:
-			body, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				log.Errorf("received invalid API response: %+v", err)
-			} else {
-				log.Error(fmt.Errorf("unable to retrieve user roles: received response %s", string(body)))
-			}
-			status := http.StatusInternalServerError
+// function used to generate API handler that removes the cached role
+// of a user, or the cached roles of all users if requested. the handler
+// is called by the roles API when roles or role permissions change
+func RoleCacheInvalidationHandler(cache *roles.RoleCache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		log.Info("received request to invalidate cached role")
+		var r struct {
+			Uid string `json:"uid"`
+			All bool   `json:"all"`
+		}
+		if err := ctx.ShouldBind(&r); err != nil {
+			log.Error(fmt.Errorf("unable to parse request body: %+v", err))
+			status := http.StatusBadRequest
 			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
-				"message": "Internal server error"})
+				"message": "Invalid request body"})
 			return
 		}
+		if len(r.Uid) == 0 && !r.All {
+			log.Error("received invalidation request without user ID")
+			status := http.StatusBadRequest
+			ctx.AbortWithStatusJSON(status, gin.H{"http_code": status,
+				"message": "Invalid request body"})
+			return
+		}
+		if r.All {
+			cache.InvalidateAll()
+		} else {
+			cache.Invalidate(r.Uid)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"http_code": http.StatusOK,
+			"message": "Successfully invalidated cached role"})
 	}
 }